@@ -0,0 +1,196 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	arrowContentType = "application/vnd.apache.arrow.stream"
+	arrowBatchRows   = 1024
+)
+
+// arrowType maps a column to the Arrow type its values are written as.
+// DECIMAL stays a string so no precision is lost.
+func arrowType(ct *sql.ColumnType) arrow.DataType {
+	name := ct.DatabaseTypeName()
+	unsigned := strings.HasPrefix(name, "UNSIGNED ")
+	switch strings.TrimPrefix(name, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if unsigned {
+			return arrow.PrimitiveTypes.Uint64
+		}
+		return arrow.PrimitiveTypes.Int64
+	case "FLOAT", "DOUBLE":
+		return arrow.PrimitiveTypes.Float64
+	case "DATE":
+		return arrow.FixedWidthTypes.Date32
+	case "DATETIME", "TIMESTAMP":
+		return arrow.FixedWidthTypes.Timestamp_us
+	}
+	if binaryTypes[strings.TrimPrefix(name, "UNSIGNED ")] {
+		return arrow.BinaryTypes.Binary
+	}
+	return arrow.BinaryTypes.String
+}
+
+// writeArrow streams rows as an Arrow IPC stream in batches of
+// arrowBatchRows, returning the number of rows written.
+func writeArrow(c *gin.Context, rows *sql.Rows, columns []string) (int, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	fields := make([]arrow.Field, len(columnTypes))
+	for i, ct := range columnTypes {
+		fields[i] = arrow.Field{Name: columns[i], Type: arrowType(ct), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+
+	c.Header("Content-Type", arrowContentType)
+	c.Status(http.StatusOK)
+	w := ipc.NewWriter(c.Writer, ipc.WithSchema(schema))
+
+	flush := func() error {
+		record := builder.NewRecord()
+		defer record.Release()
+		return w.Write(record)
+	}
+
+	values := make([]any, len(columns))
+	valuePtrs := make([]any, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	count, batch := 0, 0
+	for rows.Next() {
+		touchRunningQuery(c)
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return count, err
+		}
+		for i, val := range values {
+			appendArrowValue(builder.Field(i), val)
+		}
+		count++
+		if batch++; batch == arrowBatchRows {
+			if err := flush(); err != nil {
+				return count, err
+			}
+			batch = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	// An empty result still gets a batch, so readers see the schema in use
+	if batch > 0 || count == 0 {
+		if err := flush(); err != nil {
+			return count, err
+		}
+	}
+	return count, w.Close()
+}
+
+// appendArrowValue appends a scanned value to b, which was built from the
+// column's arrowType; values that do not parse as that type are null.
+func appendArrowValue(b array.Builder, val any) {
+	if isNull(val) {
+		b.AppendNull()
+		return
+	}
+	text := func() string {
+		if raw, ok := val.([]byte); ok {
+			return string(raw)
+		}
+		return fmt.Sprint(convertValue(val))
+	}
+	var ok bool
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		var n int64
+		if n, ok = val.(int64); !ok {
+			var err error
+			n, err = strconv.ParseInt(text(), 10, 64)
+			ok = err == nil
+		}
+		if ok {
+			b.Append(n)
+		}
+	case *array.Uint64Builder:
+		var n uint64
+		if n, ok = val.(uint64); !ok {
+			var err error
+			n, err = strconv.ParseUint(text(), 10, 64)
+			ok = err == nil
+		}
+		if ok {
+			b.Append(n)
+		}
+	case *array.Float64Builder:
+		var f float64
+		switch v := val.(type) {
+		case float64:
+			f, ok = v, true
+		case float32:
+			f, ok = float64(v), true
+		default:
+			var err error
+			f, err = strconv.ParseFloat(text(), 64)
+			ok = err == nil
+		}
+		if ok {
+			b.Append(f)
+		}
+	case *array.Date32Builder:
+		var t time.Time
+		if t, ok = arrowTime(val, text); ok {
+			b.Append(arrow.Date32FromTime(t))
+		}
+	case *array.TimestampBuilder:
+		var t time.Time
+		if t, ok = arrowTime(val, text); ok {
+			b.Append(arrow.Timestamp(t.UnixMicro()))
+		}
+	case *array.BinaryBuilder:
+		if raw, isBytes := val.([]byte); isBytes {
+			b.Append(raw)
+		} else {
+			b.Append([]byte(text()))
+		}
+		ok = true
+	case *array.StringBuilder:
+		b.Append(text())
+		ok = true
+	}
+	if !ok {
+		b.AppendNull()
+	}
+}
+
+// arrowTime reads a DATE, DATETIME or TIMESTAMP value, which the driver
+// returns as text unless parseTime is set. Zero dates do not parse.
+func arrowTime(val any, text func() string) (time.Time, bool) {
+	if t, ok := val.(time.Time); ok {
+		return t, true
+	}
+	s := text()
+	layout := "2006-01-02 15:04:05.999999"
+	if len(s) == len("2006-01-02") {
+		layout = "2006-01-02"
+	}
+	t, err := time.ParseInLocation(layout, s, time.UTC)
+	return t, err == nil
+}
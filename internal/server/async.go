@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Async job states.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+const (
+	codeTooManyJobs      = "too_many_jobs"
+	asyncJanitorInterval = time.Minute
+)
+
+// asyncJob is a query run in the background by POST /queries/async. Jobs
+// live in memory only and belong to the session that started them.
+type asyncJob struct {
+	id      string
+	session string
+	query   string // as submitted, before template expansion
+	cancel  context.CancelFunc
+	webhook *webhook
+
+	// Guarded by asyncJobManager.mu
+	status     string
+	createdAt  time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	columns    []string
+	results    []map[string]any
+	truncated  bool
+	err        *apiError
+}
+
+func (j *asyncJob) finished() bool {
+	return j.status == jobSucceeded || j.status == jobFailed || j.status == jobCanceled
+}
+
+type asyncJobManager struct {
+	srv         *Server
+	mu          sync.Mutex
+	jobs        map[string]*asyncJob
+	slots       chan struct{}
+	janitorOnce sync.Once
+}
+
+// start queues a job running prepared, the expanded form of original. It
+// fails when the session already has cfg.AsyncMaxJobs unfinished jobs. At
+// most cfg.AsyncMaxConcurrent jobs run at once across all sessions; the
+// rest wait in the queue.
+func (m *asyncJobManager) start(session, original string, prepared preparedQuery, hook *webhook) (*asyncJob, error) {
+	m.janitorOnce.Do(func() {
+		m.slots = make(chan struct{}, m.srv.cfg.AsyncMaxConcurrent)
+		go m.janitor()
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unfinished := 0
+	for _, j := range m.jobs {
+		if j.session == session && !j.finished() {
+			unfinished++
+		}
+	}
+	if unfinished >= m.srv.cfg.AsyncMaxJobs {
+		return nil, errTooManyJobs
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &asyncJob{
+		id:        newID(),
+		session:   session,
+		query:     original,
+		cancel:    cancel,
+		webhook:   hook,
+		status:    jobQueued,
+		createdAt: time.Now().UTC(),
+	}
+	m.jobs[job.id] = job
+	go m.run(ctx, job, prepared)
+	return job, nil
+}
+
+var errTooManyJobs = errors.New("too many unfinished async queries")
+
+var errJobNotFound = errors.New("async query not found")
+
+// run waits for a free slot, then executes the job and stores its outcome.
+func (m *asyncJobManager) run(ctx context.Context, job *asyncJob, prepared preparedQuery) {
+	defer job.cancel()
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		m.finish(job, nil, nil, false, &apiError{Code: codeCanceled, Message: "The query was canceled"})
+		return
+	}
+	// The job also counts against the limits of queries run at once
+	releaseSlot, _, err := m.srv.queryLimits.acquire(ctx, job.session, true)
+	if err != nil {
+		_, body := m.srv.queryLimitError(err)
+		if ctx.Err() != nil {
+			body = apiError{Code: codeCanceled, Message: "The query was canceled"}
+		}
+		m.finish(job, nil, nil, false, &body)
+		return
+	}
+	defer releaseSlot()
+
+	m.mu.Lock()
+	job.status, job.startedAt = jobRunning, time.Now().UTC()
+	m.mu.Unlock()
+
+	columns, results, truncated, apiErr := m.srv.executeAsync(ctx, prepared)
+	m.finish(job, columns, results, truncated, apiErr)
+
+	status := "success"
+	if apiErr != nil {
+		status = "error"
+	}
+	m.srv.recordQuery(ctx, job.session, prepared.creds, historyEntry{
+		Query:      job.query,
+		Database:   prepared.useDatabase,
+		DurationMs: job.finishedAt.Sub(job.startedAt).Milliseconds(),
+		RowCount:   len(results),
+		Status:     status,
+		ExecutedAt: job.startedAt,
+	})
+}
+
+// executeAsync runs query and collects up to cfg.AsyncMaxRows rows.
+func (s *Server) executeAsync(ctx context.Context, prepared preparedQuery) ([]string, []map[string]any, bool, *apiError) {
+	ctx, cancel := prepared.withTimeout(ctx)
+	defer cancel()
+	db, err := s.connectToDatabase(prepared.creds)
+	if err != nil {
+		_, body := classifyConnectionError(err)
+		return nil, nil, false, &body
+	}
+	q, conn, err := sessionQueryer(ctx, db, prepared.query, prepared.useDatabase, prepared.sessionVariables)
+	if err != nil {
+		_, body := classifyDBError(err)
+		return nil, nil, false, &body
+	}
+	if conn != nil {
+		defer discardConn(conn)
+	}
+
+	prepared.scan = resolveBoolColumns(ctx, q, prepared.query, prepared.scan)
+	rows, err := s.queryWithRetry(ctx, q, prepared.query, prepared.args...)
+	if err != nil {
+		_, body := classifyDBError(err)
+		return nil, nil, false, &body
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		_, body := classifyDBError(err)
+		return nil, nil, false, &body
+	}
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, prepared.scan)
+	results := []map[string]any{}
+	for rows.Next() {
+		if len(results) >= s.cfg.AsyncMaxRows {
+			return scanner.columns, results, true, nil
+		}
+		row, err := scanner.scan(rows)
+		if err != nil {
+			_, body := classifyDBError(err)
+			return nil, nil, false, &body
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		_, body := classifyDBError(err)
+		return nil, nil, false, &body
+	}
+	return scanner.columns, results, false, nil
+}
+
+// finish stores the outcome of job and posts it to the job's webhook.
+func (m *asyncJobManager) finish(job *asyncJob, columns []string, results []map[string]any, truncated bool, apiErr *apiError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.finishedAt = time.Now().UTC()
+	switch {
+	case job.status == jobCanceled || (apiErr != nil && apiErr.Code == codeCanceled):
+		job.status = jobCanceled
+	case apiErr != nil:
+		job.status, job.err = jobFailed, apiErr
+	default:
+		job.status, job.columns, job.results, job.truncated = jobSucceeded, columns, results, truncated
+	}
+
+	event := webhookEvent{
+		Event:      "async_query.finished",
+		JobID:      job.id,
+		Status:     job.status,
+		RowCount:   len(job.results),
+		FinishedAt: job.finishedAt,
+		Error:      job.err,
+		ResultsURL: m.srv.resultsURL("/queries/async/" + job.id),
+	}
+	if !job.startedAt.IsZero() {
+		event.DurationMs = job.finishedAt.Sub(job.startedAt).Milliseconds()
+	}
+	m.srv.notifyWebhook(job.webhook, job.session, event)
+}
+
+// get returns the session's job with id.
+func (m *asyncJobManager) get(session, id string) (*asyncJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.session != session {
+		return nil, errJobNotFound
+	}
+	return job, nil
+}
+
+// remove cancels the session's job with id if it is still going and
+// forgets it.
+func (m *asyncJobManager) remove(session, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.session != session {
+		return errJobNotFound
+	}
+	if !job.finished() {
+		job.status = jobCanceled
+	}
+	job.cancel()
+	delete(m.jobs, id)
+	return nil
+}
+
+// view is the JSON form of job; results are included once it succeeded.
+func (m *asyncJobManager) view(job *asyncJob) gin.H {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v := gin.H{
+		"id":         job.id,
+		"status":     job.status,
+		"query":      job.query,
+		"created_at": job.createdAt,
+	}
+	if !job.startedAt.IsZero() {
+		v["started_at"] = job.startedAt
+	}
+	if !job.finishedAt.IsZero() {
+		v["finished_at"] = job.finishedAt
+	}
+	if job.err != nil {
+		v["error"] = job.err
+	}
+	if job.webhook != nil {
+		v["webhook"] = job.webhook.redacted()
+	}
+	if job.status == jobSucceeded {
+		v["columns"] = job.columns
+		v["results"] = job.results
+		v["count"] = len(job.results)
+		v["truncated"] = job.truncated
+	}
+	return v
+}
+
+// janitor forgets jobs that finished more than cfg.AsyncJobTTL ago.
+func (m *asyncJobManager) janitor() {
+	ticker := time.NewTicker(asyncJanitorInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mu.Lock()
+		for id, job := range m.jobs {
+			if job.finished() && time.Since(job.finishedAt) > m.srv.cfg.AsyncJobTTL {
+				delete(m.jobs, id)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errTooManyJobs):
+		respondError(c, http.StatusTooManyRequests, codeTooManyJobs, err.Error())
+	case errors.Is(err, errJobNotFound):
+		respondStatusError(c, http.StatusNotFound, err)
+	default:
+		respondStatusError(c, http.StatusInternalServerError, err)
+	}
+}
+
+type asyncQueryRequest struct {
+	queryRequest
+	// Webhook is posted the outcome once the job finishes
+	Webhook *webhook `json:"webhook"`
+}
+
+// startAsyncQuery accepts the same body as /execute-query, and a webhook,
+// and returns the id of a job to poll with GET /queries/async/:id.
+func (s *Server) startAsyncQuery(c *gin.Context) {
+	var req asyncQueryRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Webhook != nil {
+		if err := req.Webhook.validate(); err != nil {
+			respondBadRequest(c, err.Error())
+			return
+		}
+	}
+	if req.Format != "" && req.Format != "json" {
+		respondBadRequest(c, "Async queries only return json results")
+		return
+	}
+
+	prepared, status, apiErr := s.prepareQuery(&req.queryRequest)
+	if apiErr != nil {
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+	job, err := s.asyncJobs.start(sessionID(c), req.Query, prepared, req.Webhook)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, s.asyncJobs.view(job))
+}
+
+func (s *Server) getAsyncQuery(c *gin.Context) {
+	job, err := s.asyncJobs.get(sessionID(c), c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s.asyncJobs.view(job))
+}
+
+func (s *Server) cancelAsyncQuery(c *gin.Context) {
+	if err := s.asyncJobs.remove(sessionID(c), c.Param("id")); err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
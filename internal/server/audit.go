@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	auditDefaultPerPage = 100
+	auditMaxPerPage     = 1000
+)
+
+// auditSchema creates the audit log. Times are RFC 3339 in UTC with a
+// fixed number of fraction digits, so they sort as text.
+const auditSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	executed_at TEXT    NOT NULL,
+	session     TEXT    NOT NULL,
+	request_id  TEXT    NOT NULL,
+	user        TEXT    NOT NULL,
+	host        TEXT    NOT NULL,
+	database    TEXT    NOT NULL,
+	query       TEXT    NOT NULL,
+	status      TEXT    NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	row_count   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_executed_at ON audit_log (executed_at);
+`
+
+const auditTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// openAudit opens, creating it when needed, the audit log at path. The
+// journal is in WAL mode so /audit reads do not block recording.
+func (s *Server) openAudit(path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	// SQLite takes one writer at a time
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(auditSchema); err != nil {
+		db.Close()
+		return err
+	}
+	s.auditDB = db
+	return nil
+}
+
+// auditEntry is one executed query as the audit log has it: the history
+// entry with the session, request and database account that ran it. It
+// never holds the password.
+type auditEntry struct {
+	historyEntry
+	Session   string `json:"session"`
+	RequestID string `json:"request_id"`
+	User      string `json:"user"`
+}
+
+// recordAudit appends entry, run by user for the session, to the audit log
+// when it is open. Like recordHistory it logs failures rather than failing
+// the query.
+func (s *Server) recordAudit(ctx context.Context, session, user string, entry historyEntry) {
+	if s.auditDB == nil {
+		return
+	}
+	_, err := s.auditDB.Exec(`INSERT INTO audit_log
+		(executed_at, session, request_id, user, host, database, query, status, duration_ms, row_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ExecutedAt.UTC().Format(auditTimeFormat), session, contextRequestID(ctx), user,
+		entry.Host, entry.Database, entry.Query, entry.Status, entry.DurationMs, entry.RowCount)
+	if err != nil {
+		logContextf(ctx, "Failed to record the query in the audit log: %s", sanitizeError(err))
+	}
+}
+
+// listAudit returns the audit log newest first, with page and per_page
+// pagination. from and to, RFC 3339 times or dates, bound executed_at,
+// to being exclusive, and user, host, database, session and status match
+// exactly.
+func (s *Server) listAudit(c *gin.Context) {
+	if !s.auditAuthorized(c) {
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		respondBadRequest(c, "page must be a positive integer")
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(auditDefaultPerPage)))
+	if err != nil || perPage < 1 || perPage > auditMaxPerPage {
+		respondBadRequest(c, "per_page must be between 1 and "+strconv.Itoa(auditMaxPerPage))
+		return
+	}
+
+	var where []string
+	var args []any
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		v := c.Query(bound.param)
+		if v == "" {
+			continue
+		}
+		t, ok := parseAuditTime(v)
+		if !ok {
+			respondBadRequest(c, bound.param+" must be an RFC 3339 time or a YYYY-MM-DD date")
+			return
+		}
+		where = append(where, "executed_at "+bound.op+" ?")
+		args = append(args, t.UTC().Format(auditTimeFormat))
+	}
+	for _, field := range []string{"user", "host", "database", "session", "status"} {
+		if v := c.Query(field); v != "" {
+			where = append(where, field+" = ?")
+			args = append(args, v)
+		}
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	ctx := c.Request.Context()
+	var total int
+	if err := s.auditDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+filter, args...).Scan(&total); err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+	rows, err := s.auditDB.QueryContext(ctx, `SELECT id, executed_at, session, request_id, user, host, database, query, status, duration_ms, row_count
+		FROM audit_log`+filter+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, perPage, (page-1)*perPage)...)
+	if err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		var executedAt string
+		err := rows.Scan(&e.ID, &executedAt, &e.Session, &e.RequestID, &e.User, &e.Host, &e.Database,
+			&e.Query, &e.Status, &e.DurationMs, &e.RowCount)
+		if err != nil {
+			respondStatusError(c, http.StatusInternalServerError, err)
+			return
+		}
+		e.ExecutedAt, _ = time.Parse(time.RFC3339Nano, executedAt)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":  entries,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+func parseAuditTime(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	return t, err == nil
+}
+
+// auditAuthorized reports whether the request may read the audit log,
+// which needs the bearer token BOBA_AUDIT_TOKEN, and responds when not.
+// Without a token set the log is written but cannot be read over HTTP.
+func (s *Server) auditAuthorized(c *gin.Context) bool {
+	if s.auditDB == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "Audit logging is disabled on this server")
+		return false
+	}
+	if s.cfg.AuditToken == "" {
+		respondError(c, http.StatusNotFound, codeNotFound, "Reading the audit log needs BOBA_AUDIT_TOKEN to be set on the server")
+		return false
+	}
+	return bearerAuthorized(c, s.cfg.AuditToken, "boba audit", "A valid audit token is required")
+}
+
+// bearerAuthorized reports whether c carries token as its bearer token,
+// responding with message for the realm when not.
+func bearerAuthorized(c *gin.Context, token, realm, message string) bool {
+	sent, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		c.Header("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, message)
+		return false
+	}
+	return true
+}
+
+// closeAudit closes the audit log, if it was opened.
+func (s *Server) closeAudit() {
+	if s.auditDB == nil {
+		return
+	}
+	if err := s.auditDB.Close(); err != nil {
+		log.Printf("Failed to close the audit log: %s", err)
+	}
+}
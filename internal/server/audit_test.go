@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// withAudit opens an audit log for s in a temporary directory.
+func withAudit(t *testing.T, s *Server) {
+	t.Helper()
+	if err := s.openAudit(filepath.Join(t.TempDir(), "audit.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.auditDB.Close() })
+}
+
+func TestExecuteBatchRecordsAudit(t *testing.T) {
+	s := newTestServer()
+	withAudit(t, s)
+	mock := withMockDB(t, s)
+	const query = "UPDATE t SET a = ? WHERE id = ?"
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare(query)
+	prep.ExpectExec().WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs(3, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := postJSON(t, s, "/api/v1/execute-batch", `{`+credentialsJSON+`,"query":"`+query+`","param_sets":[[1,2],[3,4]]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	var got, user, status string
+	var rows int
+	if err := s.auditDB.QueryRow("SELECT query, user, status, row_count FROM audit_log").Scan(&got, &user, &status, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if got != query || user != "app" || status != "success" || rows != 2 {
+		t.Errorf("audit entry = %q by %s, %s with %d rows", got, user, status, rows)
+	}
+}
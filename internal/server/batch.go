@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type executeBatchRequest struct {
+	connectionRef
+	// Query is one statement with ? placeholders, run once per parameter
+	// set
+	Query     string  `json:"query"`
+	ParamSets [][]any `json:"param_sets"`
+}
+
+// executeBatch runs one prepared statement with each of the request's
+// parameter sets, in a single transaction: either every set is applied or,
+// on the first failure, none is.
+func (s *Server) executeBatch(c *gin.Context) {
+	var req executeBatchRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !s.respondQueryLength(c, req.Query) {
+		return
+	}
+	stmts, err := analyzeStatements(req.Query)
+	if err != nil || len(stmts) != 1 {
+		respondBadRequest(c, "query must be a single statement")
+		return
+	}
+	if isReadOnlyQuery(req.Query) {
+		respondBadRequest(c, "execute-batch runs statements that change data; use /execute-query to read")
+		return
+	}
+	if len(req.ParamSets) == 0 {
+		respondBadRequest(c, "At least one parameter set is required")
+		return
+	}
+	placeholders := countPlaceholders(req.Query)
+	args := make([][]any, len(req.ParamSets))
+	for i, set := range req.ParamSets {
+		if len(set) != placeholders {
+			respondBadRequest(c, fmt.Sprintf("Parameter set %d has %d values for %d placeholders", i, len(set), placeholders))
+			return
+		}
+		args[i] = make([]any, len(set))
+		for j, val := range set {
+			if args[i][j], err = convertVariable("", val); err != nil {
+				respondBadRequest(c, fmt.Sprintf("Parameter set %d, value %d %v", i, j, err))
+				return
+			}
+		}
+	}
+	if !s.isQueryAllowed(req.Query) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+	if creds.ReadOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Statements that change data cannot run on a read-only connection")
+		return
+	}
+
+	start := time.Now()
+	var affected int64
+	defer func() { s.recordHandlerQuery(c, creds, req.Query, start, int(affected)) }()
+
+	ctx, cancel := s.withMaxTimeout(c.Request.Context(), creds)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, req.Query)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer stmt.Close()
+
+	for i, set := range args {
+		res, err := stmt.ExecContext(ctx, set...)
+		if err != nil {
+			status, body := classifyDBError(err)
+			body.Message = fmt.Sprintf("Parameter set %d: %s", i, body.Message)
+			respondAPIError(c, status, body)
+			return
+		}
+		n, _ := res.RowsAffected()
+		affected += n
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	s.resultsCache.noteWrite(sessionID(c), creds)
+
+	c.JSON(http.StatusOK, gin.H{"executed": len(args), "rows_affected": affected})
+}
+
+// countPlaceholders counts the ? placeholders of query, leaving out those
+// in string literals, quoted identifiers and comments.
+func countPlaceholders(query string) int {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, t := range tokens {
+		if t.isSymbol("?") {
+			n++
+		}
+	}
+	return n
+}
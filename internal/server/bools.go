@@ -0,0 +1,42 @@
+package server
+
+import "context"
+
+// resolveBoolColumns fills in opts.tinyintOne when opts.boolColumns is
+// set: the columns declared TINYINT(1) in the tables query reads, which is
+// what BOOL and BOOLEAN columns are. As with enumMembers, result columns
+// are matched to them by name, so one renamed by an alias stays a number.
+// It runs before the query, as q cannot be used while rows are open.
+func resolveBoolColumns(ctx context.Context, q queryer, query string, opts scanOptions) scanOptions {
+	if !opts.boolColumns || opts.booleanTinyint {
+		return opts
+	}
+	stmts, err := analyzeStatements(query)
+	if err != nil {
+		return opts
+	}
+	opts.tinyintOne = nil
+	for _, st := range stmts {
+		for _, table := range st.tables {
+			var schema any
+			if table.Schema != "" {
+				schema = table.Schema
+			}
+			rows, err := q.QueryContext(ctx,
+				"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ? AND DATA_TYPE = 'tinyint' AND COLUMN_TYPE LIKE 'tinyint(1)%'",
+				schema, table.Name)
+			if err != nil {
+				return opts
+			}
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					break
+				}
+				opts.tinyintOne = append(opts.tinyintOne, name)
+			}
+			rows.Close()
+		}
+	}
+	return opts
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBoolColumns(t *testing.T) {
+	const query = "SELECT active, level FROM users"
+	const lookup = "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ? AND DATA_TYPE = 'tinyint' AND COLUMN_TYPE LIKE 'tinyint(1)%'"
+	credentials := `{"username":"app","host":"db","port":"3306"}`
+	tests := []struct {
+		name string
+		body string
+		// lookup is whether the TINYINT(1) columns are looked up
+		lookup bool
+		want   string
+	}{
+		{"off", `{"credentials":` + credentials + `,"query":"` + query + `"}`, false,
+			`[{"active":1,"level":5},{"active":0,"level":1}]`},
+		{"request flag", `{"credentials":` + credentials + `,"query":"` + query + `","bool_columns":true}`, true,
+			`[{"active":true,"level":5},{"active":false,"level":1}]`},
+		{"connection setting", `{"credentials":{"username":"app","host":"db","port":"3306","bool_columns":true},"query":"` + query + `"}`, true,
+			`[{"active":true,"level":5},{"active":false,"level":1}]`},
+		{"every TINYINT", `{"credentials":` + credentials + `,"query":"` + query + `","booleanTinyint":true}`, false,
+			`[{"active":true,"level":true},{"active":false,"level":true}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			mock := withMockDB(t, s)
+			if tt.lookup {
+				mock.ExpectQuery(lookup).WithArgs(nil, "users").
+					WillReturnRows(mock.NewRows([]string{"COLUMN_NAME"}).AddRow("active"))
+			}
+			mock.ExpectQuery(query).WillReturnRows(mock.NewRowsWithColumnDefinition(
+				sqlmock.NewColumn("active").OfType("TINYINT", int64(0)),
+				sqlmock.NewColumn("level").OfType("TINYINT", int64(0)),
+			).AddRow(int64(1), int64(5)).AddRow(int64(0), int64(1)))
+
+			w := postJSON(t, s, "/api/v1/execute-query", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Results json.RawMessage `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.Results) != tt.want {
+				t.Errorf("results = %s, want %s", resp.Results, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoolValue(t *testing.T) {
+	for _, tt := range []struct {
+		val  any
+		want any
+	}{
+		{int64(0), false},
+		{int64(1), true},
+		{int64(-1), true},
+		{[]byte("0"), false},
+		{[]byte("1"), true},
+		{[]byte("x"), "x"},
+		{"yes", "yes"},
+	} {
+		if got := boolValue(tt.val); got != tt.want {
+			t.Errorf("boolValue(%#v) = %#v, want %#v", tt.val, got, tt.want)
+		}
+	}
+}
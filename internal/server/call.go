@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outParamPattern is the OUT parameter names a CALL may declare; each is
+// passed to the procedure as the user variable of the same name.
+var outParamPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// resultSet is one of the result sets a CALL returns.
+type resultSet struct {
+	Columns []string         `json:"columns"`
+	Results []map[string]any `json:"results"`
+	Count   int              `json:"count"`
+}
+
+// validateOutParams checks the OUT parameter names of a CALL, which must
+// pass each one as @name.
+func validateOutParams(query string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if firstKeyword(query) != "CALL" {
+		return fmt.Errorf("outParams can only be used with CALL")
+	}
+	for _, name := range names {
+		if !outParamPattern.MatchString(name) {
+			return fmt.Errorf("invalid OUT parameter name: %s", name)
+		}
+		if !regexp.MustCompile(`@` + name + `\b`).MatchString(query) {
+			return fmt.Errorf("the CALL does not pass @%s", name)
+		}
+	}
+	return nil
+}
+
+// resetOutParams clears the user variables of the OUT parameters, so a
+// procedure that never sets one does not report a value left on the
+// connection by an earlier statement.
+func resetOutParams(ctx context.Context, q queryer, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	assignments := make([]string, len(names))
+	for i, name := range names {
+		assignments[i] = "@" + name + " = NULL"
+	}
+	_, err := q.ExecContext(ctx, "SET "+strings.Join(assignments, ", "))
+	return err
+}
+
+// readOutParams reads the OUT parameters back once the CALL is done. It
+// must run on the connection the CALL ran on.
+func readOutParams(ctx context.Context, q queryer, names []string) (map[string]any, error) {
+	selects := make([]string, len(names))
+	for i, name := range names {
+		selects[i] = "@" + name + " AS " + quoteIdent(name)
+	}
+	rows, err := q.QueryContext(ctx, "SELECT "+strings.Join(selects, ", "))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	scanner := newRowScanner(names)
+	params := map[string]any{}
+	if rows.Next() {
+		if params, err = scanner.scan(rows); err != nil {
+			return nil, err
+		}
+	}
+	return params, rows.Err()
+}
+
+// scanResultSets reads the result sets after the current one, for
+// procedures that return several.
+func scanResultSets(c *gin.Context, rows *sql.Rows, opts scanOptions) ([]resultSet, error) {
+	var sets []resultSet
+	for rows.NextResultSet() {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		scanner := newRowScanner(columns)
+		scanner.useColumnTypes(rows, opts)
+		set := resultSet{Columns: scanner.columns, Results: []map[string]any{}}
+		for rows.Next() {
+			touchRunningQuery(c)
+			row, err := scanner.scan(rows)
+			if err != nil {
+				return nil, err
+			}
+			set.Results = append(set.Results, row)
+		}
+		set.Count = len(set.Results)
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const codeColumnMismatch = "column_mismatch"
+
+// compareSide is one of the queries /compare runs, with its connection.
+type compareSide struct {
+	connectionRef
+	Query string `json:"query"`
+}
+
+type compareRequest struct {
+	A compareSide `json:"a"`
+	B compareSide `json:"b"`
+	// Key are the columns that identify a row in both results
+	Key []string `json:"key"`
+	// MaxRows lowers cfg.CompareMaxRows, the most rows read from each side
+	MaxRows int `json:"max_rows"`
+}
+
+// columnDiff is a value that differs between the two sides.
+type columnDiff struct {
+	A any `json:"a"`
+	B any `json:"b"`
+}
+
+type differingRow struct {
+	Key     any                   `json:"key"`
+	Columns map[string]columnDiff `json:"columns"`
+}
+
+// compareQueries runs two read-only queries, on two connections or one,
+// at the same time, and reports the rows only one result has and the
+// columns that differ in the rows both have, matched by the key columns.
+// Values are compared as /diff compares them. Both results must have the
+// same columns; comparing is bounded by cfg.CompareMaxRows a side, and a
+// larger result is refused rather than compared in part.
+func (s *Server) compareQueries(c *gin.Context) {
+	var req compareRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.A.Query == "" || req.B.Query == "" {
+		respondBadRequest(c, "a.query and b.query are required")
+		return
+	}
+	if !s.respondQueryLength(c, req.A.Query, req.B.Query) {
+		return
+	}
+	if len(req.Key) == 0 {
+		respondBadRequest(c, "At least one key column is required")
+		return
+	}
+	limit := s.cfg.CompareMaxRows
+	if req.MaxRows < 0 || req.MaxRows > limit {
+		respondBadRequest(c, fmt.Sprintf("max_rows must be between 1 and %d", limit))
+		return
+	}
+	if req.MaxRows > 0 {
+		limit = req.MaxRows
+	}
+	for _, side := range []compareSide{req.A, req.B} {
+		if !isReadOnlyQuery(side.Query) {
+			respondError(c, http.StatusForbidden, codeReadOnly, "Only read-only statements can be compared")
+			return
+		}
+		if !s.isQueryAllowed(side.Query) {
+			respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	var (
+		wg      sync.WaitGroup
+		sides   [2]*diffSide
+		status  [2]int
+		apiErrs [2]*apiError
+	)
+	for i, side := range []compareSide{req.A, req.B} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sides[i], status[i], apiErrs[i] = s.readDiffSide(ctx, side.connectionRef, side.Query, req.Key, limit)
+		}()
+	}
+	wg.Wait()
+	for i, name := range []string{"a", "b"} {
+		if apiErrs[i] != nil {
+			apiErrs[i].Message = name + ": " + apiErrs[i].Message
+			respondAPIError(c, status[i], *apiErrs[i])
+			return
+		}
+	}
+	a, b := sides[0], sides[1]
+
+	onlyA, onlyB := missingColumns(a.columns, b.columns), missingColumns(b.columns, a.columns)
+	if len(onlyA) > 0 || len(onlyB) > 0 {
+		var detail []string
+		if len(onlyA) > 0 {
+			detail = append(detail, "only in a: "+strings.Join(onlyA, ", "))
+		}
+		if len(onlyB) > 0 {
+			detail = append(detail, "only in b: "+strings.Join(onlyB, ", "))
+		}
+		respondAPIError(c, http.StatusUnprocessableEntity, apiError{
+			Code:    codeColumnMismatch,
+			Message: "The two results have different columns",
+			Detail:  strings.Join(detail, "; "),
+		})
+		return
+	}
+
+	onlyInA := []map[string]any{}
+	differing := []differingRow{}
+	matching := 0
+	for i, key := range a.keys {
+		row := a.rows[i]
+		other, ok := b.byKey[key]
+		if !ok {
+			onlyInA = append(onlyInA, row)
+			continue
+		}
+		diffs := map[string]columnDiff{}
+		for _, col := range a.columns {
+			if normalizeDiffValue(row[col]) != normalizeDiffValue(other[col]) {
+				diffs[col] = columnDiff{A: row[col], B: other[col]}
+			}
+		}
+		if len(diffs) == 0 {
+			matching++
+			continue
+		}
+		differing = append(differing, differingRow{Key: keyValues(row, req.Key), Columns: diffs})
+	}
+	onlyInB := []map[string]any{}
+	for i, key := range b.keys {
+		if _, ok := a.byKey[key]; !ok {
+			onlyInB = append(onlyInB, b.rows[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":       req.Key,
+		"columns":   a.columns,
+		"a_count":   len(a.rows),
+		"b_count":   len(b.rows),
+		"matching":  matching,
+		"only_in_a": onlyInA,
+		"only_in_b": onlyInB,
+		"differing": differing,
+	})
+}
+
+// missingColumns returns the columns of have that other lacks.
+func missingColumns(have, other []string) []string {
+	var missing []string
+	for _, col := range have {
+		if !slices.Contains(other, col) {
+			missing = append(missing, col)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queriesInFlight and queriesQueued count the queries holding a query
+// slot and waiting for one, across the servers of the process.
+var (
+	queriesInFlight = expvar.NewInt("queriesInFlight")
+	queriesQueued   = expvar.NewInt("queriesQueued")
+)
+
+var (
+	errQueryLimit   = errors.New("too many queries are running")
+	errQueueTimeout = errors.New("no query slot came free in time")
+)
+
+// queryLimiter caps the queries run at once at cfg.QueryMaxConcurrent in
+// all and cfg.QueryMaxPerSession for each session.
+type queryLimiter struct {
+	cfg      *config
+	mu       sync.Mutex
+	once     sync.Once
+	global   chan struct{}
+	sessions map[string]*sessionSlots
+}
+
+// sessionSlots are the slots of one session, dropped once no request of
+// the session holds or waits for one.
+type sessionSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+// acquire takes a slot of session and a global one. Without wait it fails
+// with errQueryLimit when either is full; with it, it waits for up to
+// cfg.QueryQueueTimeout, failing with errQueueTimeout, or until ctx is
+// done. It returns how long it waited and the func that frees the slots,
+// which may be called more than once; defer it so a panic frees them too.
+func (l *queryLimiter) acquire(ctx context.Context, session string, wait bool) (release func(), waited time.Duration, err error) {
+	l.once.Do(func() { l.global = make(chan struct{}, l.cfg.QueryMaxConcurrent) })
+
+	l.mu.Lock()
+	s := l.sessions[session]
+	if s == nil {
+		s = &sessionSlots{slots: make(chan struct{}, l.cfg.QueryMaxPerSession)}
+		l.sessions[session] = s
+	}
+	s.refs++
+	l.mu.Unlock()
+	unref := func() {
+		l.mu.Lock()
+		if s.refs--; s.refs == 0 {
+			delete(l.sessions, session)
+		}
+		l.mu.Unlock()
+	}
+
+	start := time.Now()
+	// The session's slot first, so one session's queue does not hold
+	// global slots
+	if err := l.takeSlot(ctx, s.slots, wait, start); err != nil {
+		unref()
+		return nil, time.Since(start), err
+	}
+	if err := l.takeSlot(ctx, l.global, wait, start); err != nil {
+		<-s.slots
+		unref()
+		return nil, time.Since(start), err
+	}
+	queriesInFlight.Add(1)
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			<-l.global
+			<-s.slots
+			unref()
+			queriesInFlight.Add(-1)
+		})
+	}
+	return release, time.Since(start), nil
+}
+
+// takeSlot puts a token in slots, waiting, when wait is set, until
+// cfg.QueryQueueTimeout after start.
+func (l *queryLimiter) takeSlot(ctx context.Context, slots chan struct{}, wait bool, start time.Time) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if !wait {
+		return errQueryLimit
+	}
+	queriesQueued.Add(1)
+	defer queriesQueued.Add(-1)
+	timer := time.NewTimer(l.cfg.QueryQueueTimeout - time.Since(start))
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return errQueueTimeout
+	}
+}
+
+// queryLimitError is the status and body reporting a failure of
+// queryLimiter.acquire.
+func (s *Server) queryLimitError(err error) (int, apiError) {
+	switch {
+	case errors.Is(err, errQueryLimit):
+		return http.StatusTooManyRequests, apiError{Code: codeTooManyQueries, Message: "Too many queries are running; try again shortly or send queue: true to wait"}
+	case errors.Is(err, errQueueTimeout):
+		return http.StatusTooManyRequests, apiError{Code: codeTooManyQueries, Message: fmt.Sprintf("No query slot came free within %s", s.cfg.QueryQueueTimeout)}
+	default:
+		return classifyDBError(err)
+	}
+}
+
+// respondQueryLimitError reports a failure of queryLimiter.acquire.
+func (s *Server) respondQueryLimitError(c *gin.Context, err error) {
+	status, body := s.queryLimitError(err)
+	if body.Code == codeTooManyQueries {
+		c.Header("Retry-After", "1")
+	}
+	respondAPIError(c, status, body)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newFullServer returns a server with a single query slot, taken by
+// another session until the test ends.
+func newFullServer(t *testing.T) *Server {
+	t.Helper()
+	s := newTestServer(func(c *config) {
+		c.QueryMaxConcurrent = 1
+		c.QueryQueueTimeout = 20 * time.Millisecond
+		c.DefaultCredentials = &dbCredentials{Username: "app", Host: "db", Port: "3306"}
+	})
+	release, _, err := s.queryLimits.acquire(context.Background(), "other", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(release)
+	return s
+}
+
+func TestQueryLimitsCoverEveryQueryPath(t *testing.T) {
+	s := newFullServer(t)
+	r := s.Handler()
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	for _, tt := range []struct{ name, method, path, body string }{
+		{"query", http.MethodPost, "/api/v1/execute-query", `{"query":"SELECT 1","queue":false}`},
+		{"events", http.MethodPost, "/api/v1/execute-query/events", `{"query":"SELECT 1","queue":false}`},
+		{"queued events", http.MethodPost, "/api/v1/execute-query/events", `{"query":"SELECT 1"}`},
+		{"stream", http.MethodGet, "/api/v1/execute-query/stream?query=SELECT+1", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.method, tt.path, tt.body)
+			if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), codeTooManyQueries) {
+				t.Errorf("status %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	t.Run("async", func(t *testing.T) {
+		w := serve(http.MethodPost, "/api/v1/queries/async", `{"query":"SELECT 1"}`)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var started struct{ ID string }
+		json.Unmarshal(w.Body.Bytes(), &started)
+		s.asyncJobs.mu.Lock()
+		job := s.asyncJobs.jobs[started.ID]
+		s.asyncJobs.mu.Unlock()
+		if job == nil {
+			t.Fatalf("no job %q", started.ID)
+		}
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+			v := s.asyncJobs.view(job)
+			if v["status"] == jobFailed {
+				if body, _ := v["error"].(*apiError); body == nil || body.Code != codeTooManyQueries {
+					t.Errorf("error = %v", v["error"])
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job = %v", v)
+			}
+		}
+	})
+
+	t.Run("websocket", func(t *testing.T) {
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/ws/query", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.WriteJSON(queryRequest{Query: "SELECT 1"})
+		var msg struct {
+			Type  string
+			Error apiError
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "error" || msg.Error.Code != codeTooManyQueries {
+			t.Errorf("message = %+v", msg)
+		}
+	})
+}
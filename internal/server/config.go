@@ -0,0 +1,564 @@
+package server
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds server-wide settings. They are read once at startup from
+// BOBA_* environment variables.
+type config struct {
+	// RetryAttempts is the total number of tries for operations that fail
+	// with a transient error; 1 disables retrying.
+	RetryAttempts int
+	// RetryBackoff is the delay before the first retry, doubled after each
+	// further attempt.
+	RetryBackoff time.Duration
+	// BasePath is the prefix all routes are mounted under, such as /boba
+	// when served from a subpath behind a proxy; "" for the root.
+	BasePath string
+	// PublicURL is the scheme and host clients reach the server at, such
+	// as https://boba.example.com, for links sent outside a request, as in
+	// webhooks; those links are paths only when it is unset.
+	PublicURL string
+	// Connections are the named server-side connections loaded from
+	// BOBA_CONNECTIONS_FILE, keyed by name.
+	Connections map[string]dbCredentials
+	// DefaultCredentials are used by requests that name no database, read
+	// from the BOBA_DB_* variables; nil when neither BOBA_DB_HOST nor
+	// BOBA_DB_SOCKET is set.
+	DefaultCredentials *dbCredentials
+	// DataFile is the bbolt file holding profiles and other saved state
+	DataFile string
+	// StaticDir serves the UI from a directory instead of the copy built
+	// into the binary, for working on it without rebuilding; from
+	// BOBA_STATIC_DIR or --static-dir
+	StaticDir string
+	// EnablePprof serves the /debug/pprof profiles and /debug/stats; set
+	// with --enable-pprof
+	EnablePprof bool
+	// SecretKey encrypts stored passwords; derived from BOBA_SECRET_KEY and
+	// nil when that is unset.
+	SecretKey []byte
+	// HistoryEnabled records executed queries per session; turn it off with
+	// BOBA_HISTORY=false for privacy-sensitive deployments.
+	HistoryEnabled bool
+	// HistoryLimit is the number of entries kept per session
+	HistoryLimit int
+	// AuditDB is the SQLite file every executed query is also logged to,
+	// from BOBA_AUDIT_DB; "" turns the audit log off
+	AuditDB string
+	// AuditToken is the bearer token GET /audit needs, from
+	// BOBA_AUDIT_TOKEN; the endpoint is off without one
+	AuditToken string
+	// MaintenanceToken, from BOBA_MAINTENANCE_TOKEN, is the bearer token
+	// table maintenance needs when set
+	MaintenanceToken string
+	// TLSCertDir is the directory the ca_cert, client_cert and client_key
+	// of a connection may name files in, from BOBA_TLS_CERT_DIR; without
+	// it they must hold the PEM data itself
+	TLSCertDir string
+	// XLSXMaxRows caps the rows of an xlsx export, at most the sheet size;
+	// longer results are truncated
+	XLSXMaxRows int
+	// TableCellWidth is the width, in characters, at which markdown and
+	// ascii result cells are cut with an ellipsis
+	TableCellWidth int
+	// LintDisabled turns off individual lint checks, set from the
+	// comma-separated names in BOBA_LINT_DISABLE
+	LintDisabled map[string]bool
+	// LintLargeTableRows is the estimated row count above which SELECT *
+	// and ORDER BY without LIMIT are flagged
+	LintLargeTableRows int
+	// ExpensiveQueryRows is the EXPLAIN row estimate above which a query
+	// sent with confirm_if_expensive needs confirming
+	ExpensiveQueryRows int
+	// AsyncMaxConcurrent is the number of async queries run at once; more
+	// wait in a queue
+	AsyncMaxConcurrent int
+	// QueryMaxConcurrent and QueryMaxPerSession cap the queries run at
+	// once in all and by one session, from /execute-query, its event
+	// streams, the websockets and async jobs; more wait in a queue for up
+	// to QueryQueueTimeout
+	QueryMaxConcurrent int
+	QueryMaxPerSession int
+	QueryQueueTimeout  time.Duration
+	// AsyncMaxJobs caps the unfinished async queries per session
+	AsyncMaxJobs int
+	// AsyncMaxRows caps the rows kept for an async query's result
+	AsyncMaxRows int
+	// AsyncJobTTL is how long finished async queries are kept for polling
+	AsyncJobTTL time.Duration
+	// GzipEnabled compresses responses for clients that accept gzip
+	GzipEnabled bool
+	// GzipMinSize is the response size in bytes below which responses are
+	// sent uncompressed
+	GzipMinSize int
+	// GzipLevel is the compress/gzip level, from 1 (fastest) to 9 (best),
+	// or -1 for the library default
+	GzipLevel int
+	// MaxBodyBytes caps the size of request bodies; set with BOBA_MAX_BODY
+	// as a byte count or with a KB, MB or GB suffix
+	MaxBodyBytes int64
+	// MaxUploadBytes caps file uploads such as CSV imports; set with
+	// BOBA_MAX_UPLOAD like BOBA_MAX_BODY
+	MaxUploadBytes int64
+	// MaxQueryLength caps the length of a query in bytes; set with
+	// BOBA_MAX_QUERY_LENGTH like BOBA_MAX_BODY
+	MaxQueryLength int64
+	// IdleTimeout is how long a running query may go without producing a
+	// row before it is cancelled. Set with BOBA_IDLE_TIMEOUT, it is also
+	// the default for CursorIdleTimeout and StickyIdleTimeout, and how
+	// long a connection pool goes unused before it is closed.
+	IdleTimeout time.Duration
+	// PoolHeartbeat is how often each connection pool is pinged, which
+	// should be well below the server's wait_timeout; zero disables it
+	PoolHeartbeat time.Duration
+	// PoolConnMaxLifetime is how long a pooled connection is reused before
+	// it is replaced
+	PoolConnMaxLifetime time.Duration
+	// CursorIdleTimeout is how long a paged result stays open between
+	// requests for its next page
+	CursorIdleTimeout time.Duration
+	// CursorMaxOpen caps the open paged results per session
+	CursorMaxOpen int
+	// StickyIdleTimeout is how long a sticky login's connection stays open
+	// without queries or keep-alive pings
+	StickyIdleTimeout time.Duration
+	// InsertBatchSize is the most rows /tables/insert puts in one INSERT
+	InsertBatchSize int
+	// ResultCacheBytes caps the size of the results the result cache holds;
+	// set with BOBA_RESULT_CACHE_SIZE like BOBA_MAX_BODY, zero disables it
+	ResultCacheBytes int64
+	// SnapshotMaxBytes caps the size of a result snapshot, set with
+	// BOBA_SNAPSHOT_MAX_SIZE like BOBA_MAX_BODY
+	SnapshotMaxBytes int64
+	// CompareMaxRows is the most rows /compare reads from each side
+	CompareMaxRows int
+	// MaxQueryTimeout caps the timeout_seconds of queries and applies to
+	// queries that set none, and to endpoints that take no timeout; zero
+	// leaves them unlimited
+	MaxQueryTimeout time.Duration
+	// AllowKill enables /server/kill, which is off by default as it can
+	// end other users' connections
+	AllowKill bool
+	// AllowMaintenance enables OPTIMIZE, ANALYZE and CHECK TABLE through
+	// /maintenance
+	AllowMaintenance bool
+	// QueryAllow and QueryBlock are the patterns from BOBA_QUERY_ALLOW and
+	// BOBA_QUERY_BLOCK, one per line. A query must match one allow pattern,
+	// when any are set, and no block pattern.
+	QueryAllow []*regexp.Regexp
+	QueryBlock []*regexp.Regexp
+	// TraceStatements puts the raw SQL of queries in their trace spans,
+	// rather than a fingerprint with the literals replaced; set with
+	// BOBA_TRACE_STATEMENTS
+	TraceStatements bool
+}
+
+func defaultConfig() *config {
+	return &config{
+		RetryAttempts:  3,
+		RetryBackoff:   100 * time.Millisecond,
+		Connections:    map[string]dbCredentials{},
+		DataFile:       "boba.db",
+		HistoryEnabled: true,
+		HistoryLimit:   500,
+		XLSXMaxRows:    xlsxMaxRows - 1,
+		LintDisabled:   map[string]bool{},
+		TableCellWidth: 50,
+
+		LintLargeTableRows: 100000,
+		ExpensiveQueryRows: 1000000,
+		AsyncMaxConcurrent: 4,
+		QueryMaxConcurrent: 10,
+		QueryMaxPerSession: 3,
+		QueryQueueTimeout:  30 * time.Second,
+		AsyncMaxJobs:       10,
+		AsyncMaxRows:       10000,
+		AsyncJobTTL:        time.Hour,
+		GzipEnabled:        true,
+		GzipMinSize:        1024,
+		GzipLevel:          gzip.DefaultCompression,
+		MaxBodyBytes:       10 << 20,
+		MaxUploadBytes:     100 << 20,
+		MaxQueryLength:     1 << 20,
+		IdleTimeout:        30 * time.Minute,
+		CursorIdleTimeout:  5 * time.Minute,
+		CursorMaxOpen:      5,
+		StickyIdleTimeout:  10 * time.Minute,
+		InsertBatchSize:    importBatchSize,
+		ResultCacheBytes:   64 << 20,
+		SnapshotMaxBytes:   5 << 20,
+		CompareMaxRows:     diffMaxRows,
+		AllowMaintenance:   true,
+
+		PoolHeartbeat:       time.Minute,
+		PoolConnMaxLifetime: 5 * time.Minute,
+	}
+}
+
+// parseFlags applies the command-line flags, which override the settings
+// of the environment.
+func (c *config) parseFlags(args []string) error {
+	flags := flag.NewFlagSet("boba", flag.ContinueOnError)
+	flags.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "serve the UI from `dir` instead of the copy built into the binary")
+	flags.BoolVar(&c.EnablePprof, "enable-pprof", c.EnablePprof, "serve the runtime profiles at /debug/pprof and runtime stats at /debug/stats")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if c.StaticDir != "" {
+		if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("--static-dir %s is not a directory", c.StaticDir)
+		}
+	}
+	return nil
+}
+
+func loadConfig() (*config, error) {
+	c := defaultConfig()
+
+	var err error
+	if c.RetryAttempts, err = envInt("BOBA_RETRY_ATTEMPTS", c.RetryAttempts); err != nil {
+		return nil, err
+	}
+	if c.RetryAttempts < 1 {
+		return nil, fmt.Errorf("BOBA_RETRY_ATTEMPTS must be at least 1")
+	}
+	if c.RetryBackoff, err = envDuration("BOBA_RETRY_BACKOFF", c.RetryBackoff); err != nil {
+		return nil, err
+	}
+
+	if c.BasePath, err = basePath(os.Getenv("BOBA_BASE_PATH")); err != nil {
+		return nil, err
+	}
+	if c.PublicURL, err = publicURL(os.Getenv("BOBA_PUBLIC_URL")); err != nil {
+		return nil, err
+	}
+
+	if path := os.Getenv("BOBA_CONNECTIONS_FILE"); path != "" {
+		if c.Connections, err = loadConnections(path); err != nil {
+			return nil, fmt.Errorf("BOBA_CONNECTIONS_FILE: %w", err)
+		}
+	}
+
+	if c.DefaultCredentials, err = envCredentials(); err != nil {
+		return nil, err
+	}
+
+	if path := os.Getenv("BOBA_DATA_FILE"); path != "" {
+		c.DataFile = path
+	}
+	c.StaticDir = os.Getenv("BOBA_STATIC_DIR")
+	if key := os.Getenv("BOBA_SECRET_KEY"); key != "" {
+		c.SecretKey = deriveSecretKey(key)
+	}
+	if c.HistoryEnabled, err = envBool("BOBA_HISTORY", c.HistoryEnabled); err != nil {
+		return nil, err
+	}
+	if c.HistoryLimit, err = envInt("BOBA_HISTORY_LIMIT", c.HistoryLimit); err != nil {
+		return nil, err
+	}
+	if c.HistoryLimit < 1 {
+		return nil, fmt.Errorf("BOBA_HISTORY_LIMIT must be at least 1")
+	}
+	c.AuditDB = os.Getenv("BOBA_AUDIT_DB")
+	c.AuditToken = os.Getenv("BOBA_AUDIT_TOKEN")
+	c.MaintenanceToken = os.Getenv("BOBA_MAINTENANCE_TOKEN")
+	c.TLSCertDir = os.Getenv("BOBA_TLS_CERT_DIR")
+
+	if c.XLSXMaxRows, err = envInt("BOBA_XLSX_MAX_ROWS", c.XLSXMaxRows); err != nil {
+		return nil, err
+	}
+	if c.XLSXMaxRows < 1 || c.XLSXMaxRows >= xlsxMaxRows {
+		return nil, fmt.Errorf("BOBA_XLSX_MAX_ROWS must be between 1 and %d", xlsxMaxRows-1)
+	}
+
+	if c.TableCellWidth, err = envInt("BOBA_TABLE_CELL_WIDTH", c.TableCellWidth); err != nil {
+		return nil, err
+	}
+	if c.TableCellWidth < 2 {
+		return nil, fmt.Errorf("BOBA_TABLE_CELL_WIDTH must be at least 2")
+	}
+
+	for _, check := range strings.Split(os.Getenv("BOBA_LINT_DISABLE"), ",") {
+		if check = strings.TrimSpace(check); check == "" {
+			continue
+		}
+		if !slices.Contains(lintChecks, check) {
+			return nil, fmt.Errorf("BOBA_LINT_DISABLE: unknown check %q", check)
+		}
+		c.LintDisabled[check] = true
+	}
+	if c.LintLargeTableRows, err = envInt("BOBA_LINT_LARGE_TABLE_ROWS", c.LintLargeTableRows); err != nil {
+		return nil, err
+	}
+	if c.ExpensiveQueryRows, err = envInt("BOBA_EXPENSIVE_QUERY_ROWS", c.ExpensiveQueryRows); err != nil {
+		return nil, err
+	}
+
+	if c.AsyncMaxConcurrent, err = envInt("BOBA_ASYNC_MAX_CONCURRENT", c.AsyncMaxConcurrent); err != nil {
+		return nil, err
+	}
+	if c.AsyncMaxConcurrent < 1 {
+		return nil, fmt.Errorf("BOBA_ASYNC_MAX_CONCURRENT must be at least 1")
+	}
+	if c.QueryMaxConcurrent, err = envInt("BOBA_QUERY_MAX_CONCURRENT", c.QueryMaxConcurrent); err != nil {
+		return nil, err
+	}
+	if c.QueryMaxConcurrent < 1 {
+		return nil, fmt.Errorf("BOBA_QUERY_MAX_CONCURRENT must be at least 1")
+	}
+	if c.QueryMaxPerSession, err = envInt("BOBA_QUERY_MAX_PER_SESSION", c.QueryMaxPerSession); err != nil {
+		return nil, err
+	}
+	if c.QueryMaxPerSession < 1 {
+		return nil, fmt.Errorf("BOBA_QUERY_MAX_PER_SESSION must be at least 1")
+	}
+	if c.QueryQueueTimeout, err = envDuration("BOBA_QUERY_QUEUE_TIMEOUT", c.QueryQueueTimeout); err != nil {
+		return nil, err
+	}
+	if c.AsyncMaxJobs, err = envInt("BOBA_ASYNC_MAX_JOBS", c.AsyncMaxJobs); err != nil {
+		return nil, err
+	}
+	if c.AsyncMaxRows, err = envInt("BOBA_ASYNC_MAX_ROWS", c.AsyncMaxRows); err != nil {
+		return nil, err
+	}
+	if c.AsyncJobTTL, err = envDuration("BOBA_ASYNC_JOB_TTL", c.AsyncJobTTL); err != nil {
+		return nil, err
+	}
+
+	if c.GzipEnabled, err = envBool("BOBA_GZIP", c.GzipEnabled); err != nil {
+		return nil, err
+	}
+	if c.GzipMinSize, err = envInt("BOBA_GZIP_MIN_SIZE", c.GzipMinSize); err != nil {
+		return nil, err
+	}
+	if c.GzipLevel, err = envInt("BOBA_GZIP_LEVEL", c.GzipLevel); err != nil {
+		return nil, err
+	}
+	if c.GzipLevel < gzip.DefaultCompression || c.GzipLevel > gzip.BestCompression {
+		return nil, fmt.Errorf("BOBA_GZIP_LEVEL must be between -1 and 9")
+	}
+	if c.MaxBodyBytes, err = envBytes("BOBA_MAX_BODY", c.MaxBodyBytes); err != nil {
+		return nil, err
+	}
+	if c.MaxBodyBytes < 1 {
+		return nil, fmt.Errorf("BOBA_MAX_BODY must be positive")
+	}
+	if c.MaxUploadBytes, err = envBytes("BOBA_MAX_UPLOAD", c.MaxUploadBytes); err != nil {
+		return nil, err
+	}
+	if c.MaxUploadBytes < 1 {
+		return nil, fmt.Errorf("BOBA_MAX_UPLOAD must be positive")
+	}
+	if c.MaxQueryLength, err = envBytes("BOBA_MAX_QUERY_LENGTH", c.MaxQueryLength); err != nil {
+		return nil, err
+	}
+	if c.MaxQueryLength < 1 {
+		return nil, fmt.Errorf("BOBA_MAX_QUERY_LENGTH must be positive")
+	}
+
+	if c.IdleTimeout, err = envDuration("BOBA_IDLE_TIMEOUT", c.IdleTimeout); err != nil {
+		return nil, err
+	}
+	if os.Getenv("BOBA_IDLE_TIMEOUT") != "" {
+		c.CursorIdleTimeout = c.IdleTimeout
+		c.StickyIdleTimeout = c.IdleTimeout
+	}
+	if c.PoolHeartbeat, err = envDuration("BOBA_POOL_HEARTBEAT", c.PoolHeartbeat); err != nil {
+		return nil, err
+	}
+	if c.PoolConnMaxLifetime, err = envDuration("BOBA_POOL_CONN_MAX_LIFETIME", c.PoolConnMaxLifetime); err != nil {
+		return nil, err
+	}
+	if c.CursorIdleTimeout, err = envDuration("BOBA_CURSOR_IDLE_TIMEOUT", c.CursorIdleTimeout); err != nil {
+		return nil, err
+	}
+	if c.CursorMaxOpen, err = envInt("BOBA_CURSOR_MAX_OPEN", c.CursorMaxOpen); err != nil {
+		return nil, err
+	}
+	if c.StickyIdleTimeout, err = envDuration("BOBA_STICKY_IDLE_TIMEOUT", c.StickyIdleTimeout); err != nil {
+		return nil, err
+	}
+	if c.InsertBatchSize, err = envInt("BOBA_INSERT_BATCH_SIZE", c.InsertBatchSize); err != nil {
+		return nil, err
+	}
+	if c.InsertBatchSize < 1 {
+		return nil, fmt.Errorf("BOBA_INSERT_BATCH_SIZE must be positive")
+	}
+	if c.ResultCacheBytes, err = envBytes("BOBA_RESULT_CACHE_SIZE", c.ResultCacheBytes); err != nil {
+		return nil, err
+	}
+	if c.SnapshotMaxBytes, err = envBytes("BOBA_SNAPSHOT_MAX_SIZE", c.SnapshotMaxBytes); err != nil {
+		return nil, err
+	}
+	if c.CompareMaxRows, err = envInt("BOBA_COMPARE_MAX_ROWS", c.CompareMaxRows); err != nil {
+		return nil, err
+	}
+	if c.CompareMaxRows < 1 {
+		return nil, fmt.Errorf("BOBA_COMPARE_MAX_ROWS must be positive")
+	}
+	if c.MaxQueryTimeout, err = envDuration("BOBA_MAX_QUERY_TIMEOUT", c.MaxQueryTimeout); err != nil {
+		return nil, err
+	}
+
+	if c.AllowKill, err = envBool("BOBA_ALLOW_KILL", c.AllowKill); err != nil {
+		return nil, err
+	}
+	if c.AllowMaintenance, err = envBool("BOBA_ALLOW_MAINTENANCE", c.AllowMaintenance); err != nil {
+		return nil, err
+	}
+
+	if c.TraceStatements, err = envBool("BOBA_TRACE_STATEMENTS", c.TraceStatements); err != nil {
+		return nil, err
+	}
+
+	if c.QueryAllow, err = envPatterns("BOBA_QUERY_ALLOW"); err != nil {
+		return nil, err
+	}
+	if c.QueryBlock, err = envPatterns("BOBA_QUERY_BLOCK"); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// basePath normalizes BOBA_BASE_PATH to a leading slash and no trailing
+// one, so "boba/" becomes "/boba" and "/" becomes "".
+func basePath(v string) (string, error) {
+	path := strings.Trim(strings.TrimSpace(v), "/")
+	if path == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(path, ":*?#") {
+		return "", fmt.Errorf("invalid BOBA_BASE_PATH %q", v)
+	}
+	return "/" + path, nil
+}
+
+// publicURL checks BOBA_PUBLIC_URL is an http or https URL, and drops a
+// trailing slash.
+func publicURL(v string) (string, error) {
+	v = strings.TrimRight(strings.TrimSpace(v), "/")
+	if v == "" {
+		return "", nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid BOBA_PUBLIC_URL %q", v)
+	}
+	return v, nil
+}
+
+// envCredentials reads the default database from BOBA_DB_HOST, _PORT,
+// _USER, _PASSWORD, _NAME, _SOCKET and _READ_ONLY.
+func envCredentials() (*dbCredentials, error) {
+	creds := dbCredentials{
+		Host:     os.Getenv("BOBA_DB_HOST"),
+		Port:     os.Getenv("BOBA_DB_PORT"),
+		Username: os.Getenv("BOBA_DB_USER"),
+		Password: os.Getenv("BOBA_DB_PASSWORD"),
+		Database: os.Getenv("BOBA_DB_NAME"),
+		Socket:   os.Getenv("BOBA_DB_SOCKET"),
+	}
+	if creds.Host == "" && creds.Socket == "" {
+		return nil, nil
+	}
+	if creds.Port == "" {
+		creds.Port = "3306"
+	}
+	var err error
+	if creds.ReadOnly, err = envBool("BOBA_DB_READ_ONLY", false); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+func envInt(name string, def int) (int, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+func envBool(name string, def bool) (bool, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// byteUnits are the suffixes accepted by envBytes, longest first.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}}
+
+// envBytes parses a size such as "1048576", "512KB" or "10MB".
+func envBytes(name string, def int64) (int64, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return def, nil
+	}
+	num, unit := strings.ToUpper(strings.TrimSpace(v)), int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(num, u.suffix) {
+			num, unit = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q is not a size", name, v)
+	}
+	return n * unit, nil
+}
+
+// envPatterns compiles the regular expressions in name, one per line, so
+// patterns are free to contain commas. Blank lines are ignored.
+func envPatterns(name string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, line := range strings.Split(os.Getenv(name), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// envDuration parses a Go duration string such as "250ms" or "1m".
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
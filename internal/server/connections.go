@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errConnectionNotFound is returned for a named connection that is not
+// defined in the connections file.
+var errConnectionNotFound = errors.New("unknown connection")
+
+// loadConnections reads the named connections file, a JSON object mapping
+// connection names to credentials:
+//
+//	{"prod-replica": {"username": "app", "password": "...", "host": "10.0.0.5",
+//	                  "port": "3306", "database": "shop", "read_only": true}}
+func loadConnections(path string) (map[string]dbCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections map[string]dbCredentials
+	if err := json.Unmarshal(data, &connections); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name := range connections {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("parse %s: connection names cannot be empty", path)
+		}
+	}
+	return connections, nil
+}
+
+// resolveCredentials picks the credentials for a request, which may embed
+// them, name a server-side connection or reference a saved profile, but
+// only one of those. A request with none of them uses the default
+// credentials, if configured. The returned status is meaningful only when
+// err is non-nil.
+func (s *Server) resolveCredentials(ref connectionRef) (dbCredentials, int, error) {
+	sources := 0
+	for _, set := range []bool{!ref.Credentials.isZero(), ref.Connection != "", ref.ProfileID != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return dbCredentials{}, http.StatusBadRequest, errors.New("provide only one of credentials, connection or profileId")
+	}
+
+	switch {
+	case ref.Connection != "":
+		creds, ok := s.cfg.Connections[ref.Connection]
+		if !ok {
+			return dbCredentials{}, http.StatusNotFound, fmt.Errorf("%w: %s", errConnectionNotFound, ref.Connection)
+		}
+		return creds, 0, nil
+	case ref.ProfileID != "":
+		creds, err := s.profileCredentials(ref.ProfileID)
+		if err != nil {
+			return dbCredentials{}, profileErrorStatus(err), err
+		}
+		return creds, 0, nil
+	case sources == 0 && s.cfg.DefaultCredentials != nil:
+		return *s.cfg.DefaultCredentials, 0, nil
+	default:
+		return ref.Credentials, 0, nil
+	}
+}
+
+// listConnections returns the named connections without any secrets.
+func (s *Server) listConnections(c *gin.Context) {
+	connections := make([]gin.H, 0, len(s.cfg.Connections))
+	for name, creds := range s.cfg.Connections {
+		connections = append(connections, gin.H{
+			"name":      name,
+			"host":      creds.Host,
+			"read_only": creds.ReadOnly,
+		})
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i]["name"].(string) < connections[j]["name"].(string)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"connections": connections})
+}
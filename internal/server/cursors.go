@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const codeTooManyCursors = "too_many_cursors"
+
+var errTooManyCursors = errors.New("too many open cursors")
+
+var errCursorNotFound = errors.New("cursor not found or expired")
+
+// queryCursor is an open result set that /execute-query hands out a page
+// at a time. It holds its own connection, and the query slot of the
+// request that opened it, until the rows run out, the client closes it or
+// it sits idle for cfg.CursorIdleTimeout.
+type queryCursor struct {
+	id       string
+	session  string
+	pageSize int
+	// closeConn gives back the connection the rows are read from and the
+	// query slot
+	closeConn func()
+	rows      *sql.Rows
+	scanner   *rowScanner
+	cancel    context.CancelFunc
+
+	// mu is held while a page is read, so pages come out in order
+	mu     sync.Mutex
+	closed bool
+
+	resource *idleResource
+}
+
+// page reads up to n rows. done is set once the result set is exhausted.
+func (cur *queryCursor) page(n int) (results []map[string]any, done bool, err error) {
+	results = []map[string]any{}
+	for len(results) < n {
+		if !cur.rows.Next() {
+			return results, true, cur.rows.Err()
+		}
+		row, err := cur.scanner.scan(cur.rows)
+		if err != nil {
+			return nil, true, err
+		}
+		results = append(results, row)
+	}
+	return results, false, nil
+}
+
+// release closes the result set and its connection; cur.mu must be held.
+func (cur *queryCursor) release() {
+	if cur.closed {
+		return
+	}
+	cur.closed = true
+	cur.rows.Close()
+	cur.cancel()
+	cur.closeConn()
+}
+
+type cursorManager struct {
+	cfg     *config
+	idle    *idleReaper
+	mu      sync.Mutex
+	cursors map[string]*queryCursor
+}
+
+// open registers a cursor over rows, which must have been queried with a
+// context cancelled by cancel rather than the request's. The cursor is
+// returned locked, like take, and calls closeConn once it is released.
+func (m *cursorManager) open(session string, pageSize int, closeConn func(), rows *sql.Rows, scanner *rowScanner, cancel context.CancelFunc) (*queryCursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	open := 0
+	for _, cur := range m.cursors {
+		if cur.session == session {
+			open++
+		}
+	}
+	if open >= m.cfg.CursorMaxOpen {
+		return nil, errTooManyCursors
+	}
+
+	cur := &queryCursor{
+		id:        newID(),
+		session:   session,
+		pageSize:  pageSize,
+		closeConn: closeConn,
+		rows:      rows,
+		scanner:   scanner,
+		cancel:    cancel,
+	}
+	cur.resource = m.idle.track("cursor", cur.id, m.cfg.CursorIdleTimeout, func() bool {
+		// A cursor busy reading a page is not idle
+		if !cur.mu.TryLock() {
+			return false
+		}
+		defer cur.mu.Unlock()
+		m.forget(cur)
+		cur.release()
+		return true
+	})
+	cur.mu.Lock()
+	m.cursors[cur.id] = cur
+	return cur, nil
+}
+
+// take returns the session's cursor with id, locked for reading a page.
+func (m *cursorManager) take(session, id string) (*queryCursor, error) {
+	m.mu.Lock()
+	cur, ok := m.cursors[id]
+	m.mu.Unlock()
+	if !ok || cur.session != session {
+		return nil, errCursorNotFound
+	}
+	cur.resource.touch()
+
+	cur.mu.Lock()
+	if cur.closed {
+		cur.mu.Unlock()
+		return nil, errCursorNotFound
+	}
+	return cur, nil
+}
+
+// close forgets cur and releases it; cur.mu must be held.
+func (m *cursorManager) close(cur *queryCursor) {
+	m.forget(cur)
+	m.idle.untrack(cur.resource)
+	cur.release()
+}
+
+func (m *cursorManager) forget(cur *queryCursor) {
+	m.mu.Lock()
+	delete(m.cursors, cur.id)
+	m.mu.Unlock()
+}
+
+// respondPage writes a page of cur, closing it once the rows run out. The
+// page's stats are timed from start, and extra is merged into the response.
+func (s *Server) respondPage(c *gin.Context, cur *queryCursor, pageSize int, start time.Time, extra gin.H) int {
+	results, done, err := cur.page(pageSize)
+	if err != nil {
+		s.queryCursors.close(cur)
+		respondDBError(c, err)
+		return 0
+	}
+
+	// complete is false while the cursor has rows left
+	response := gin.H{
+		"columns":  cur.scanner.columns,
+		"results":  results,
+		"count":    len(results),
+		"complete": done,
+		"stats":    newQueryStats(start, len(results), len(cur.scanner.columns)),
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	if done {
+		s.queryCursors.close(cur)
+	} else {
+		response["next_cursor"] = cur.id
+	}
+	c.JSON(http.StatusOK, response)
+	return len(results)
+}
+
+// continueCursor serves an /execute-query request naming a cursor: it
+// returns the next page of the result set, page_size rows long or as long
+// as the first page when unset.
+func (s *Server) continueCursor(c *gin.Context, req queryRequest) {
+	cur, err := s.queryCursors.take(sessionID(c), req.Cursor)
+	if err != nil {
+		respondCursorError(c, err)
+		return
+	}
+	defer cur.mu.Unlock()
+
+	pageSize := cur.pageSize
+	if req.PageSize > 0 {
+		pageSize = req.PageSize
+	}
+	s.respondPage(c, cur, pageSize, time.Now(), nil)
+}
+
+// closeCursor releases a cursor the client no longer needs.
+func (s *Server) closeCursor(c *gin.Context) {
+	cur, err := s.queryCursors.take(sessionID(c), c.Param("id"))
+	if err != nil {
+		respondCursorError(c, err)
+		return
+	}
+	defer cur.mu.Unlock()
+	s.queryCursors.close(cur)
+	c.Status(http.StatusNoContent)
+}
+
+func respondCursorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errTooManyCursors):
+		respondError(c, http.StatusTooManyRequests, codeTooManyCursors, err.Error())
+	case errors.Is(err, errCursorNotFound):
+		respondStatusError(c, http.StatusNotFound, err)
+	default:
+		respondStatusError(c, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queryResponse is the part of an /execute-query response the paging
+// tests read.
+type queryResponse struct {
+	Results    []map[string]any `json:"results"`
+	Count      int              `json:"count"`
+	Complete   *bool            `json:"complete"`
+	NextCursor string           `json:"next_cursor"`
+	Error      *apiError        `json:"error"`
+}
+
+func TestExecuteQueryComplete(t *testing.T) {
+	const query = "SELECT id FROM t"
+
+	t.Run("whole result", func(t *testing.T) {
+		s := newTestServer()
+		mock := withMockDB(t, s)
+		mock.ExpectQuery(query).WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+		resp := decodeQuery(t, postJSON(t, s, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"`+query+`"}`))
+		if resp.Complete == nil || !*resp.Complete || resp.Count != 3 || resp.NextCursor != "" {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	t.Run("paged", func(t *testing.T) {
+		s := newTestServer()
+		mock := withMockDB(t, s)
+		mock.ExpectQuery(query).WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+		r := s.Handler()
+		var cookies []*http.Cookie
+		page := func(body string) queryResponse {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/execute-query", strings.NewReader(body))
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			r.ServeHTTP(w, req)
+			if cookies == nil {
+				cookies = w.Result().Cookies()
+			}
+			return decodeQuery(t, w)
+		}
+
+		first := page(`{` + credentialsJSON + `,"query":"` + query + `","page_size":2}`)
+		if first.Complete == nil || *first.Complete || first.Count != 2 || first.NextCursor == "" {
+			t.Fatalf("first page = %+v", first)
+		}
+		last := page(`{"cursor":"` + first.NextCursor + `"}`)
+		if last.Complete == nil || !*last.Complete || last.Count != 1 || last.NextCursor != "" {
+			t.Errorf("last page = %+v", last)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s := newTestServer(func(c *config) { c.MaxQueryTimeout = 20 * time.Millisecond })
+		mock := withMockDB(t, s)
+		mock.ExpectQuery(query).WillDelayFor(time.Second).WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+		w := postJSON(t, s, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"`+query+`"}`)
+		// A query stopped partway is an error, never a result that looks
+		// whole
+		if resp := decodeQuery(t, w); w.Code == http.StatusOK || resp.Error == nil || resp.Complete != nil || resp.Results != nil {
+			t.Errorf("status %d: %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestCursorHoldsQuerySlot(t *testing.T) {
+	s := newTestServer(func(c *config) { c.QueryMaxPerSession = 1 })
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("SELECT id FROM t").WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("SELECT 2").WillReturnRows(mock.NewRows([]string{"2"}).AddRow(2))
+	r := s.Handler()
+	var cookies []*http.Cookie
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		r.ServeHTTP(w, req)
+		if cookies == nil {
+			cookies = w.Result().Cookies()
+		}
+		return w
+	}
+
+	first := decodeQuery(t, serve(http.MethodPost, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"SELECT id FROM t","page_size":1}`))
+	if first.NextCursor == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+	other := `{` + credentialsJSON + `,"query":"SELECT 2","queue":false}`
+	if w := serve(http.MethodPost, "/api/v1/execute-query", other); w.Code == http.StatusOK {
+		t.Errorf("query ran beside the session's open cursor: %s", w.Body)
+	}
+	if w := serve(http.MethodDelete, "/api/v1/cursors/"+first.NextCursor, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("closing the cursor: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodPost, "/api/v1/execute-query", other); w.Code != http.StatusOK {
+		t.Errorf("closing the cursor did not free its slot: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func decodeQuery(t *testing.T, w *httptest.ResponseRecorder) queryResponse {
+	t.Helper()
+	var resp queryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v", w.Body, err)
+	}
+	return resp
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// databaseNamePattern is the database names these endpoints accept,
+	// quoted in the DDL all the same.
+	databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}$`)
+	charsetNamePattern  = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+)
+
+type createDatabaseRequest struct {
+	connectionRef
+	Name      string `json:"name"`
+	Charset   string `json:"charset"`
+	Collation string `json:"collation"`
+}
+
+type dropDatabaseRequest struct {
+	connectionRef
+	Name string `json:"name"`
+	// ConfirmName must repeat Name exactly
+	ConfirmName string `json:"confirmName"`
+}
+
+// createDatabase runs CREATE DATABASE and returns the statement it ran.
+func (s *Server) createDatabase(c *gin.Context) {
+	var req createDatabaseRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !databaseNamePattern.MatchString(req.Name) {
+		respondBadRequest(c, "A database name of letters, digits, _ and $ is required")
+		return
+	}
+	if req.Charset != "" && !charsetNamePattern.MatchString(req.Charset) {
+		respondBadRequest(c, "Invalid charset: "+req.Charset)
+		return
+	}
+	if req.Collation != "" && !charsetNamePattern.MatchString(req.Collation) {
+		respondBadRequest(c, "Invalid collation: "+req.Collation)
+		return
+	}
+
+	ddl := "CREATE DATABASE " + quoteIdent(req.Name)
+	if req.Charset != "" {
+		ddl += " CHARACTER SET " + req.Charset
+	}
+	if req.Collation != "" {
+		ddl += " COLLATE " + req.Collation
+	}
+	s.runDatabaseDDL(c, req.connectionRef, ddl)
+}
+
+// dropDatabase runs DROP DATABASE once the name is confirmed and returns
+// the statement it ran.
+func (s *Server) dropDatabase(c *gin.Context) {
+	var req dropDatabaseRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !databaseNamePattern.MatchString(req.Name) {
+		respondBadRequest(c, "A database name of letters, digits, _ and $ is required")
+		return
+	}
+	if req.ConfirmName != req.Name {
+		respondBadRequest(c, "confirmName must match the name of the database to drop")
+		return
+	}
+	s.runDatabaseDDL(c, req.connectionRef, "DROP DATABASE "+quoteIdent(req.Name))
+}
+
+// runDatabaseDDL runs ddl on ref unless the connection is read-only or the
+// query policy blocks it.
+func (s *Server) runDatabaseDDL(c *gin.Context, ref connectionRef, ddl string) {
+	if !s.isQueryAllowed(ddl) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+	creds, status, err := s.resolveCredentials(ref)
+	if err != nil {
+		respondStatusError(c, status, err)
+		return
+	}
+	if creds.ReadOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Databases cannot be created or dropped on a read-only connection")
+		return
+	}
+
+	db, err := s.connectToDatabase(creds)
+	if err != nil {
+		respondConnectionError(c, err)
+		return
+	}
+	defer s.recordHandlerQuery(c, creds, ddl, time.Now(), 0)
+	if _, err := db.ExecContext(c.Request.Context(), ddl); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ddl": ddl})
+}
+
+type collation struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
+
+type charset struct {
+	Name             string      `json:"name"`
+	Description      string      `json:"description"`
+	DefaultCollation string      `json:"default_collation"`
+	MaxLength        int         `json:"max_length"`
+	Collations       []collation `json:"collations"`
+}
+
+// listCharsets returns the server's character sets and their collations.
+// As a GET it takes the connection or profileId as query parameters, or
+// uses the default credentials.
+func (s *Server) listCharsets(c *gin.Context) {
+	db, _, ok := s.openConnection(c, connectionRef{Connection: c.Query("connection"), ProfileID: c.Query("profileId")})
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	rows, err := db.QueryContext(ctx,
+		"SELECT CHARACTER_SET_NAME, DEFAULT_COLLATE_NAME, DESCRIPTION, MAXLEN FROM information_schema.CHARACTER_SETS ORDER BY CHARACTER_SET_NAME")
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+	charsets := []*charset{}
+	byName := map[string]*charset{}
+	for rows.Next() {
+		cs := &charset{Collations: []collation{}}
+		if err := rows.Scan(&cs.Name, &cs.DefaultCollation, &cs.Description, &cs.MaxLength); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		charsets = append(charsets, cs)
+		byName[cs.Name] = cs
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx,
+		"SELECT COLLATION_NAME, CHARACTER_SET_NAME FROM information_schema.COLLATIONS ORDER BY COLLATION_NAME")
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, set string
+		if err := rows.Scan(&name, &set); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		if cs, ok := byName[set]; ok {
+			cs.Collations = append(cs.Collations, collation{Name: name, Default: name == cs.DefaultCollation})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"charsets": charsets})
+}
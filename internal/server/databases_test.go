@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestListCharsets(t *testing.T) {
+	s := newTestServer(func(c *config) {
+		c.DefaultCredentials = &dbCredentials{Username: "app", Host: "db", Port: "3306"}
+	})
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("SELECT CHARACTER_SET_NAME, DEFAULT_COLLATE_NAME, DESCRIPTION, MAXLEN FROM information_schema.CHARACTER_SETS ORDER BY CHARACTER_SET_NAME").
+		WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME", "DEFAULT_COLLATE_NAME", "DESCRIPTION", "MAXLEN"}).
+			AddRow("latin1", "latin1_swedish_ci", "cp1252 West European", 1).
+			AddRow("utf8mb4", "utf8mb4_0900_ai_ci", "UTF-8 Unicode", 4))
+	mock.ExpectQuery("SELECT COLLATION_NAME, CHARACTER_SET_NAME FROM information_schema.COLLATIONS ORDER BY COLLATION_NAME").
+		WillReturnRows(sqlmock.NewRows([]string{"COLLATION_NAME", "CHARACTER_SET_NAME"}).
+			AddRow("latin1_swedish_ci", "latin1").
+			AddRow("utf8mb4_0900_ai_ci", "utf8mb4").
+			AddRow("utf8mb4_unicode_ci", "utf8mb4"))
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/charsets", nil))
+	want := `{"charsets":[` +
+		`{"name":"latin1","description":"cp1252 West European","default_collation":"latin1_swedish_ci","max_length":1,"collations":[{"name":"latin1_swedish_ci","default":true}]},` +
+		`{"name":"utf8mb4","description":"UTF-8 Unicode","default_collation":"utf8mb4_0900_ai_ci","max_length":4,"collations":[{"name":"utf8mb4_0900_ai_ci","default":true},{"name":"utf8mb4_unicode_ci","default":false}]}]}`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("status %d: %s\nwant %s", w.Code, w.Body, want)
+	}
+}
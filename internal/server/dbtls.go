@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tlsError marks TLS settings that cannot be used, before any connection
+// is attempted.
+type tlsError struct {
+	err error
+}
+
+func (e *tlsError) Error() string { return "tls: " + e.err.Error() }
+func (e *tlsError) Unwrap() error { return e.err }
+
+// usesTLS reports whether creds ask for TLS with their own CA or client
+// certificate.
+func (c dbCredentials) usesTLS() bool {
+	return c.CACert != "" || c.ClientCert != "" || c.ClientKey != ""
+}
+
+// tlsConfigName is the name creds' TLS config is registered with the
+// MySQL driver under. It is derived from the certificates, so requests with
+// the same ones share a DSN, and so a pool.
+func (c dbCredentials) tlsConfigName() string {
+	sum := sha256.Sum256([]byte(c.CACert + "\x00" + c.ClientCert + "\x00" + c.ClientKey))
+	return "boba-" + hex.EncodeToString(sum[:12])
+}
+
+// readPEM returns value itself when it holds PEM data, and otherwise reads
+// the file it names relative to cfg.TLSCertDir. Credentials come from
+// requests, so a path may not leave that directory, through ".." or a
+// symlink, and there are no paths at all without one.
+func (s *Server) readPEM(field, value string) ([]byte, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	if s.cfg.TLSCertDir == "" {
+		return nil, fmt.Errorf("%s must be PEM data, as BOBA_TLS_CERT_DIR is not set", field)
+	}
+	if !filepath.IsLocal(value) {
+		return nil, fmt.Errorf("%s must be PEM data or a path within BOBA_TLS_CERT_DIR", field)
+	}
+	dir, err := filepath.EvalSymlinks(s.cfg.TLSCertDir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: BOBA_TLS_CERT_DIR cannot be read", field)
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(dir, value))
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither PEM data nor a readable file", field)
+	}
+	if rel, err := filepath.Rel(dir, path); err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("%s must be PEM data or a path within BOBA_TLS_CERT_DIR", field)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither PEM data nor a readable file", field)
+	}
+	return data, nil
+}
+
+// registerTLS builds the TLS config for creds' CA and client certificate
+// and registers it with the MySQL driver under creds.tlsConfigName(). The
+// server's certificate is verified against the CA, or the system roots
+// without one. The pool manager registers a config as it opens a pool and
+// deregisters it with the last pool using it, as the driver copies the
+// config when the pool is opened.
+func (s *Server) registerTLS(creds dbCredentials) error {
+	if (creds.ClientCert == "") != (creds.ClientKey == "") {
+		return &tlsError{errors.New("client_cert and client_key must be given together")}
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if creds.CACert != "" {
+		pem, err := s.readPEM("ca_cert", creds.CACert)
+		if err != nil {
+			return &tlsError{err}
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return &tlsError{errors.New("ca_cert holds no PEM certificate")}
+		}
+	}
+	if creds.ClientCert != "" {
+		certPEM, err := s.readPEM("client_cert", creds.ClientCert)
+		if err != nil {
+			return &tlsError{err}
+		}
+		keyPEM, err := s.readPEM("client_key", creds.ClientKey)
+		if err != nil {
+			return &tlsError{err}
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return &tlsError{fmt.Errorf("client_cert and client_key: %w", err)}
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if err := mysql.RegisterTLSConfig(creds.tlsConfigName(), config); err != nil {
+		return &tlsError{err}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPEMStaysInCertDir(t *testing.T) {
+	const pem = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	root := t.TempDir()
+	dir := filepath.Join(root, "certs")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		filepath.Join(dir, "ca.pem"):  pem,
+		filepath.Join(root, "secret"): "not for requests",
+	} {
+		if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "secret"), filepath.Join(dir, "link.pem")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("without a directory", func(t *testing.T) {
+		s := newTestServer()
+		if _, err := s.readPEM("ca_cert", pem); err != nil {
+			t.Errorf("inline PEM: %v", err)
+		}
+		if _, err := s.readPEM("ca_cert", filepath.Join(dir, "ca.pem")); err == nil {
+			t.Error("read a file with no BOBA_TLS_CERT_DIR")
+		}
+	})
+
+	s := newTestServer(func(c *config) { c.TLSCertDir = dir })
+	if data, err := s.readPEM("ca_cert", "ca.pem"); err != nil || string(data) != pem {
+		t.Errorf("ca.pem = %q, %v", data, err)
+	}
+	for _, path := range []string{
+		filepath.Join(root, "secret"),
+		filepath.Join(dir, "ca.pem"),
+		"../secret",
+		"link.pem",
+		"/etc/passwd",
+	} {
+		if data, err := s.readPEM("ca_cert", path); err == nil {
+			t.Errorf("read %s: %q", path, data)
+		}
+	}
+}
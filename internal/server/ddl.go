@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ddlRequest struct {
+	connectionRef
+	Table string `json:"table"`
+}
+
+// tableDDL returns the statement that creates a table, as the server
+// prints it, for reviewing or copying a schema. A view's CREATE VIEW is
+// returned the same way.
+func (s *Server) tableDDL(c *gin.Context) {
+	var req ddlRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	table, ok := parseTableName(req.Table)
+	if !ok {
+		respondBadRequest(c, "A table name such as orders or shop.orders is required")
+		return
+	}
+	if driverName != "mysql" {
+		respondError(c, http.StatusNotImplemented, codeUnavailable, "DDL can only be read from MySQL")
+		return
+	}
+	db, _, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+
+	ddl, err := showCreateTable(c.Request.Context(), db, table)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"table": table.String(), "ddl": ddl})
+}
+
+// showCreateTable runs SHOW CREATE TABLE for table. The statement is the
+// second column, of the two for a table or the four for a view.
+func showCreateTable(ctx context.Context, db *sql.DB, table tableName) (string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW CREATE TABLE "+table.quoted())
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if len(columns) < 2 || !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", sql.ErrNoRows
+	}
+	values := make([]any, len(columns))
+	for i := range values {
+		values[i] = new(sql.RawBytes)
+	}
+	if err := rows.Scan(values...); err != nil {
+		return "", err
+	}
+	return string(*values[1].(*sql.RawBytes)), nil
+}
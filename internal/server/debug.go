@@ -0,0 +1,127 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerDebug adds the runtime profiles, stats and expvar counters,
+// served only with --enable-pprof, as they reveal the command line and the
+// load of the server. The profiles are routed one by one, as pprof.Index only
+// finds them by name under /debug/pprof/ with no base path.
+func (s *Server) registerDebug(debug *gin.RouterGroup) {
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	debug.GET("/pprof/:name", func(c *gin.Context) {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+	})
+	debug.GET("/vars", gin.WrapH(expvar.Handler()))
+	debug.GET("/stats", s.debugStats)
+}
+
+type heapStats struct {
+	AllocBytes    uint64 `json:"alloc_bytes"`
+	InUseBytes    uint64 `json:"in_use_bytes"`
+	SysBytes      uint64 `json:"sys_bytes"`
+	ReleasedBytes uint64 `json:"released_bytes"`
+	Objects       uint64 `json:"objects"`
+}
+
+type gcStats struct {
+	Count        uint32     `json:"count"`
+	PauseTotalMs float64    `json:"pause_total_ms"`
+	LastPauseMs  float64    `json:"last_pause_ms"`
+	Last         *time.Time `json:"last,omitempty"`
+	NextHeapSize uint64     `json:"next_heap_bytes"`
+	CPUFraction  float64    `json:"cpu_fraction"`
+}
+
+// poolStats is the sql.DBStats of a connection pool.
+type poolStats struct {
+	Pool              string  `json:"pool"`
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`
+	WaitMs            float64 `json:"wait_ms"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+// queryCounters are the /execute-query counters kept in expvar.
+type queryCounters struct {
+	InFlight  int64 `json:"in_flight"`
+	Queued    int64 `json:"queued"`
+	Coalesced int64 `json:"coalesced"`
+}
+
+// debugStats reports the goroutines, heap and garbage collector of the
+// process, the connections of each pool and the queries running, waiting
+// for a slot and answered by another's flight.
+func (s *Server) debugStats(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	gc := gcStats{
+		Count:        mem.NumGC,
+		PauseTotalMs: durationMs(time.Duration(mem.PauseTotalNs)),
+		NextHeapSize: mem.NextGC,
+		CPUFraction:  mem.GCCPUFraction,
+	}
+	if mem.NumGC > 0 {
+		last := time.Unix(0, int64(mem.LastGC)).UTC()
+		gc.Last = &last
+		gc.LastPauseMs = durationMs(time.Duration(mem.PauseNs[(mem.NumGC+255)%256]))
+	}
+
+	pools := []poolStats{}
+	for _, p := range s.dbPools.list() {
+		stats := p.db.Stats()
+		pools = append(pools, poolStats{
+			Pool:              p.label,
+			MaxOpen:           stats.MaxOpenConnections,
+			Open:              stats.OpenConnections,
+			InUse:             stats.InUse,
+			Idle:              stats.Idle,
+			WaitCount:         stats.WaitCount,
+			WaitMs:            durationMs(stats.WaitDuration),
+			MaxIdleClosed:     stats.MaxIdleClosed,
+			MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed: stats.MaxLifetimeClosed,
+		})
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Pool < pools[j].Pool })
+
+	c.JSON(http.StatusOK, gin.H{
+		"goroutines": runtime.NumGoroutine(),
+		"heap": heapStats{
+			AllocBytes:    mem.HeapAlloc,
+			InUseBytes:    mem.HeapInuse,
+			SysBytes:      mem.HeapSys,
+			ReleasedBytes: mem.HeapReleased,
+			Objects:       mem.HeapObjects,
+		},
+		"gc":    gc,
+		"pools": pools,
+		"queries": queryCounters{
+			InFlight:  queriesInFlight.Value(),
+			Queued:    queriesQueued.Value(),
+			Coalesced: coalescedQueries.Value(),
+		},
+	})
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
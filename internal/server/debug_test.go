@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugRoutesNeedPprofFlag(t *testing.T) {
+	paths := []string{"/debug/vars", "/debug/stats", "/debug/pprof/", "/api/v1/debug/vars"}
+
+	r := newTestServer().Handler()
+	for _, path := range paths {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s without --enable-pprof = %d, want 404", path, w.Code)
+		}
+	}
+
+	r = newTestServer(func(c *config) { c.EnablePprof = true }).Handler()
+	for _, path := range paths[:3] {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s with --enable-pprof = %d, want 200", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+	var stats struct {
+		Queries *queryCounters `json:"queries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || stats.Queries == nil {
+		t.Errorf("/debug/stats has no query counters: %s", w.Body)
+	}
+}
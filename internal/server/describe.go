@@ -0,0 +1,148 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// describableKeywords are the statements whose result can be read as a
+// derived table, and so described without fetching a row.
+var describableKeywords = map[string]bool{
+	"SELECT": true,
+	"WITH":   true,
+	"TABLE":  true,
+	"VALUES": true,
+}
+
+// describedColumn is a result column as /describe-query reports it. The
+// sizes are left out when the server does not give them.
+type describedColumn struct {
+	Name string `json:"name"`
+	// Type is the MySQL type name, such as VARCHAR or UNSIGNED BIGINT
+	Type string `json:"type"`
+	// JSONType is the JSON type the column's values have in /execute-query
+	// results: integer, number, boolean, string, object for GeoJSON
+	// geometries or any for JSON columns
+	JSONType  string `json:"jsonType"`
+	Nullable  *bool  `json:"nullable,omitempty"`
+	Length    *int64 `json:"length,omitempty"`
+	Precision *int64 `json:"precision,omitempty"`
+	Scale     *int64 `json:"scale,omitempty"`
+}
+
+// describeQuery reports the columns a query would return without running
+// it: the query is wrapped in SELECT * FROM (...) LIMIT 0, so the server
+// plans it and sends the column metadata but no rows. Statements that
+// cannot be wrapped, such as SHOW, only report their columns when run, and
+// come back with described false and the reason.
+func (s *Server) describeQuery(c *gin.Context) {
+	var req queryRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	prepared, status, apiErr := s.prepareQuery(&req)
+	if apiErr != nil {
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+	keyword := firstKeyword(prepared.query)
+	if !describableKeywords[keyword] {
+		c.JSON(http.StatusOK, gin.H{
+			"described": false,
+			"reason":    keyword + " statements only report their columns when they run",
+			"columns":   []describedColumn{},
+		})
+		return
+	}
+
+	db, err := s.connectToDatabase(prepared.creds)
+	if err != nil {
+		respondConnectionError(c, err)
+		return
+	}
+	ctx, cancel := prepared.withTimeout(c.Request.Context())
+	defer cancel()
+	// The line breaks keep a trailing -- comment from swallowing the
+	// closing parenthesis
+	wrapped := "SELECT * FROM (\n" + strings.TrimRight(strings.TrimSpace(prepared.query), ";") + "\n) AS described LIMIT 0"
+	q, conn, err := sessionQueryer(ctx, db, wrapped, prepared.useDatabase, prepared.sessionVariables)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if conn != nil {
+		defer discardConn(conn)
+	}
+	opts := resolveBoolColumns(ctx, q, prepared.query, prepared.scan)
+	rows, err := s.queryWithRetry(ctx, q, wrapped, prepared.args...)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1060 { // ER_DUP_FIELDNAME
+		c.JSON(http.StatusOK, gin.H{
+			"described": false,
+			"reason":    "The query returns two columns with the same name, which can only be described by running it",
+			"columns":   []describedColumn{},
+		})
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	columns := make([]describedColumn, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = describeColumn(ct, opts)
+	}
+	c.JSON(http.StatusOK, gin.H{"described": true, "columns": columns})
+}
+
+func describeColumn(ct *sql.ColumnType, opts scanOptions) describedColumn {
+	col := describedColumn{Name: ct.Name(), Type: ct.DatabaseTypeName(), JSONType: jsonTypeOf(ct, opts)}
+	if nullable, ok := ct.Nullable(); ok {
+		col.Nullable = &nullable
+	}
+	if length, ok := ct.Length(); ok {
+		col.Length = &length
+	}
+	if precision, scale, ok := ct.DecimalSize(); ok {
+		col.Precision, col.Scale = &precision, &scale
+	}
+	return col
+}
+
+// jsonTypeOf is the JSON type rowScanner gives values of a column of
+// type ct. DECIMAL stays a string so it loses no precision.
+func jsonTypeOf(ct *sql.ColumnType, opts scanOptions) string {
+	switch strings.TrimPrefix(ct.DatabaseTypeName(), "UNSIGNED ") {
+	case "TINYINT":
+		if _, ok := findFold(opts.tinyintOne, ct.Name()); opts.booleanTinyint || ok {
+			return "boolean"
+		}
+		return "integer"
+	case "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR", "BIT":
+		return "integer"
+	case "FLOAT", "DOUBLE":
+		return "number"
+	case "JSON":
+		if opts.rawJSON {
+			return "string"
+		}
+		return "any"
+	case "GEOMETRY":
+		if opts.geoJSON {
+			return "object"
+		}
+	}
+	return "string"
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// diffMaxRows caps the rows read from each side of a diff, since both
+// results are held in memory.
+const diffMaxRows = 100000
+
+type diffRequest struct {
+	Left  connectionRef `json:"left"`
+	Right connectionRef `json:"right"`
+	Query string        `json:"query"`
+	// Key is the column that identifies a row on both sides
+	Key string `json:"key"`
+}
+
+// diffSide is the result of the diff query on one side, indexed by key.
+type diffSide struct {
+	columns []string
+	rows    []map[string]any
+	keys    []string
+	byKey   map[string]map[string]any
+}
+
+type changedRow struct {
+	Key     any            `json:"key"`
+	Columns []string       `json:"columns"`
+	Left    map[string]any `json:"left"`
+	Right   map[string]any `json:"right"`
+}
+
+// diffQuery runs one read-only query on two databases and reports the rows
+// only one side has and the rows whose values differ, matched by a key
+// column. Row order does not matter, and values are compared after
+// normalizing, so 1.50 and 1.5 or 7 and "7" are equal.
+func (s *Server) diffQuery(c *gin.Context) {
+	var req diffRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Query == "" || req.Key == "" {
+		respondBadRequest(c, "A query and a key column are required")
+		return
+	}
+	if !s.respondQueryLength(c, req.Query) {
+		return
+	}
+	if !isReadOnlyQuery(req.Query) {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Only read-only statements can be diffed")
+		return
+	}
+	if !s.isQueryAllowed(req.Query) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+
+	ctx := c.Request.Context()
+	left, status, apiErr := s.readDiffSide(ctx, req.Left, req.Query, []string{req.Key}, diffMaxRows)
+	if apiErr != nil {
+		apiErr.Message = "left: " + apiErr.Message
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+	right, status, apiErr := s.readDiffSide(ctx, req.Right, req.Query, []string{req.Key}, diffMaxRows)
+	if apiErr != nil {
+		apiErr.Message = "right: " + apiErr.Message
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+
+	columns := slices.Clone(left.columns)
+	for _, col := range right.columns {
+		if !slices.Contains(columns, col) {
+			columns = append(columns, col)
+		}
+	}
+
+	onlyLeft := []map[string]any{}
+	changed := []changedRow{}
+	matching := 0
+	for i, key := range left.keys {
+		row := left.rows[i]
+		other, ok := right.byKey[key]
+		if !ok {
+			onlyLeft = append(onlyLeft, row)
+			continue
+		}
+		var differing []string
+		for _, col := range columns {
+			a, inLeft := row[col]
+			b, inRight := other[col]
+			if inLeft != inRight || normalizeDiffValue(a) != normalizeDiffValue(b) {
+				differing = append(differing, col)
+			}
+		}
+		if differing == nil {
+			matching++
+			continue
+		}
+		changed = append(changed, changedRow{Key: row[req.Key], Columns: differing, Left: row, Right: other})
+	}
+	onlyRight := []map[string]any{}
+	for i, key := range right.keys {
+		if _, ok := left.byKey[key]; !ok {
+			onlyRight = append(onlyRight, right.rows[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":         req.Key,
+		"left_count":  len(left.rows),
+		"right_count": len(right.rows),
+		"matching":    matching,
+		"only_left":   onlyLeft,
+		"only_right":  onlyRight,
+		"changed":     changed,
+	})
+}
+
+// readDiffSide runs query on ref and indexes up to limit rows by the key
+// columns.
+func (s *Server) readDiffSide(ctx context.Context, ref connectionRef, query string, key []string, limit int) (*diffSide, int, *apiError) {
+	creds, status, err := s.resolveCredentials(ref)
+	if err != nil {
+		return nil, status, &apiError{Code: codeForStatus(status), Message: sanitizeError(err)}
+	}
+	db, err := s.connectToDatabase(creds)
+	if err != nil {
+		status, body := classifyConnectionError(err)
+		return nil, status, &body
+	}
+
+	ctx, cancel := s.withMaxTimeout(ctx, creds)
+	defer cancel()
+	rows, err := s.queryWithRetry(ctx, db, query)
+	if err != nil {
+		status, body := classifyDBError(err)
+		return nil, status, &body
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		status, body := classifyDBError(err)
+		return nil, status, &body
+	}
+	for _, col := range key {
+		if !slices.Contains(columns, col) {
+			return nil, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: fmt.Sprintf("The result has no %s column", col)}
+		}
+	}
+
+	side := &diffSide{columns: columns, rows: []map[string]any{}, byKey: map[string]map[string]any{}}
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, scanOptions{})
+	for rows.Next() {
+		if len(side.rows) == limit {
+			return nil, http.StatusUnprocessableEntity, &apiError{Code: codeResultTooLarge, Message: fmt.Sprintf("The result has more than %d rows", limit)}
+		}
+		row, err := scanner.scan(rows)
+		if err != nil {
+			status, body := classifyDBError(err)
+			return nil, status, &body
+		}
+		k := diffKey(row, key)
+		if _, dup := side.byKey[k]; dup {
+			return nil, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: fmt.Sprintf("Key %v appears more than once", keyValues(row, key))}
+		}
+		side.rows = append(side.rows, row)
+		side.keys = append(side.keys, k)
+		side.byKey[k] = row
+	}
+	if err := rows.Err(); err != nil {
+		status, body := classifyDBError(err)
+		return nil, status, &body
+	}
+	return side, 0, nil
+}
+
+// diffKey is the normalized value of row's key columns.
+func diffKey(row map[string]any, key []string) string {
+	parts := make([]string, len(key))
+	for i, col := range key {
+		parts[i] = normalizeDiffValue(row[col])
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+// keyValues is the value of the key of row: the value of its one column,
+// or a list of the values of several.
+func keyValues(row map[string]any, key []string) any {
+	if len(key) == 1 {
+		return row[key[0]]
+	}
+	values := make([]any, len(key))
+	for i, col := range key {
+		values[i] = row[col]
+	}
+	return values
+}
+
+// decimalPattern matches the numbers normalizeDiffValue compares by value.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// normalizeDiffValue renders a converted value so that values equal in
+// SQL are equal as strings: numbers, and strings that hold numbers, become
+// their exact rational form, and NULL gets a marker no string can match.
+func normalizeDiffValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "\x00NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	s := fmt.Sprint(v)
+	if decimalPattern.MatchString(s) {
+		if r, ok := new(big.Rat).SetString(s); ok {
+			return r.RatString()
+		}
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// driverInfo describes a database driver and the credential fields a
+// connection form needs for it.
+type driverInfo struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Required []string `json:"required"`
+	Optional []string `json:"optional"`
+	// Notes explains fields that depend on each other
+	Notes string `json:"notes,omitempty"`
+}
+
+// knownDrivers are the drivers boba can connect with, keyed by their
+// database/sql name. Only those compiled into the build are listed.
+var knownDrivers = map[string]driverInfo{
+	"mysql": {
+		ID:       "mysql",
+		Name:     "MySQL",
+		Required: []string{"username", "host", "port"},
+		Optional: []string{"password", "database", "socket", "ssh", "read_only", "connect_timeout", "charset", "collation", "bool_columns", "ca_cert", "client_cert", "client_key"},
+		Notes:    "socket replaces host and port",
+	},
+}
+
+// listDrivers returns the drivers registered in this build, in the sorted
+// order of sql.Drivers.
+func listDrivers(c *gin.Context) {
+	drivers := []driverInfo{}
+	for _, name := range sql.Drivers() {
+		if info, ok := knownDrivers[name]; ok {
+			drivers = append(drivers, info)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"drivers": drivers, "default": driverName})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// aggregateFunctions are the functions that fold many rows into one, so a
+// result using them has no row to write an edit back to.
+var aggregateFunctions = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+	"GROUP_CONCAT": true, "JSON_ARRAYAGG": true, "JSON_OBJECTAGG": true,
+	"STD": true, "STDDEV": true, "VARIANCE": true, "BIT_AND": true, "BIT_OR": true, "BIT_XOR": true,
+}
+
+// editability says whether the rows of a result can be edited in place
+// with /tables/update-row and /tables/delete-row, and if not, why.
+type editability struct {
+	Editable bool `json:"editable"`
+	// Table is the table the rows come from, as the query names it
+	Table      string   `json:"table,omitempty"`
+	PrimaryKey []string `json:"primaryKey,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+func notEditable(reason string) editability {
+	return editability{Reason: reason}
+}
+
+// queryEditability decides whether the result of query, with columns, is
+// editable: a SELECT from one table, without aggregates, grouping,
+// DISTINCT or set operations, whose columns include the table's whole
+// primary key. The analysis is of the query text, so it errs on the side
+// of not editable.
+func queryEditability(ctx context.Context, q queryer, query string, creds dbCredentials, columns []string) editability {
+	if creds.ReadOnly {
+		return notEditable("The connection is read-only")
+	}
+	stmts, err := analyzeStatements(query)
+	if err != nil || len(stmts) != 1 {
+		return notEditable("Only the result of a single statement can be edited")
+	}
+	st := stmts[0]
+	if st.kind != "SELECT" {
+		return notEditable("Only the result of a SELECT can be edited")
+	}
+
+	toks, _ := tokenizeSQL(query)
+	toks = significantTokens(toks)
+	depth := 0
+	for i, t := range toks {
+		next := peek(toks, i+1)
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		case depth > 0:
+		case t.isWord("DISTINCT") || t.isWord("DISTINCTROW"):
+			return notEditable("A SELECT DISTINCT result cannot be edited")
+		case t.isWord("GROUP") && next.isWord("BY"), t.isWord("HAVING"):
+			return notEditable("A grouped result cannot be edited")
+		case t.isWord("UNION") || t.isWord("INTERSECT") || t.isWord("EXCEPT"):
+			return notEditable("The result of a set operation cannot be edited")
+		case t.isWord("JOIN") || t.isWord("STRAIGHT_JOIN"):
+			return notEditable("A result joining several tables cannot be edited")
+		case t.isWord("FROM") && next.isSymbol("("):
+			return notEditable("A result read from a derived table cannot be edited")
+		case t.is(tokWord) && next.isSymbol("(") && aggregateFunctions[strings.ToUpper(t.text)]:
+			return notEditable("A result of aggregate functions cannot be edited")
+		}
+	}
+	if len(st.tables) != 1 {
+		return notEditable("Only a result read from exactly one table can be edited")
+	}
+	return tableEditability(ctx, q, st.tables[0], columns)
+}
+
+// tableEditability checks that columns, read from table, include its
+// whole primary key.
+func tableEditability(ctx context.Context, q queryer, table tableName, columns []string) editability {
+	known, err := tableColumns(ctx, q, table)
+	if err != nil {
+		return notEditable("The table's primary key could not be read")
+	}
+	var key []string
+	for _, col := range known {
+		if !col.primary {
+			continue
+		}
+		name, ok := findFold(columns, col.name)
+		if !ok {
+			return notEditable(fmt.Sprintf("The result does not include primary key column %s", col.name))
+		}
+		key = append(key, name)
+	}
+	if len(known) == 0 {
+		return notEditable("Table not found: " + table.String())
+	}
+	if len(key) == 0 {
+		return notEditable("Table " + table.String() + " has no primary key")
+	}
+	return editability{Editable: true, Table: table.String(), PrimaryKey: key}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// enumColumns returns the names of the ENUM and SET columns of rows.
+func enumColumns(rows *sql.Rows) []string {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, ct := range columnTypes {
+		if name := ct.DatabaseTypeName(); name == "ENUM" || name == "SET" {
+			names = append(names, ct.Name())
+		}
+	}
+	return names
+}
+
+// enumMembers looks up the allowed members of the ENUM and SET columns
+// named in columns. The driver does not say which table a result column
+// comes from, so the columns are matched by name against the tables query
+// reads; a column renamed by an alias is not found.
+func enumMembers(ctx context.Context, q queryer, query string, columns []string) map[string][]string {
+	members := map[string][]string{}
+	if len(columns) == 0 {
+		return members
+	}
+	stmts, err := analyzeStatements(query)
+	if err != nil {
+		return members
+	}
+	for _, st := range stmts {
+		for _, table := range st.tables {
+			var schema any
+			if table.Schema != "" {
+				schema = table.Schema
+			}
+			rows, err := q.QueryContext(ctx,
+				"SELECT COLUMN_NAME, COLUMN_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ? AND DATA_TYPE IN ('enum', 'set')",
+				schema, table.Name)
+			if err != nil {
+				return members
+			}
+			for rows.Next() {
+				var name, columnType string
+				if err := rows.Scan(&name, &columnType); err != nil {
+					break
+				}
+				column, ok := findFold(columns, name)
+				// The first table to have the column wins, as in an
+				// unqualified reference
+				if _, seen := members[column]; !ok || seen {
+					continue
+				}
+				if parsed, ok := parseEnumType(columnType); ok {
+					members[column] = parsed
+				}
+			}
+			rows.Close()
+		}
+	}
+	return members
+}
+
+// findFold returns the entry of list equal to s ignoring case, as column
+// names are.
+func findFold(list []string, s string) (string, bool) {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parseEnumType returns the members of a COLUMN_TYPE such as
+// enum('new','it”s done') or set('a','b').
+func parseEnumType(columnType string) ([]string, bool) {
+	tokens, err := tokenizeSQL(columnType)
+	if err != nil {
+		return nil, false
+	}
+	tokens = significantTokens(tokens)
+	if len(tokens) < 3 || !(tokens[0].isWord("ENUM") || tokens[0].isWord("SET")) || !tokens[1].isSymbol("(") {
+		return nil, false
+	}
+	members := []string{}
+	for _, t := range tokens[2:] {
+		switch {
+		case t.is(tokString):
+			members = append(members, unquoteGrantToken(t))
+		case t.isSymbol(")"):
+			return members, true
+		case !t.isSymbol(","):
+			return nil, false
+		}
+	}
+	return nil, false
+}
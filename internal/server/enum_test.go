@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestParseEnumType(t *testing.T) {
+	tests := []struct {
+		columnType string
+		want       []string
+	}{
+		{"enum('new','shipped','it''s done')", []string{"new", "shipped", "it's done"}},
+		{"set('a','b,c')", []string{"a", "b,c"}},
+		{"ENUM('')", []string{""}},
+		{"enum()", []string{}},
+	}
+	for _, tt := range tests {
+		if got, ok := parseEnumType(tt.columnType); !ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseEnumType(%q) = %q, %v; want %q", tt.columnType, got, ok, tt.want)
+		}
+	}
+	for _, bad := range []string{"varchar(10)", "enum('a'", "enum(a)"} {
+		if got, ok := parseEnumType(bad); ok {
+			t.Errorf("parseEnumType(%q) = %q", bad, got)
+		}
+	}
+}
+
+func TestExecuteQueryEnumValues(t *testing.T) {
+	const query = "SELECT id, status, tags FROM orders"
+	s := newTestServer()
+	mock := withMockDB(t, s)
+	mock.ExpectQuery(query).WillReturnRows(mock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("id").OfType("INT", int64(0)),
+		sqlmock.NewColumn("status").OfType("ENUM", []byte(nil)),
+		sqlmock.NewColumn("tags").OfType("SET", []byte(nil)),
+	).AddRow(int64(1), []byte("shipped"), []byte("gift,fragile")))
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ? AND DATA_TYPE IN ('enum', 'set')").
+		WithArgs(nil, "orders").
+		WillReturnRows(mock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("status", "enum('new','shipped','it''s done')").
+			AddRow("tags", "set('gift','fragile')"))
+
+	w := postJSON(t, s, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"`+query+`","enumValues":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Results    []map[string]any    `json:"results"`
+		EnumValues map[string][]string `json:"enumValues"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0]["status"] != "shipped" || resp.Results[0]["tags"] != "gift,fragile" {
+		t.Errorf("results = %v", resp.Results)
+	}
+	want := map[string][]string{"status": {"new", "shipped", "it's done"}, "tags": {"gift", "fragile"}}
+	if !reflect.DeepEqual(resp.EnumValues, want) {
+		t.Errorf("enumValues = %q, want %q", resp.EnumValues, want)
+	}
+}
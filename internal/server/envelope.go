@@ -0,0 +1,104 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// /execute-query response envelope versions. Version 1, the default, is
+// {results, count, ...}; clients opt in to a later one with
+// Accept: application/vnd.boba.v2+json or an X-Boba-API-Version header.
+const (
+	defaultResponseVersion = 1
+	latestResponseVersion  = 2
+	apiVersionHeader       = "X-Boba-API-Version"
+)
+
+var vendorMediaType = regexp.MustCompile(`^application/vnd\.boba\.v(\d+)\+json$`)
+
+// responseMediaType is the Content-Type of a response of version.
+func responseMediaType(version int) string {
+	if version == defaultResponseVersion {
+		return "application/json; charset=utf-8"
+	}
+	return fmt.Sprintf("application/vnd.boba.v%d+json; charset=utf-8", version)
+}
+
+// responseVersion is the envelope version c asks for, from the first
+// vendor media type in Accept or else X-Boba-API-Version. It responds 406
+// and returns false for a version this server does not have.
+func responseVersion(c *gin.Context) (int, bool) {
+	requested := ""
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if m := vendorMediaType.FindStringSubmatch(strings.TrimSpace(mediaType)); m != nil {
+			requested = m[1]
+			break
+		}
+	}
+	if requested == "" {
+		requested = strings.TrimPrefix(c.GetHeader(apiVersionHeader), "v")
+	}
+	if requested == "" {
+		return defaultResponseVersion, true
+	}
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < 1 || version > latestResponseVersion {
+		respondError(c, http.StatusNotAcceptable, "unsupported_version", fmt.Sprintf("Response version %s is not supported; the latest is %d", requested, latestResponseVersion))
+		return 0, false
+	}
+	return version, true
+}
+
+// versionedKey keeps the cached and coalesced responses of each version
+// apart under key.
+func versionedKey(key string, version int) string {
+	if version == defaultResponseVersion {
+		return key
+	}
+	return fmt.Sprintf("%s|v%d", key, version)
+}
+
+// responseStatsV2 are the stats of a version 2 envelope, which gathers the
+// timings version 1 has at the top level, including the wait for a query
+// slot.
+type responseStatsV2 struct {
+	queryStats
+	RowsScannedPerSecond float64 `json:"rows_scanned_per_second"`
+	QueueWaitMs          int64   `json:"queue_wait_ms"`
+}
+
+// describeColumnsV2 describes the columns of a version 2 envelope, in
+// result order.
+func describeColumnsV2(names []string, types []*sql.ColumnType, opts scanOptions) []describedColumn {
+	columns := make([]describedColumn, len(names))
+	for i, name := range names {
+		if i < len(types) {
+			columns[i] = describeColumn(types[i], opts)
+		} else {
+			columns[i] = describedColumn{Name: name}
+		}
+	}
+	return columns
+}
+
+// orderedRows turns results into rows of values in the order of names, so
+// clients need not rely on object key order. Duplicate column names share
+// the one value a result has for them.
+func orderedRows(names []string, results []map[string]any) [][]any {
+	rows := make([][]any, len(results))
+	for i, result := range results {
+		row := make([]any, len(names))
+		for j, name := range names {
+			row[j] = result[name]
+		}
+		rows[i] = row
+	}
+	return rows
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestSanitizeErrorRedactsWrongPassword(t *testing.T) {
+	const password = "hunter2!"
+	dsn, err := newTestServer().buildDSN(dbCredentials{Username: "app", Password: password, Host: "db.internal", Port: "3306", Database: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		keep string
+	}{
+		{"driver error with the DSN", fmt.Errorf("connecting to %s: %w", dsn, &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'app'@'10.0.0.2' (using password: YES)"}), "Access denied for user 'app'"},
+		{"DSN alone", errors.New("invalid DSN: " + dsn), "tcp(db.internal:3306)/shop"},
+		{"URL", errors.New("dial mysql://app:" + password + "@db.internal:3306/shop: refused"), "@db.internal:3306/shop"},
+		{"key=value", errors.New("user=app password=" + password + " host=db.internal"), "host=db.internal"},
+		{"JSON", errors.New(`bad request {"username":"app","password":"` + password + `"}`), `"username":"app"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeError(tt.err)
+			if strings.Contains(got, "hunter2") {
+				t.Errorf("password echoed back: %s", got)
+			}
+			if !strings.Contains(got, tt.keep) {
+				t.Errorf("%q lost %q", got, tt.keep)
+			}
+		})
+	}
+}
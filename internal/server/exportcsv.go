@@ -0,0 +1,65 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatSuffixes are the formats /execute-query also serves at a path
+// ending in the format, such as /execute-query.csv, for links that pick
+// the format without a body field.
+var formatSuffixes = []string{"json", "csv", "xlsx", "arrow"}
+
+// formatSuffixKey is the gin context key of the format a suffixed path
+// selects.
+const formatSuffixKey = "formatSuffix"
+
+func withFormatSuffix(suffix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(formatSuffixKey, suffix)
+	}
+}
+
+// writeCSV streams rows as CSV with a header row, decoding values as the
+// json format does and rendering them as a schedule run's CSV download
+// does, and returns the number of rows written. An error once rows have
+// been sent cannot change the response, which is cut short.
+func writeCSV(c *gin.Context, rows *sql.Rows, columns []string, opts scanOptions) (int, error) {
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, opts)
+
+	filename := "boba-results-" + time.Now().Format("20060102-150405") + ".csv"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(scanner.columns); err != nil {
+		return 0, err
+	}
+
+	record := make([]string, len(scanner.columns))
+	count := 0
+	for rows.Next() {
+		touchRunningQuery(c)
+		row, err := scanner.scan(rows)
+		if err != nil {
+			return count, err
+		}
+		for i, col := range scanner.columns {
+			record[i] = csvCell(row[col])
+		}
+		if err := w.Write(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	w.Flush()
+	return count, w.Error()
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+// serveExport posts query to /execute-query.<format> on s, returning the
+// response and whether the handler aborted it.
+func serveExport(t *testing.T, s *Server, format, query string) (w *httptest.ResponseRecorder, aborted bool) {
+	t.Helper()
+	body := `{"credentials":{"username":"app","host":"db","port":"3306"},"query":"` + query + `"}`
+	w = httptest.NewRecorder()
+	defer func() {
+		if rec := recover(); rec != nil {
+			if err, ok := rec.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+			aborted = true
+		}
+	}()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/execute-query."+format, strings.NewReader(body)))
+	return w, false
+}
+
+func TestCSVExportRowError(t *testing.T) {
+	lost := &mysql.MySQLError{Number: 1317, Message: "Query execution was interrupted"}
+
+	t.Run("before any output", func(t *testing.T) {
+		s := newTestServer()
+		mock := withMockDB(t, s)
+		mock.ExpectQuery("SELECT a FROM t").WillReturnRows(
+			sqlmock.NewRows([]string{"a"}).AddRow("x").AddRow("y").RowError(1, lost))
+		w, aborted := serveExport(t, s, "csv", "SELECT a FROM t")
+		if aborted || w.Code == http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			t.Fatalf("status %d, %s, aborted %v; want a JSON error", w.Code, w.Header().Get("Content-Type"), aborted)
+		}
+		if w.Header().Get("Content-Disposition") != "" {
+			t.Error("JSON error sent as an attachment")
+		}
+	})
+
+	t.Run("after output", func(t *testing.T) {
+		s := newTestServer()
+		mock := withMockDB(t, s)
+		rows := sqlmock.NewRows([]string{"a"})
+		for range 500 {
+			rows.AddRow(strings.Repeat("x", 100))
+		}
+		mock.ExpectQuery("SELECT a FROM t").WillReturnRows(rows.RowError(499, lost))
+		w, aborted := serveExport(t, s, "csv", "SELECT a FROM t")
+		if !aborted {
+			t.Error("response not aborted")
+		}
+		if strings.Contains(w.Body.String(), `"error"`) {
+			t.Error("JSON error appended to the CSV")
+		}
+	})
+}
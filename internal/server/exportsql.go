@@ -0,0 +1,285 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dumpBatchRows  = 500
+	dumpBatchBytes = 1 << 20 // keeps INSERTs well under max_allowed_packet
+)
+
+// binaryTypes are the column types dumped as hex literals.
+var binaryTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "BIT": true, "GEOMETRY": true,
+	"TINYBLOB": true, "BLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+}
+
+// numericTypes are the numeric column types, dumped as they are.
+var numericTypes = map[string]bool{
+	"TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "INT": true, "BIGINT": true,
+	"DECIMAL": true, "FLOAT": true, "DOUBLE": true, "YEAR": true,
+}
+
+// sqlEscaper escapes string literals the way mysqldump does.
+var sqlEscaper = strings.NewReplacer(
+	`\`, `\\`, `'`, `\'`, `"`, `\"`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`,
+)
+
+type sqlExportRequest struct {
+	connectionRef
+	// Table limits the dump to one table; all base tables by default
+	Table      string `json:"table"`
+	SchemaOnly bool   `json:"schema_only"`
+	DataOnly   bool   `json:"data_only"`
+	// DropTable adds DROP TABLE IF EXISTS before each CREATE TABLE
+	DropTable bool `json:"drop_table"`
+	// Where filters the rows of Table
+	Where string `json:"where"`
+}
+
+// dumpTable is a table to dump and its CREATE TABLE statement.
+type dumpTable struct {
+	name string
+	ddl  string
+}
+
+// exportSQL streams a dump of a table or the whole database: CREATE TABLE
+// statements followed by batched INSERTs. Everything is read inside one
+// read-only transaction so the dump is a consistent snapshot.
+func (s *Server) exportSQL(c *gin.Context) {
+	var req sqlExportRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.SchemaOnly && req.DataOnly {
+		respondBadRequest(c, "schema_only and data_only cannot both be set")
+		return
+	}
+	if req.Where != "" && req.Table == "" {
+		respondBadRequest(c, "where needs a table")
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.withMaxTimeout(c.Request.Context(), creds)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Read the DDL first, so a missing table is still an error response
+	tables, err := dumpTables(ctx, tx, req.Table)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	name := req.Table
+	if name == "" {
+		name = creds.Database
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+dumpFilename(name)+`.sql"`)
+	c.Header("Content-Type", "application/sql; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriter(c.Writer)
+	if err := writeDump(ctx, tx, w, tables, req); err != nil {
+		// The status is already sent, so the failure goes into the file
+		fmt.Fprintf(w, "\n-- Export failed: %s\n", strings.ReplaceAll(sanitizeError(err), "\n", " "))
+	}
+	w.Flush()
+}
+
+// dumpTables returns table, or every base table, with its DDL.
+func dumpTables(ctx context.Context, tx *sql.Tx, table string) ([]dumpTable, error) {
+	var names []string
+	if table != "" {
+		names = []string{table}
+	} else {
+		rows, err := tx.QueryContext(ctx, "SHOW FULL TABLES WHERE Table_type = 'BASE TABLE'")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, kind string
+			if err := rows.Scan(&name, &kind); err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	tables := make([]dumpTable, len(names))
+	for i, name := range names {
+		var ddl string
+		err := tx.QueryRowContext(ctx, "SHOW CREATE TABLE "+quoteIdent(name)).Scan(new(string), &ddl)
+		if err != nil {
+			return nil, err
+		}
+		tables[i] = dumpTable{name: name, ddl: ddl}
+	}
+	return tables, nil
+}
+
+func writeDump(ctx context.Context, tx *sql.Tx, w io.Writer, tables []dumpTable, req sqlExportRequest) error {
+	fmt.Fprintf(w, "-- boba SQL dump, %s\n\n", time.Now().UTC().Format(time.RFC3339))
+	io.WriteString(w, "SET NAMES utf8mb4;\nSET FOREIGN_KEY_CHECKS = 0;\n\n")
+	for _, t := range tables {
+		if !req.DataOnly {
+			fmt.Fprintf(w, "--\n-- Table %s\n--\n\n", quoteIdent(t.name))
+			if req.DropTable {
+				fmt.Fprintf(w, "DROP TABLE IF EXISTS %s;\n", quoteIdent(t.name))
+			}
+			fmt.Fprintf(w, "%s;\n\n", t.ddl)
+		}
+		if !req.SchemaOnly {
+			if err := dumpRows(ctx, tx, w, t.name, req.Where); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "SET FOREIGN_KEY_CHECKS = 1;\n")
+	return err
+}
+
+// dumpRows writes the rows of table as multi-row INSERT statements.
+func dumpRows(ctx context.Context, tx *sql.Tx, w io.Writer, table, where string) error {
+	query := "SELECT * FROM " + quoteIdent(table)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	dbTypes := make([]string, len(columnTypes))
+	quoted := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		dbTypes[i] = strings.TrimPrefix(ct.DatabaseTypeName(), "UNSIGNED ")
+		quoted[i] = quoteIdent(ct.Name())
+	}
+	prefix := "INSERT INTO " + quoteIdent(table) + " (" + strings.Join(quoted, ", ") + ") VALUES\n"
+
+	values := make([]any, len(columnTypes))
+	valuePtrs := make([]any, len(columnTypes))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	var stmt strings.Builder
+	batch := 0
+	flush := func() error {
+		if batch == 0 {
+			return nil
+		}
+		stmt.WriteString(";\n\n")
+		_, err := io.WriteString(w, stmt.String())
+		stmt.Reset()
+		batch = 0
+		return err
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+		if batch == 0 {
+			stmt.WriteString(prefix)
+		} else {
+			stmt.WriteString(",\n")
+		}
+		stmt.WriteString("(")
+		for i, val := range values {
+			if i > 0 {
+				stmt.WriteString(", ")
+			}
+			stmt.WriteString(sqlLiteral(dbTypes[i], val))
+		}
+		stmt.WriteString(")")
+		batch++
+
+		if batch == dumpBatchRows || stmt.Len() >= dumpBatchBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// sqlLiteral renders a scanned value of a column of dbType as a MySQL
+// literal.
+func sqlLiteral(dbType string, val any) string {
+	if isNull(val) {
+		return "NULL"
+	}
+	switch v := val.(type) {
+	case []byte:
+		switch {
+		case binaryTypes[dbType]:
+			return "X'" + hex.EncodeToString(v) + "'"
+		case numericTypes[dbType]:
+			return string(v)
+		}
+		return "'" + sqlEscaper.Replace(string(v)) + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		return "'" + sqlEscaper.Replace(fmt.Sprint(convertValue(v))) + "'"
+	}
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// dumpFilename makes name safe to use in a Content-Disposition header.
+func dumpFilename(name string) string {
+	if name = unsafeFilenameChars.ReplaceAllString(name, "_"); name == "" {
+		return "dump"
+	}
+	return name
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coalescedQueries counts the requests answered with the result of an
+// identical query another request was already running.
+var coalescedQueries = expvar.NewInt("coalescedQueries")
+
+// queryFlight is one execution of a query, shared by the identical
+// requests that arrived while it ran. It runs under a context of its own,
+// cancelled only once every request waiting on it has gone away.
+type queryFlight struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// waiters is the requests still waiting, guarded by flightGroup.mu
+	waiters int
+
+	// done is closed once the response below is complete
+	done        chan struct{}
+	status      int
+	contentType string
+	body        []byte
+	rowCount    int
+}
+
+// flightGroup coalesces identical concurrent SELECTs, keyed like the
+// result cache, so a burst of them runs once. As followers never connect,
+// the key covers every credential, and only a request that logs in exactly
+// as the leader does shares its rows.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*queryFlight
+}
+
+// coalescable reports whether the response to req, running query, depends
+// only on the key of the flight, so it can be shared. A snapshot, a retry
+// policy or a timeout of its own would each have the leader answer for a
+// request that asked for something else.
+func (s *Server) coalescable(c *gin.Context, req *queryRequest, query string) bool {
+	return firstKeyword(query) == "SELECT" &&
+		(req.Format == "" || req.Format == "json") && req.PageSize == 0 &&
+		!req.Lint && !req.EnumValues && !req.CollectStats && !req.ConfirmIfExpensive &&
+		!req.Snapshot && req.Retries == nil && req.TimeoutSeconds == 0 &&
+		!s.stickySessions.has(sessionID(c))
+}
+
+// join adds the request with ctx to the flight for key, starting one when
+// none is running; leader is set when it is the request that must run it.
+func (g *flightGroup) join(ctx context.Context, key string) (f *queryFlight, leader bool) {
+	g.mu.Lock()
+	f, running := g.flights[key]
+	if running {
+		f.waiters++
+	} else {
+		sharedCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &queryFlight{ctx: sharedCtx, cancel: cancel, waiters: 1, done: make(chan struct{}), status: http.StatusOK}
+		g.flights[key] = f
+	}
+	g.mu.Unlock()
+	context.AfterFunc(ctx, func() { g.leave(f) })
+	return f, !running
+}
+
+// leave drops a waiter, cancelling the query once none is left.
+func (g *flightGroup) leave(f *queryFlight) {
+	g.mu.Lock()
+	f.waiters--
+	last := f.waiters == 0
+	g.mu.Unlock()
+	if last {
+		f.cancel()
+	}
+}
+
+// lead makes the current request run f: the query gets f's context, and
+// the response is recorded for the others. The returned func publishes it,
+// with the number of rows it holds, and must run when the handler is done.
+func (g *flightGroup) lead(c *gin.Context, key string, f *queryFlight) func(rowCount int) {
+	w := &flightWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Request = c.Request.WithContext(f.ctx)
+	return func(rowCount int) {
+		g.mu.Lock()
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		g.mu.Unlock()
+		f.status, f.contentType, f.body, f.rowCount = w.Status(), w.Header().Get("Content-Type"), w.body, rowCount
+		close(f.done)
+		f.cancel()
+	}
+}
+
+// follow writes the response of f once its leader is done, unless the
+// request goes away first, and returns the number of rows it holds; ok is
+// false if none was written.
+func (f *queryFlight) follow(c *gin.Context) (rowCount int, ok bool) {
+	select {
+	case <-f.done:
+	case <-c.Request.Context().Done():
+		return 0, false
+	}
+	coalescedQueries.Add(1)
+	c.Data(f.status, f.contentType, f.body)
+	return f.rowCount, true
+}
+
+// flightWriter keeps a copy of the response it writes.
+type flightWriter struct {
+	gin.ResponseWriter
+	body []byte
+}
+
+func (w *flightWriter) Write(p []byte) (int, error) {
+	w.body = append(w.body, p...)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *flightWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
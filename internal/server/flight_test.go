@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestFlightsOnlyShareExactCredentials(t *testing.T) {
+	g := &flightGroup{flights: map[string]*queryFlight{}}
+	leader := preparedQuery{
+		query: "SELECT SLEEP(1)",
+		creds: dbCredentials{Username: "app", Password: "secret", Host: "db", Port: "3306"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, lead := g.join(ctx, cacheKey(leader)); !lead {
+		t.Fatal("first request does not lead its flight")
+	}
+
+	if _, lead := g.join(ctx, cacheKey(leader)); lead {
+		t.Error("identical request does not follow the running flight")
+	}
+	wrong := leader
+	wrong.creds.Password = "guess"
+	if _, lead := g.join(ctx, cacheKey(wrong)); !lead {
+		t.Error("request with a wrong password follows the leader's flight")
+	}
+}
+
+func TestCoalescedFollowersAreRecorded(t *testing.T) {
+	s := newTestServer()
+	withAudit(t, s)
+	mock := withMockDB(t, s)
+	const query = "SELECT a FROM t"
+	mock.ExpectQuery(query).WillDelayFor(200 * time.Millisecond).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(2))
+	body := `{` + credentialsJSON + `,"query":"` + query + `"}`
+
+	led := make(chan *httptest.ResponseRecorder)
+	go func() { led <- postJSON(t, s, "/api/v1/execute-query", body) }()
+	for {
+		s.queryFlights.mu.Lock()
+		running := len(s.queryFlights.flights)
+		s.queryFlights.mu.Unlock()
+		if running > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	followed := postJSON(t, s, "/api/v1/execute-query", body)
+	for _, w := range []*httptest.ResponseRecorder{<-led, followed} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	rows, err := s.auditDB.Query("SELECT query, status, row_count FROM audit_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	recorded := 0
+	for rows.Next() {
+		var got, status string
+		var count int
+		if err := rows.Scan(&got, &status, &count); err != nil {
+			t.Fatal(err)
+		}
+		if got != query || status != "success" || count != 2 {
+			t.Errorf("audit entry = %q, %s with %d rows", got, status, count)
+		}
+		recorded++
+	}
+	if recorded != 2 {
+		t.Errorf("%d requests recorded, want the leader and its follower", recorded)
+	}
+}
+
+func TestCoalescableLeavesOutRequestOptions(t *testing.T) {
+	s := newTestServer()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/execute-query", nil)
+	if !s.coalescable(c, &queryRequest{}, "SELECT 1") {
+		t.Fatal("plain SELECT is not coalesced")
+	}
+	for name, req := range map[string]queryRequest{
+		"snapshot": {Snapshot: true},
+		"retries":  {Retries: &retryOptions{Max: 1}},
+		"timeout":  {TimeoutSeconds: 5},
+	} {
+		if s.coalescable(c, &req, "SELECT 1") {
+			t.Errorf("SELECT with %s is coalesced", name)
+		}
+	}
+}
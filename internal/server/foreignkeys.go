@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type foreignKeysRequest struct {
+	connectionRef
+	// Table limits the result to the foreign keys of one table
+	Table string `json:"table"`
+}
+
+// foreignKey is a foreign key constraint; the columns are in key order.
+type foreignKey struct {
+	Name              string   `json:"name"`
+	Table             string   `json:"table"`
+	Columns           []string `json:"columns"`
+	ReferencedSchema  string   `json:"referenced_schema"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+	OnUpdate          string   `json:"on_update"`
+	OnDelete          string   `json:"on_delete"`
+}
+
+const foreignKeysQuery = `SELECT k.CONSTRAINT_NAME, k.TABLE_NAME, k.COLUMN_NAME,
+	k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME,
+	r.UPDATE_RULE, r.DELETE_RULE
+FROM information_schema.KEY_COLUMN_USAGE k
+JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+	ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA
+	AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+	AND r.TABLE_NAME = k.TABLE_NAME
+WHERE k.TABLE_SCHEMA = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL`
+
+// listForeignKeys returns the foreign keys of the connection's database,
+// or of one of its tables, for drawing relationships between tables.
+func (s *Server) listForeignKeys(c *gin.Context) {
+	var req foreignKeysRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+	if creds.Database == "" {
+		respondBadRequest(c, "The connection has no database selected")
+		return
+	}
+
+	keys, err := readForeignKeys(c.Request.Context(), db, creds.Database, req.Table)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"foreign_keys": keys})
+}
+
+// readForeignKeys returns the foreign keys of the tables of schema, or of
+// table alone unless it is "".
+func readForeignKeys(ctx context.Context, q queryer, schema, table string) ([]*foreignKey, error) {
+	query := foreignKeysQuery
+	args := []any{schema}
+	if table != "" {
+		query += " AND k.TABLE_NAME = ?"
+		args = append(args, table)
+	}
+	query += " ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION"
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*foreignKey{}
+	var last *foreignKey
+	for rows.Next() {
+		var fk foreignKey
+		var column, referencedColumn string
+		err := rows.Scan(&fk.Name, &fk.Table, &column,
+			&fk.ReferencedSchema, &fk.ReferencedTable, &referencedColumn,
+			&fk.OnUpdate, &fk.OnDelete)
+		if err != nil {
+			return nil, err
+		}
+		// The rows of a multi-column key are adjacent
+		if last == nil || last.Table != fk.Table || last.Name != fk.Name {
+			last = &fk
+			keys = append(keys, last)
+		}
+		last.Columns = append(last.Columns, column)
+		last.ReferencedColumns = append(last.ReferencedColumns, referencedColumn)
+	}
+	return keys, rows.Err()
+}
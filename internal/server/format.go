@@ -0,0 +1,521 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultFormatWidth = 80
+	formatIndent       = "  "
+)
+
+// formatKeywords are the words whose case the formatter normalises. They
+// are MySQL reserved words (plus a few, such as END and ROLLUP, used in
+// constructs the formatter lays out) that cannot be bare identifiers, so
+// recasing them cannot change which table or column a query refers to.
+var formatKeywords = toSet(
+	"ALL", "ALTER", "AND", "AS", "ASC", "BETWEEN", "BY", "CALL", "CASE", "CHECK",
+	"CONSTRAINT", "CREATE", "CROSS", "DATABASE", "DEFAULT", "DELETE", "DESC",
+	"DESCRIBE", "DISTINCT", "DISTINCTROW", "DIV", "DROP", "DUPLICATE", "ELSE", "END", "EXCEPT",
+	"EXISTS", "EXPLAIN", "FALSE", "FOREIGN", "FOR", "FROM", "FULL", "GROUP",
+	"HAVING", "IF", "IN", "INDEX", "INNER", "INSERT", "INTERSECT", "INTERVAL",
+	"INTO", "IS", "JOIN", "KEY", "LEFT", "LIKE", "LIMIT", "LOCK", "MOD", "NATURAL",
+	"NOT", "NULL", "OFFSET", "ON", "OR", "ORDER", "OUTER", "OVER", "PARTITION",
+	"PRIMARY", "REFERENCES", "REGEXP", "REPLACE", "RIGHT", "RLIKE", "ROLLUP", "SELECT", "SET",
+	"SHOW", "STRAIGHT_JOIN", "TABLE", "THEN", "TRUE", "UNION", "UNIQUE", "UPDATE",
+	"USING", "VALUES", "WHEN", "WHERE", "WINDOW", "WITH", "XOR",
+)
+
+// listClauses are the clauses whose comma-separated items are put one per
+// line when they do not fit within the width.
+var listClauses = toSet("SELECT", "GROUP BY", "ORDER BY", "SET", "ON DUPLICATE KEY UPDATE")
+
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+type formatRequest struct {
+	Query string `json:"query"`
+	// Width is the line length above which list clauses are broken one
+	// item per line; it defaults to 80
+	Width int `json:"width"`
+	// KeywordCase is "upper" (the default), "lower" or "preserve"
+	KeywordCase string `json:"keyword_case"`
+}
+
+// formatSQLHandler pretty-prints a query. SQL the formatter cannot handle
+// is returned unchanged with formatted set to false.
+func formatSQLHandler(c *gin.Context) {
+	var req formatRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Width == 0 {
+		req.Width = defaultFormatWidth
+	}
+	switch req.KeywordCase {
+	case "":
+		req.KeywordCase = "upper"
+	case "upper", "lower", "preserve":
+	default:
+		respondBadRequest(c, "keyword_case must be upper, lower or preserve")
+		return
+	}
+
+	out, err := formatSQL(req.Query, req.Width, req.KeywordCase)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"query": req.Query, "formatted": false, "reason": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"query": out, "formatted": true})
+}
+
+var (
+	errUnbalancedParens = errors.New("unbalanced parentheses")
+	errDelimiter        = errors.New("DELIMITER scripts are not supported")
+	errNotStatement     = errors.New("statement does not start with a keyword")
+	errFormatChanged    = errors.New("formatting would change the query")
+)
+
+// formatSQL re-lays out query by changing only the whitespace between
+// tokens and the case of keywords. As a safeguard the result is
+// tokenized again and must match the input token for token.
+func formatSQL(query string, width int, keywordCase string) (string, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return "", err
+	}
+
+	f := &sqlFormatter{width: width, keywordCase: keywordCase}
+	for i, t := range tokens {
+		if t.is(tokWhitespace) {
+			continue
+		}
+		f.items = append(f.items, formatItem{tok: t, spaced: i > 0 && tokens[i-1].is(tokWhitespace)})
+	}
+	if err := f.format(); err != nil {
+		return "", err
+	}
+	out := f.out.String()
+
+	formatted, err := tokenizeSQL(out)
+	if err != nil || !sameTokens(tokens, formatted) {
+		return "", errFormatChanged
+	}
+	return out, nil
+}
+
+// sameTokens compares two token streams ignoring whitespace and the case
+// of words.
+func sameTokens(a, b []sqlToken) bool {
+	var x, y []sqlToken
+	for _, t := range a {
+		if !t.is(tokWhitespace) {
+			x = append(x, t)
+		}
+	}
+	for _, t := range b {
+		if !t.is(tokWhitespace) {
+			y = append(y, t)
+		}
+	}
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i].kind != y[i].kind {
+			return false
+		}
+		if x[i].is(tokWord) && strings.EqualFold(x[i].text, y[i].text) {
+			continue
+		}
+		if x[i].text != y[i].text {
+			return false
+		}
+	}
+	return true
+}
+
+// formatItem is a non-whitespace token and whether the source had
+// whitespace before it.
+type formatItem struct {
+	tok    sqlToken
+	spaced bool
+}
+
+// formatFrame is the state of one (sub)query being laid out.
+type formatFrame struct {
+	level     int    // indentation of the frame's clause keywords
+	parens    int    // plain parentheses currently open in the frame
+	clause    string // the clause being written, such as "WHERE"
+	breakList bool   // put the clause's comma-separated items one per line
+	between   bool   // a BETWEEN is waiting for its AND
+}
+
+type sqlFormatter struct {
+	width       int
+	keywordCase string
+	items       []formatItem
+	frames      []*formatFrame
+	out         strings.Builder
+
+	lineLevel    int  // indentation of the current line
+	lineLen      int  // length of the current line
+	pending      bool // the next token starts a new line
+	pendingLevel int
+	pendingBlank bool // ... preceded by a blank line
+	last         sqlToken
+	lastUnary    bool
+}
+
+func (f *sqlFormatter) frame() *formatFrame { return f.frames[len(f.frames)-1] }
+
+func (f *sqlFormatter) format() error {
+	f.frames = []*formatFrame{{}}
+	statementStart := true
+
+	for i := 0; i < len(f.items); i++ {
+		item := f.items[i]
+		t := item.tok
+		fr := f.frame()
+
+		if statementStart && t.significant() {
+			statementStart = false
+			if t.isWord("DELIMITER") {
+				return errDelimiter
+			}
+			if !t.is(tokWord) && !t.isSymbol("(") {
+				return errNotStatement
+			}
+		}
+
+		if t.is(tokComment) {
+			f.write(i)
+			if !strings.HasPrefix(t.text, "/*") {
+				f.breakLine(f.contentLevel())
+			}
+			continue
+		}
+
+		if t.is(tokSymbol) {
+			switch t.text {
+			case "(":
+				f.write(i)
+				if f.isSubquery(i) {
+					f.frames = append(f.frames, &formatFrame{level: f.lineLevel + 1})
+				} else {
+					fr.parens++
+				}
+				continue
+			case ")":
+				switch {
+				case fr.parens > 0:
+					fr.parens--
+				case len(f.frames) > 1:
+					f.frames = f.frames[:len(f.frames)-1]
+					f.breakLine(fr.level - 1)
+				default:
+					return errUnbalancedParens
+				}
+				f.write(i)
+				continue
+			case ",":
+				f.write(i)
+				if fr.parens == 0 && fr.breakList {
+					f.breakLine(fr.level + 1)
+				}
+				continue
+			case ";":
+				if len(f.frames) > 1 || fr.parens > 0 {
+					return errUnbalancedParens
+				}
+				f.write(i)
+				*fr = formatFrame{}
+				f.breakLine(0)
+				f.pendingBlank = true
+				statementStart = true
+				continue
+			}
+		}
+
+		if t.is(tokWord) && fr.parens == 0 {
+			if clause, n := f.clauseAt(i); clause != "" {
+				f.writeClause(i, clause, n)
+				i += n - 1
+				continue
+			}
+			switch {
+			case t.isWord("BETWEEN"):
+				fr.between = true
+			case (t.isWord("AND") || t.isWord("OR")) && (fr.clause == "WHERE" || fr.clause == "HAVING"):
+				if t.isWord("AND") && fr.between {
+					fr.between = false
+					break
+				}
+				f.breakLine(fr.level + 1)
+			}
+		}
+		f.write(i)
+	}
+
+	if len(f.frames) > 1 || f.frame().parens > 0 {
+		return errUnbalancedParens
+	}
+	return nil
+}
+
+// writeClause starts a new line for the n-word clause keyword at items[i].
+func (f *sqlFormatter) writeClause(i int, clause string, n int) {
+	fr := f.frame()
+	fr.clause, fr.between, fr.breakList = clause, false, false
+
+	level := fr.level
+	if strings.HasSuffix(clause, "JOIN") {
+		level++
+	}
+	f.breakLine(level)
+	for j := i; j < i+n; j++ {
+		f.write(j)
+	}
+
+	if !listClauses[clause] {
+		return
+	}
+	start := i + n
+	// Modifiers such as DISTINCT stay on the keyword's line
+	for start < len(f.items) && clause == "SELECT" && isSelectModifier(f.items[start].tok) {
+		f.write(start)
+		start++
+	}
+	inlineLen, commas, nested := f.listExtent(start)
+	if commas && (nested || f.lineLen+inlineLen > f.width) {
+		fr.breakList = true
+		f.breakLine(fr.level + 1)
+	}
+}
+
+func isSelectModifier(t sqlToken) bool {
+	for _, m := range []string{"DISTINCT", "DISTINCTROW", "ALL", "HIGH_PRIORITY", "STRAIGHT_JOIN", "SQL_CALC_FOUND_ROWS", "SQL_NO_CACHE", "SQL_CACHE"} {
+		if t.isWord(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// listExtent measures the clause items starting at items[start]: their
+// length when written on one line, whether they contain a top-level comma,
+// and whether they contain a subquery or line comment that forces breaks.
+func (f *sqlFormatter) listExtent(start int) (length int, commas, nested bool) {
+	depth := 0
+	for i := start; i < len(f.items); i++ {
+		t := f.items[i].tok
+		switch {
+		case t.isSymbol("("):
+			if f.isSubquery(i) {
+				nested = true
+			}
+			depth++
+		case t.isSymbol(")"):
+			if depth == 0 {
+				return
+			}
+			depth--
+		case t.isSymbol(";"):
+			return
+		case t.isSymbol(",") && depth == 0:
+			commas = true
+		case t.is(tokComment) && !strings.HasPrefix(t.text, "/*"):
+			nested = true
+		case depth == 0 && t.is(tokWord):
+			if clause, _ := f.clauseAt(i); clause != "" {
+				return
+			}
+		}
+		length += len(t.text) + 1
+	}
+	return
+}
+
+// clauseAt reports the clause keyword starting at items[i], if any, and
+// how many words it spans.
+func (f *sqlFormatter) clauseAt(i int) (string, int) {
+	word := strings.ToUpper(f.items[i].tok.text)
+	next := func(k int) sqlToken {
+		if i+k < len(f.items) {
+			return f.items[i+k].tok
+		}
+		return sqlToken{}
+	}
+	prev := sqlToken{}
+	if i > 0 {
+		prev = f.items[i-1].tok
+	}
+
+	switch word {
+	case "SELECT", "FROM", "WHERE", "HAVING", "LIMIT", "DELETE", "WINDOW":
+		return word, 1
+	case "UPDATE":
+		if prev.isWord("FOR") {
+			return "", 0 // SELECT ... FOR UPDATE
+		}
+		return word, 1
+	case "INSERT", "REPLACE":
+		if next(1).isSymbol("(") {
+			return "", 0 // the string functions of the same name
+		}
+		return word, 1
+	case "WITH":
+		if next(1).isWord("ROLLUP") {
+			return "", 0
+		}
+		return word, 1
+	case "SET":
+		if prev.isWord("CHARACTER") || prev.isWord("CHARSET") {
+			return "", 0
+		}
+		return word, 1
+	case "VALUES":
+		// VALUES(col) inside ON DUPLICATE KEY UPDATE is a function
+		if prev.isSymbol("=") || prev.isSymbol(",") || prev.isSymbol("(") {
+			return "", 0
+		}
+		return word, 1
+	case "ON":
+		if next(1).isWord("DUPLICATE") && next(2).isWord("KEY") && next(3).isWord("UPDATE") {
+			return "ON DUPLICATE KEY UPDATE", 4
+		}
+	case "GROUP", "ORDER":
+		if next(1).isWord("BY") {
+			return word + " BY", 2
+		}
+	case "UNION", "EXCEPT", "INTERSECT":
+		if next(1).isWord("ALL") || next(1).isWord("DISTINCT") {
+			return word + " " + strings.ToUpper(next(1).text), 2
+		}
+		return word, 1
+	case "JOIN", "STRAIGHT_JOIN":
+		return word, 1
+	case "NATURAL", "LEFT", "RIGHT", "FULL", "INNER", "CROSS", "OUTER":
+		// A run of join modifiers only counts if it ends in JOIN
+		for n := 1; n < 4; n++ {
+			t := next(n)
+			if t.isWord("JOIN") {
+				words := make([]string, n+1)
+				for k := range words {
+					words[k] = strings.ToUpper(next(k).text)
+				}
+				return strings.Join(words, " "), n + 1
+			}
+			if !t.isWord("OUTER") && !t.isWord("LEFT") && !t.isWord("RIGHT") && !t.isWord("INNER") {
+				break
+			}
+		}
+	}
+	return "", 0
+}
+
+// isSubquery reports whether the parenthesis at items[i] opens a query.
+func (f *sqlFormatter) isSubquery(i int) bool {
+	for j := i + 1; j < len(f.items); j++ {
+		t := f.items[j].tok
+		if t.is(tokComment) {
+			continue
+		}
+		return t.isWord("SELECT") || t.isWord("WITH")
+	}
+	return false
+}
+
+// isUnary reports whether the sign or negation at items[i] applies to the
+// following operand rather than joining two.
+func (f *sqlFormatter) isUnary(i int) bool {
+	t := f.items[i].tok
+	if !t.isSymbol("-") && !t.isSymbol("+") && !t.isSymbol("~") && !t.isSymbol("!") {
+		return false
+	}
+	for j := i - 1; j >= 0; j-- {
+		p := f.items[j].tok
+		if p.is(tokComment) {
+			continue
+		}
+		if p.is(tokSymbol) {
+			return p.text != ")"
+		}
+		return p.is(tokWord) && formatKeywords[strings.ToUpper(p.text)]
+	}
+	return true
+}
+
+// spaceBefore decides whether items[i] is separated from the token
+// written before it.
+func (f *sqlFormatter) spaceBefore(i int) bool {
+	t := f.items[i].tok
+	last := f.last
+	switch {
+	case t.isSymbol(",") || t.isSymbol(";") || t.isSymbol(")") || t.isSymbol("."):
+		return false
+	case last.isSymbol("(") || last.isSymbol("."):
+		return false
+	case t.isSymbol("(") && (last.is(tokWord) || last.is(tokQuotedIdent)):
+		// COUNT (x) is an error unless IGNORE_SPACE is set, so keep
+		// function calls exactly as written
+		return f.items[i].spaced
+	case f.lastUnary:
+		return f.items[i].spaced
+	}
+	return true
+}
+
+func (f *sqlFormatter) contentLevel() int {
+	if f.frame().clause != "" {
+		return f.frame().level + 1
+	}
+	return f.frame().level
+}
+
+func (f *sqlFormatter) breakLine(level int) {
+	f.pending, f.pendingLevel = true, level
+}
+
+// write appends items[i], starting a pending line or adding the space
+// that spaceBefore calls for.
+func (f *sqlFormatter) write(i int) {
+	t := f.items[i].tok
+	text := t.text
+	if t.is(tokWord) && formatKeywords[strings.ToUpper(text)] {
+		switch f.keywordCase {
+		case "upper":
+			text = strings.ToUpper(text)
+		case "lower":
+			text = strings.ToLower(text)
+		}
+	}
+
+	switch {
+	case f.pending && f.out.Len() > 0:
+		f.out.WriteString("\n")
+		if f.pendingBlank {
+			f.out.WriteString("\n")
+		}
+		fallthrough
+	case f.pending:
+		f.out.WriteString(strings.Repeat(formatIndent, f.pendingLevel))
+		f.lineLevel, f.lineLen = f.pendingLevel, len(formatIndent)*f.pendingLevel
+		f.pending, f.pendingBlank = false, false
+	case f.out.Len() > 0 && (t.is(tokComment) || f.spaceBefore(i)):
+		f.out.WriteString(" ")
+		f.lineLen++
+	}
+	f.out.WriteString(text)
+	f.lineLen += len(text)
+	f.last, f.lastUnary = t, f.isUnary(i)
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Spatial formats a query's spatial_format can ask for.
+const (
+	spatialWKT     = "wkt"
+	spatialGeoJSON = "geojson"
+)
+
+// WKB geometry types. MySQL only stores two-dimensional geometries.
+const (
+	wkbPoint              = 1
+	wkbLineString         = 2
+	wkbPolygon            = 3
+	wkbMultiPoint         = 4
+	wkbMultiLineString    = 5
+	wkbMultiPolygon       = 6
+	wkbGeometryCollection = 7
+)
+
+var wkbTypeNames = map[uint32][2]string{
+	wkbPoint:              {"POINT", "Point"},
+	wkbLineString:         {"LINESTRING", "LineString"},
+	wkbPolygon:            {"POLYGON", "Polygon"},
+	wkbMultiPoint:         {"MULTIPOINT", "MultiPoint"},
+	wkbMultiLineString:    {"MULTILINESTRING", "MultiLineString"},
+	wkbMultiPolygon:       {"MULTIPOLYGON", "MultiPolygon"},
+	wkbGeometryCollection: {"GEOMETRYCOLLECTION", "GeometryCollection"},
+}
+
+// maxGeometryDepth bounds how deeply collections may nest, so a crafted
+// value cannot exhaust the stack.
+const maxGeometryDepth = 32
+
+var errInvalidWKB = errors.New("invalid WKB")
+
+// geometry is a parsed WKB value. A point, line string or ring is a list
+// of points; a polygon is a list of rings; the multi types and collections
+// are lists of parts.
+type geometry struct {
+	typ    uint32
+	points [][2]float64
+	rings  [][][2]float64
+	parts  []geometry
+}
+
+// geometryValue returns a GEOMETRY value, which MySQL sends as a 4-byte
+// SRID followed by WKB, as WKT or, with geoJSON, as a GeoJSON object. The
+// SRID is dropped, as ST_AsText and RFC 7946 GeoJSON do. A value that does
+// not parse is returned base64-encoded.
+func geometryValue(val any, geoJSON bool) any {
+	raw, ok := val.([]byte)
+	if !ok {
+		return convertValue(val)
+	}
+	g, err := parseGeometry(raw)
+	if err != nil {
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+	if !geoJSON {
+		return g.wkt()
+	}
+	data, err := json.Marshal(g.geoJSON())
+	if err != nil {
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+	return json.RawMessage(data)
+}
+
+// parseGeometry parses MySQL's internal geometry format.
+func parseGeometry(raw []byte) (geometry, error) {
+	if len(raw) < 4 {
+		return geometry{}, errInvalidWKB
+	}
+	r := &wkbReader{b: raw[4:]}
+	g, err := r.geometry(0)
+	if err != nil {
+		return geometry{}, err
+	}
+	if len(r.b) != 0 {
+		return geometry{}, errInvalidWKB
+	}
+	return g, nil
+}
+
+// wkbReader consumes WKB from b, in the byte order of the geometry being
+// read.
+type wkbReader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func (r *wkbReader) geometry(depth int) (geometry, error) {
+	if depth > maxGeometryDepth || len(r.b) < 5 {
+		return geometry{}, errInvalidWKB
+	}
+	switch r.b[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return geometry{}, errInvalidWKB
+	}
+	r.b = r.b[1:]
+	g := geometry{typ: r.order.Uint32(r.b)}
+	r.b = r.b[4:]
+
+	var err error
+	switch g.typ {
+	case wkbPoint:
+		var p [2]float64
+		p, err = r.point()
+		g.points = [][2]float64{p}
+	case wkbLineString:
+		g.points, err = r.pointList()
+	case wkbPolygon:
+		g.rings, err = r.rings()
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon, wkbGeometryCollection:
+		g.parts, err = r.parts(g.typ, depth)
+	default:
+		err = errInvalidWKB
+	}
+	return g, err
+}
+
+// count reads an element count, rejecting one that the remaining bytes
+// cannot hold at size bytes an element.
+func (r *wkbReader) count(size int) (int, error) {
+	if len(r.b) < 4 {
+		return 0, errInvalidWKB
+	}
+	n := r.order.Uint32(r.b)
+	r.b = r.b[4:]
+	if uint64(n)*uint64(size) > uint64(len(r.b)) {
+		return 0, errInvalidWKB
+	}
+	return int(n), nil
+}
+
+func (r *wkbReader) point() ([2]float64, error) {
+	if len(r.b) < 16 {
+		return [2]float64{}, errInvalidWKB
+	}
+	x := math.Float64frombits(r.order.Uint64(r.b))
+	y := math.Float64frombits(r.order.Uint64(r.b[8:]))
+	r.b = r.b[16:]
+	// Neither is valid in MySQL, nor encodable as JSON
+	if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return [2]float64{}, errInvalidWKB
+	}
+	return [2]float64{x, y}, nil
+}
+
+func (r *wkbReader) pointList() ([][2]float64, error) {
+	n, err := r.count(16)
+	if err != nil {
+		return nil, err
+	}
+	points := make([][2]float64, n)
+	for i := range points {
+		if points[i], err = r.point(); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (r *wkbReader) rings() ([][][2]float64, error) {
+	n, err := r.count(4)
+	if err != nil {
+		return nil, err
+	}
+	rings := make([][][2]float64, n)
+	for i := range rings {
+		if rings[i], err = r.pointList(); err != nil {
+			return nil, err
+		}
+	}
+	return rings, nil
+}
+
+// parts reads the members of a multi geometry of type typ, each a full
+// WKB geometry with its own byte order.
+func (r *wkbReader) parts(typ uint32, depth int) ([]geometry, error) {
+	n, err := r.count(5)
+	if err != nil {
+		return nil, err
+	}
+	order := r.order
+	parts := make([]geometry, n)
+	for i := range parts {
+		if parts[i], err = r.geometry(depth + 1); err != nil {
+			return nil, err
+		}
+		if typ != wkbGeometryCollection && parts[i].typ != typ-3 {
+			return nil, errInvalidWKB
+		}
+	}
+	r.order = order
+	return parts, nil
+}
+
+// wkt formats g as MySQL's ST_AsText does.
+func (g geometry) wkt() string {
+	var b strings.Builder
+	b.WriteString(wkbTypeNames[g.typ][0])
+	if g.empty() {
+		b.WriteString(" EMPTY")
+		return b.String()
+	}
+	g.writeWKT(&b)
+	return b.String()
+}
+
+func (g geometry) empty() bool {
+	return len(g.points) == 0 && len(g.rings) == 0 && len(g.parts) == 0
+}
+
+// writeWKT writes the parenthesised body of g, without its type name.
+func (g geometry) writeWKT(b *strings.Builder) {
+	b.WriteByte('(')
+	switch g.typ {
+	case wkbPoint, wkbLineString:
+		writeWKTPoints(b, g.points)
+	case wkbPolygon:
+		writeWKTRings(b, g.rings)
+	default:
+		for i, part := range g.parts {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if g.typ == wkbGeometryCollection {
+				b.WriteString(part.wkt())
+			} else {
+				part.writeWKT(b)
+			}
+		}
+	}
+	b.WriteByte(')')
+}
+
+func writeWKTPoints(b *strings.Builder, points [][2]float64) {
+	for i, p := range points {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(p[0], 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(p[1], 'g', -1, 64))
+	}
+}
+
+func writeWKTRings(b *strings.Builder, rings [][][2]float64) {
+	for i, ring := range rings {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('(')
+		writeWKTPoints(b, ring)
+		b.WriteByte(')')
+	}
+}
+
+// geoJSON returns g as a GeoJSON geometry object.
+func (g geometry) geoJSON() map[string]any {
+	obj := map[string]any{"type": wkbTypeNames[g.typ][1]}
+	if g.typ == wkbGeometryCollection {
+		geometries := make([]map[string]any, len(g.parts))
+		for i, part := range g.parts {
+			geometries[i] = part.geoJSON()
+		}
+		obj["geometries"] = geometries
+		return obj
+	}
+	obj["coordinates"] = g.coordinates()
+	return obj
+}
+
+// coordinates is the GeoJSON coordinates member of g.
+func (g geometry) coordinates() any {
+	switch g.typ {
+	case wkbPoint:
+		return g.points[0]
+	case wkbLineString:
+		return g.points
+	case wkbPolygon:
+		return g.rings
+	default:
+		coords := make([]any, len(g.parts))
+		for i, part := range g.parts {
+			coords[i] = part.coordinates()
+		}
+		return coords
+	}
+}
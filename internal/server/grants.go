@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// account is a row of mysql.user.
+type account struct {
+	User          string `json:"user"`
+	Host          string `json:"host"`
+	Plugin        string `json:"plugin"`
+	AccountLocked bool   `json:"account_locked"`
+}
+
+// grant is one privilege of a SHOW GRANTS statement. Level is global,
+// database, table, routine, proxy or role; Target is the object it
+// applies to, without quotes.
+type grant struct {
+	Privilege   string   `json:"privilege"`
+	Columns     []string `json:"columns,omitempty"`
+	Level       string   `json:"level"`
+	Target      string   `json:"target"`
+	GrantOption bool     `json:"grant_option"`
+}
+
+type grantsRequest struct {
+	connectionRef
+	// User and Host name the account; the connected account when User is
+	// empty. Host defaults to %.
+	User string `json:"user"`
+	Host string `json:"host"`
+}
+
+// listUsers returns the accounts in mysql.user, which only accounts with
+// access to the mysql schema can read.
+func (s *Server) listUsers(c *gin.Context) {
+	var req connectionRef
+	if !bindJSON(c, &req) {
+		return
+	}
+	db, _, ok := s.openConnection(c, req)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(),
+		"SELECT User, Host, plugin, account_locked FROM mysql.user ORDER BY User, Host")
+	if err != nil {
+		respondPrivilegeError(c, err, "The connected account cannot read mysql.user")
+		return
+	}
+	defer rows.Close()
+	accounts := []account{}
+	for rows.Next() {
+		var a account
+		var locked sql.NullString
+		if err := rows.Scan(&a.User, &a.Host, &a.Plugin, &locked); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		a.AccountLocked = strings.EqualFold(locked.String, "Y")
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": accounts})
+}
+
+// showGrants returns the grants of an account, both as the statements
+// SHOW GRANTS prints and broken down into one entry per privilege.
+func (s *Server) showGrants(c *gin.Context) {
+	var req grantsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	stmt := "SHOW GRANTS"
+	if req.User != "" {
+		if req.Host == "" {
+			req.Host = "%"
+		}
+		stmt += " FOR " + quoteString(req.User) + "@" + quoteString(req.Host)
+	}
+
+	db, _, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+
+	statements, grants, err := readGrants(c.Request.Context(), db, stmt)
+	if err != nil {
+		respondPrivilegeError(c, err, "The connected account cannot show the grants of "+req.User)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"statements": statements, "grants": grants})
+}
+
+// readGrants runs a SHOW GRANTS statement and parses its lines.
+func readGrants(ctx context.Context, db *sql.DB, stmt string) ([]string, []grant, error) {
+	rows, err := db.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	statements := []string{}
+	grants := []grant{}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, nil, err
+		}
+		statements = append(statements, line)
+		parsed, err := parseGrant(line)
+		if err != nil {
+			// Keep the statement even when its form is not understood
+			continue
+		}
+		grants = append(grants, parsed...)
+	}
+	return statements, grants, rows.Err()
+}
+
+// readPrivileges are the privileges that change neither data nor schema.
+var readPrivileges = map[string]bool{
+	"USAGE":              true,
+	"SELECT":             true,
+	"SHOW VIEW":          true,
+	"SHOW DATABASES":     true,
+	"PROCESS":            true,
+	"REPLICATION CLIENT": true,
+}
+
+// currentPrivileges reports what the connected account may do: its
+// grants, the privileges that apply to the connection's database, and
+// whether any of them can write. Privileges the account only has through
+// roles are not expanded.
+func (s *Server) currentPrivileges(c *gin.Context) {
+	var req connectionRef
+	if !bindJSON(c, &req) {
+		return
+	}
+	if driverName != "mysql" {
+		respondError(c, http.StatusNotImplemented, codeUnavailable, "Privileges can only be read from MySQL")
+		return
+	}
+	db, creds, ok := s.openConnection(c, req)
+	if !ok {
+		return
+	}
+
+	statements, grants, err := readGrants(c.Request.Context(), db, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	privileges := []string{}
+	canWrite := false
+	for _, g := range grants {
+		applies := g.Level == "global" || g.Level == "database" && creds.Database != "" && g.Target == creds.Database+".*"
+		if !applies || slices.Contains(privileges, g.Privilege) {
+			continue
+		}
+		privileges = append(privileges, g.Privilege)
+		canWrite = canWrite || !readPrivileges[g.Privilege]
+	}
+	slices.Sort(privileges)
+	c.JSON(http.StatusOK, gin.H{
+		"statements": statements,
+		"grants":     grants,
+		"database":   creds.Database,
+		"privileges": privileges,
+		"can_write":  canWrite && !creds.ReadOnly,
+	})
+}
+
+// respondPrivilegeError reports err, with message in place of the server's
+// when the connected account lacks the privilege.
+func respondPrivilegeError(c *gin.Context, err error, message string) {
+	status, body := classifyDBError(err)
+	if body.Code == codeAccessDenied {
+		body.Detail, body.Message = body.Message, message
+	}
+	respondAPIError(c, status, body)
+}
+
+var errUnknownGrant = errors.New("unrecognized GRANT statement")
+
+// parseGrant breaks a SHOW GRANTS line such as
+//
+//	GRANT SELECT (id, name), INSERT ON `shop`.`orders` TO `app`@`%` WITH GRANT OPTION
+//
+// into its privileges. Role grants, which have no ON clause, come back with
+// the role as the privilege.
+func parseGrant(line string) ([]grant, error) {
+	tokens, err := tokenizeSQL(line)
+	if err != nil {
+		return nil, err
+	}
+	tokens = significantTokens(tokens)
+	if len(tokens) == 0 || !tokens[0].isWord("GRANT") {
+		return nil, errUnknownGrant
+	}
+
+	// The privilege list runs to ON, or to TO for role grants
+	var privileges [][]sqlToken
+	var current []sqlToken
+	depth, i := 0, 1
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if depth == 0 && (t.isWord("ON") || t.isWord("TO")) {
+			break
+		}
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		case t.isSymbol(",") && depth == 0:
+			privileges = append(privileges, current)
+			current = nil
+			continue
+		}
+		current = append(current, t)
+	}
+	privileges = append(privileges, current)
+	if i == len(tokens) {
+		return nil, errUnknownGrant
+	}
+
+	level, target := "role", ""
+	if tokens[i].isWord("ON") {
+		i++
+		var objectType string
+		if i < len(tokens) && (tokens[i].isWord("TABLE") || tokens[i].isWord("PROCEDURE") || tokens[i].isWord("FUNCTION")) {
+			objectType = strings.ToUpper(tokens[i].text)
+			i++
+		}
+		var parts, raw []string
+		for ; i < len(tokens) && !tokens[i].isWord("TO"); i++ {
+			parts = append(parts, unquoteGrantToken(tokens[i]))
+			raw = append(raw, tokens[i].text)
+		}
+		target = strings.Join(parts, "")
+		proxy := len(privileges) == 1 && len(privileges[0]) == 1 && privileges[0][0].isWord("PROXY")
+		if proxy {
+			target = unquoteAccount(strings.Join(raw, ""))
+		}
+		switch {
+		case target == "*.*" || target == "*":
+			level = "global"
+		case strings.HasSuffix(target, ".*"):
+			level = "database"
+		case objectType == "PROCEDURE" || objectType == "FUNCTION":
+			level = "routine"
+		case proxy:
+			level = "proxy"
+		default:
+			level = "table"
+		}
+	}
+	grantOption := strings.HasSuffix(strings.ToUpper(line), "WITH GRANT OPTION")
+
+	grants := make([]grant, 0, len(privileges))
+	for _, priv := range privileges {
+		g := grant{Level: level, Target: target, GrantOption: grantOption}
+		var words []string
+		inColumns := false
+		for _, t := range priv {
+			switch {
+			case t.isSymbol("("):
+				inColumns = true
+			case t.isSymbol(")"):
+				inColumns = false
+			case inColumns && !t.isSymbol(","):
+				g.Columns = append(g.Columns, unquoteGrantToken(t))
+			case !inColumns:
+				words = append(words, unquoteGrantToken(t))
+			}
+		}
+		if level == "role" {
+			var raw strings.Builder
+			for _, t := range priv {
+				raw.WriteString(t.text)
+			}
+			g.Privilege = unquoteAccount(raw.String())
+		} else {
+			g.Privilege = strings.ToUpper(strings.Join(words, " "))
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// unquoteGrantToken returns the text of t without its quotes.
+func unquoteGrantToken(t sqlToken) string {
+	switch {
+	case t.is(tokQuotedIdent):
+		return unquoteIdent(t.text)
+	case t.is(tokString) && len(t.text) >= 2:
+		q := t.text[:1]
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], q+q, q)
+	}
+	return t.text
+}
+
+// unquoteAccount turns an account or role as SHOW GRANTS prints it, such
+// as `app`@`%` or 'app'@'%', into app@%.
+func unquoteAccount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		q := s[i]
+		if q != '`' && q != '\'' && q != '"' {
+			b.WriteByte(q)
+			continue
+		}
+		for i++; i < len(s); i++ {
+			if s[i] == q {
+				if i+1 < len(s) && s[i+1] == q {
+					i++
+				} else {
+					break
+				}
+			}
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// quoteString quotes s as a string literal. Quotes are doubled rather
+// than backslash-escaped, so no quote in s can end the literal early even
+// under NO_BACKSLASH_ESCAPES.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", "''") + "'"
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// precompressedTypes are content types not worth compressing again.
+var precompressedTypes = []string{xlsxContentType, "application/zip", "application/gzip", "image/", "video/", "audio/"}
+
+// gzipMiddleware compresses responses for clients that accept gzip. The
+// first cfg.GzipMinSize bytes are held back, so small responses go out
+// uncompressed. WebSocket upgrades, HEAD and range requests are left alone.
+func (s *Server) gzipMiddleware(c *gin.Context) {
+	c.Header("Vary", "Accept-Encoding")
+	if !acceptsGzip(c.Request) || c.Request.Method == http.MethodHead ||
+		c.GetHeader("Upgrade") != "" || c.GetHeader("Range") != "" {
+		c.Next()
+		return
+	}
+
+	w := &gzipWriter{ResponseWriter: c.Writer, pool: &s.gzipWriters, minSize: s.cfg.GzipMinSize}
+	c.Writer = w
+	defer func() {
+		// Also when a panic unwinds, so what middleware further out
+		// writes goes straight to the client rather than into buf
+		w.finish()
+		c.Writer = w.ResponseWriter
+	}()
+	c.Next()
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") || name == "*" {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it knows whether it is
+// large enough to compress.
+type gzipWriter struct {
+	gin.ResponseWriter
+	// pool reuses gzip.Writers, which are costly to allocate, across
+	// responses
+	pool    *sync.Pool
+	minSize int
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool // set once the response is known to go out uncompressed
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(p)
+	case w.decided:
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written reports whether any of the response has been written, held back
+// in buf or not.
+func (w *gzipWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// start decides how to send the response and writes out the buffer.
+func (w *gzipWriter) start() error {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || isPrecompressed(h.Get("Content-Type")) {
+		w.decided = true
+	} else {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	_, err := w.Write(buf)
+	return err
+}
+
+// Flush sends what has been written so far, compressing it if it has to
+// go out before the threshold is reached. Streaming handlers flush after
+// each event, so compression never holds their output back.
+func (w *gzipWriter) Flush() {
+	if w.gz == nil && !w.decided {
+		w.start()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish completes the response: short responses are sent as they are.
+func (w *gzipWriter) finish() {
+	switch {
+	case w.gz != nil:
+		w.gz.Close()
+		w.pool.Put(w.gz)
+	case !w.decided && len(w.buf) > 0:
+		w.decided = true
+		w.ResponseWriter.Write(w.buf)
+	}
+}
+
+func isPrecompressed(contentType string) bool {
+	for _, t := range precompressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
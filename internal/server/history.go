@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyBucket holds one nested bucket per session, keyed by a big-endian
+// sequence number so that iteration order is execution order.
+const historyBucket = "history"
+
+const (
+	historyDefaultPerPage = 50
+	historyMaxPerPage     = 500
+)
+
+// historyEntry is one statement executed through the API.
+type historyEntry struct {
+	ID         uint64    `json:"id"`
+	Query      string    `json:"query"`
+	Host       string    `json:"host"`
+	Database   string    `json:"database"`
+	DurationMs int64     `json:"duration_ms"`
+	RowCount   int       `json:"row_count"`
+	Status     string    `json:"status"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+func historyKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// recordHistory appends entry to the session's history, trimming it to
+// cfg.HistoryLimit entries. Failures are logged rather than surfaced since
+// history must never fail a query.
+func (s *Server) recordHistory(session string, entry historyEntry) {
+	if !s.cfg.HistoryEnabled || s.store == nil || session == "" {
+		return
+	}
+
+	err := s.store.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket([]byte(historyBucket)).CreateBucketIfNotExists([]byte(session))
+		if err != nil {
+			return err
+		}
+		if entry.ID, err = b.NextSequence(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(historyKey(entry.ID), data); err != nil {
+			return err
+		}
+		return trimOldest(b, s.cfg.HistoryLimit)
+	})
+	if err != nil {
+		log.Printf("Failed to record query history: %s", sanitizeError(err))
+	}
+}
+
+// recordQuery records entry, run with creds for the session, in both the
+// session's history and the audit log. Every handler that runs statements
+// records them this way, so the two agree on what ran. Host and, unless
+// entry names the database the statement switched to, Database come from
+// creds.
+func (s *Server) recordQuery(ctx context.Context, session string, creds dbCredentials, entry historyEntry) {
+	entry.Host = creds.Host
+	if entry.Database == "" {
+		entry.Database = creds.Database
+	}
+	s.recordHistory(session, entry)
+	s.recordAudit(ctx, session, creds.Username, entry)
+}
+
+// recordHandlerQuery records stmt, run with creds from start, once the
+// handler of c has responded: a success if it answered 200.
+func (s *Server) recordHandlerQuery(c *gin.Context, creds dbCredentials, stmt string, start time.Time, rowCount int) {
+	s.recordQuery(c.Request.Context(), sessionID(c), creds, historyEntry{
+		Query:      stmt,
+		DurationMs: time.Since(start).Milliseconds(),
+		RowCount:   rowCount,
+		Status:     responseStatus(c),
+		ExecutedAt: start.UTC(),
+	})
+}
+
+// responseStatus is the history status of the response c sent.
+func responseStatus(c *gin.Context) string {
+	if c.Writer.Status() != http.StatusOK {
+		return "error"
+	}
+	return "success"
+}
+
+// trimOldest deletes the first keys of b, the oldest for sequence keys,
+// until at most keep are left.
+func trimOldest(b *bolt.Bucket, keep int) error {
+	// Deleting through a cursor while iterating skips keys in bbolt, so
+	// collect the oldest keys first.
+	excess := -keep
+	b.ForEach(func(_, _ []byte) error {
+		excess++
+		return nil
+	})
+	var stale [][]byte
+	cursor := b.Cursor()
+	for k, _ := cursor.First(); k != nil && len(stale) < excess; k, _ = cursor.Next() {
+		stale = append(stale, append([]byte(nil), k...))
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listHistory returns the session's history newest first, with page and
+// per_page pagination and an optional case-insensitive q filter on the
+// query text, host and database.
+func (s *Server) listHistory(c *gin.Context) {
+	if s.historyDisabled(c) {
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		respondBadRequest(c, "page must be a positive integer")
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(historyDefaultPerPage)))
+	if err != nil || perPage < 1 || perPage > historyMaxPerPage {
+		respondBadRequest(c, "per_page must be between 1 and "+strconv.Itoa(historyMaxPerPage))
+		return
+	}
+	search := strings.ToLower(c.Query("q"))
+
+	entries := []historyEntry{}
+	total := 0
+	skip := (page - 1) * perPage
+	err = s.historyView(c, func(b *bolt.Bucket) error {
+		cursor := b.Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			var entry historyEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if search != "" && !entry.matches(search) {
+				continue
+			}
+			total++
+			if total > skip && len(entries) < perPage {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history":  entries,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+func (e historyEntry) matches(search string) bool {
+	return strings.Contains(strings.ToLower(e.Query), search) ||
+		strings.Contains(strings.ToLower(e.Host), search) ||
+		strings.Contains(strings.ToLower(e.Database), search)
+}
+
+func (s *Server) historyDisabled(c *gin.Context) bool {
+	if s.cfg.HistoryEnabled {
+		return false
+	}
+	respondError(c, http.StatusNotFound, codeNotFound, "Query history is disabled on this server")
+	return true
+}
+
+// historyView runs fn on the session's history bucket, if it exists.
+func (s *Server) historyView(c *gin.Context, fn func(*bolt.Bucket) error) error {
+	if s.store == nil {
+		return errStoreClosed
+	}
+	return s.store.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(historyBucket)).Bucket([]byte(sessionID(c))); b != nil {
+			return fn(b)
+		}
+		return nil
+	})
+}
+
+func (s *Server) deleteHistoryEntry(c *gin.Context) {
+	if s.historyDisabled(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondBadRequest(c, "Invalid history id")
+		return
+	}
+	if s.store == nil {
+		respondStatusError(c, http.StatusServiceUnavailable, errStoreClosed)
+		return
+	}
+
+	found := false
+	err = s.store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket)).Bucket([]byte(sessionID(c)))
+		if b == nil || b.Get(historyKey(id)) == nil {
+			return nil
+		}
+		found = true
+		return b.Delete(historyKey(id))
+	})
+	if err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, codeNotFound, "History entry not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// clearHistory deletes the session's whole history.
+func (s *Server) clearHistory(c *gin.Context) {
+	if s.historyDisabled(c) {
+		return
+	}
+	if s.store == nil {
+		respondStatusError(c, http.StatusServiceUnavailable, errStoreClosed)
+		return
+	}
+
+	err := s.store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket))
+		if b.Bucket([]byte(sessionID(c))) == nil {
+			return nil
+		}
+		return b.DeleteBucket([]byte(sessionID(c)))
+	})
+	if err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idleReapInterval = 30 * time.Second
+	runningQueryKey  = "runningQuery"
+)
+
+// idleResource is a server-side resource that holds a connection, such as
+// a cursor, a sticky connection or a running query, and is closed once it
+// goes unused for longer than its timeout.
+type idleResource struct {
+	kind    string
+	id      string
+	timeout time.Duration
+	touched atomic.Int64 // UnixNano
+	// reap closes the resource. It returns false when the resource is busy,
+	// leaving it for the next round.
+	reap func() bool
+}
+
+// touch marks the resource as used now.
+func (res *idleResource) touch() {
+	res.touched.Store(time.Now().UnixNano())
+}
+
+func (res *idleResource) idle() time.Duration {
+	return time.Since(time.Unix(0, res.touched.Load()))
+}
+
+// idleReaper closes the resources left idle, so abandoned cursors and
+// queries whose client went away do not pin connections forever.
+type idleReaper struct {
+	mu        sync.Mutex
+	resources map[*idleResource]struct{}
+	startOnce sync.Once
+}
+
+// track registers a resource; its owner untracks it when closing it.
+func (r *idleReaper) track(kind, id string, timeout time.Duration, reap func() bool) *idleResource {
+	r.startOnce.Do(func() { go r.run() })
+
+	res := &idleResource{kind: kind, id: id, timeout: timeout, reap: reap}
+	res.touch()
+	r.mu.Lock()
+	r.resources[res] = struct{}{}
+	r.mu.Unlock()
+	return res
+}
+
+func (r *idleReaper) untrack(res *idleResource) {
+	r.mu.Lock()
+	delete(r.resources, res)
+	r.mu.Unlock()
+}
+
+func (r *idleReaper) run() {
+	ticker := time.NewTicker(idleReapInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var idle []*idleResource
+		r.mu.Lock()
+		for res := range r.resources {
+			if res.timeout > 0 && res.idle() > res.timeout {
+				idle = append(idle, res)
+			}
+		}
+		r.mu.Unlock()
+
+		// Reaped outside r.mu, since reap takes the resource's own lock
+		for _, res := range idle {
+			elapsed := res.idle()
+			if res.reap() {
+				r.untrack(res)
+				log.Printf("Closed idle %s %s after %s", res.kind, res.id, elapsed.Round(time.Second))
+			}
+		}
+	}
+}
+
+// trackRunningQuery registers the query of the current request so it is
+// cancelled if it goes cfg.IdleTimeout without producing a row, which
+// catches queries whose client disconnected without cancelling them. The
+// returned func untracks it.
+func (s *Server) trackRunningQuery(c *gin.Context, cancel context.CancelFunc) func() {
+	res := s.idleResources.track("query", c.Request.Method+" "+c.Request.URL.Path, s.cfg.IdleTimeout, func() bool {
+		cancel()
+		return true
+	})
+	c.Set(runningQueryKey, res)
+	return func() { s.idleResources.untrack(res) }
+}
+
+// touchRunningQuery marks the current request's query as making progress.
+func touchRunningQuery(c *gin.Context) {
+	if res, ok := c.Get(runningQueryKey); ok {
+		res.(*idleResource).touch()
+	}
+}
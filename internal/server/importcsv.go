@@ -0,0 +1,446 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	importBatchSize  = 500
+	importMaxParams  = 65535 // placeholders allowed in one MySQL statement
+	importSampleRows = 100
+	importMaxErrors  = 100
+)
+
+// errInvalidCSV is wrapped by problems with the upload as a whole.
+var errInvalidCSV = errors.New("invalid CSV import")
+
+// csvImport is a POST /import/csv upload. The file is parsed and inserted
+// as it arrives.
+type csvImport struct {
+	ref       connectionRef
+	table     tableName
+	delimiter rune
+	hasHeader bool
+	// columns name the target column of each CSV column in order; "" skips
+	// a column. They default to the header.
+	columns         []string
+	continueOnError bool
+	createTable     bool
+	// nullValue is the field value inserted as NULL
+	nullValue string
+}
+
+// set applies a form field of the upload.
+func (imp *csvImport) set(name, value string) error {
+	handled, err := setConnectionField(&imp.ref, name, value)
+	switch {
+	case handled:
+	case name == "table":
+		if schema, table, ok := strings.Cut(value, "."); ok {
+			imp.table = tableName{Schema: schema, Name: table}
+		} else {
+			imp.table = tableName{Name: value}
+		}
+	case name == "delimiter":
+		if value == `\t` || value == "tab" {
+			value = "\t"
+		}
+		r := []rune(value)
+		if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' || r[0] == utf8.RuneError {
+			return errors.New("delimiter must be a single character")
+		}
+		imp.delimiter = r[0]
+	case name == "hasHeader":
+		imp.hasHeader, err = strconv.ParseBool(value)
+	case name == "columns":
+		err = json.Unmarshal([]byte(value), &imp.columns)
+	case name == "continueOnError":
+		imp.continueOnError, err = strconv.ParseBool(value)
+	case name == "createTable":
+		imp.createTable, err = strconv.ParseBool(value)
+	case name == "nullValue":
+		imp.nullValue = value
+	default:
+		return fmt.Errorf("unknown field %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+type csvRowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type csvImportResult struct {
+	Table    string        `json:"table"`
+	Created  bool          `json:"created"`
+	Inserted int           `json:"inserted"`
+	Skipped  int           `json:"skipped"`
+	Errors   []csvRowError `json:"errors"`
+}
+
+// csvLineError is a record that stopped an import.
+type csvLineError struct {
+	line int
+	err  error
+}
+
+func (e *csvLineError) Error() string { return fmt.Sprintf("line %d: %v", e.line, e.err) }
+
+func (e *csvLineError) Unwrap() error { return e.err }
+
+// csvRecord is a parsed record holding the values of the mapped columns,
+// or the reason it cannot be imported.
+type csvRecord struct {
+	line   int
+	values []any
+	err    error
+}
+
+// run imports the CSV in r into the target table, inside one transaction.
+// A created table is dropped again if the import fails.
+func (imp *csvImport) run(ctx context.Context, db *sql.DB, r io.Reader) (result csvImportResult, err error) {
+	result = csvImportResult{Table: imp.table.String(), Errors: []csvRowError{}}
+	reader := csv.NewReader(r)
+	reader.Comma = imp.delimiter
+	reader.FieldsPerRecord = -1
+
+	if imp.hasHeader {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return result, fmt.Errorf("%w: the file is empty", errInvalidCSV)
+		}
+		if err != nil {
+			return result, fmt.Errorf("%w: header: %w", errInvalidCSV, err)
+		}
+		if imp.columns == nil {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+			for _, name := range header {
+				imp.columns = append(imp.columns, strings.TrimSpace(name))
+			}
+		}
+	}
+	targets, err := imp.targets()
+	if err != nil {
+		return result, err
+	}
+
+	var sample []csvRecord
+	if imp.createTable {
+		for len(sample) < importSampleRows {
+			rec, err := imp.next(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return result, err
+			}
+			sample = append(sample, rec)
+		}
+		if _, err := db.ExecContext(ctx, createTableSQL(imp.table, targets, sample)); err != nil {
+			return result, err
+		}
+		result.Created = true
+		defer func() {
+			if err != nil {
+				db.ExecContext(context.Background(), "DROP TABLE "+imp.table.quoted())
+				result.Created = false
+			}
+		}()
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	batchRows := min(importBatchSize, importMaxParams/len(targets))
+	insert := insertPrefix(imp.table, targets)
+	batch := make([]csvRecord, 0, batchRows)
+	flush := func() error {
+		defer func() { batch = batch[:0] }()
+		err := insertRecords(ctx, tx, insert, len(targets), batch)
+		if err == nil {
+			result.Inserted += len(batch)
+			return nil
+		}
+		if !isRowError(err) {
+			return err
+		}
+		// Insert the rows one at a time to find the ones at fault
+		for _, rec := range batch {
+			if err := insertRecords(ctx, tx, insert, len(targets), []csvRecord{rec}); err != nil {
+				rec.err = err
+				if err := imp.skip(&result, rec); err != nil {
+					return err
+				}
+				continue
+			}
+			result.Inserted++
+		}
+		return nil
+	}
+	add := func(rec csvRecord) error {
+		if rec.err != nil {
+			return imp.skip(&result, rec)
+		}
+		batch = append(batch, rec)
+		if len(batch) == batchRows {
+			return flush()
+		}
+		return nil
+	}
+
+	for _, rec := range sample {
+		if err := add(rec); err != nil {
+			return result, err
+		}
+	}
+	for {
+		rec, err := imp.next(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		if err := add(rec); err != nil {
+			return result, err
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return result, err
+		}
+	}
+	// Batches that failed are retried row by row, after later records
+	slices.SortStableFunc(result.Errors, func(a, b csvRowError) int { return a.Line - b.Line })
+	return result, tx.Commit()
+}
+
+// targets returns the mapped column names, checking the mapping.
+func (imp *csvImport) targets() ([]string, error) {
+	if imp.columns == nil {
+		return nil, fmt.Errorf("%w: columns are required when the file has no header", errInvalidCSV)
+	}
+	var targets []string
+	seen := map[string]bool{}
+	for _, name := range imp.columns {
+		if name == "" {
+			continue
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%w: column %s is mapped twice", errInvalidCSV, name)
+		}
+		seen[strings.ToLower(name)] = true
+		targets = append(targets, name)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: no columns are mapped", errInvalidCSV)
+	}
+	return targets, nil
+}
+
+// next reads the next record. Malformed records are returned with err set;
+// the error result is for failures reading the upload itself.
+func (imp *csvImport) next(reader *csv.Reader) (csvRecord, error) {
+	fields, err := reader.Read()
+	var parseErr *csv.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		return csvRecord{line: parseErr.StartLine, err: parseErr.Err}, nil
+	case err != nil:
+		return csvRecord{}, err
+	}
+
+	line, _ := reader.FieldPos(0)
+	if len(fields) != len(imp.columns) {
+		return csvRecord{line: line, err: fmt.Errorf("expected %d fields, found %d", len(imp.columns), len(fields))}, nil
+	}
+	rec := csvRecord{line: line}
+	for i, field := range fields {
+		switch {
+		case imp.columns[i] == "":
+		case field == imp.nullValue:
+			rec.values = append(rec.values, nil)
+		default:
+			rec.values = append(rec.values, field)
+		}
+	}
+	return rec, nil
+}
+
+// skip records a failed record, or stops the import unless continueOnError
+// is set.
+func (imp *csvImport) skip(result *csvImportResult, rec csvRecord) error {
+	if !imp.continueOnError {
+		return &csvLineError{line: rec.line, err: rec.err}
+	}
+	result.Skipped++
+	if len(result.Errors) < importMaxErrors {
+		message := sanitizeError(rec.err)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(rec.err, &mysqlErr) {
+			message = mysqlErr.Message
+		}
+		result.Errors = append(result.Errors, csvRowError{Line: rec.line, Message: message})
+	}
+	return nil
+}
+
+// isRowError reports whether err failed only the statement at hand, which
+// MySQL rolls back without aborting the transaction.
+func isRowError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number != 1213 // ER_LOCK_DEADLOCK
+}
+
+func insertPrefix(table tableName, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = quoteIdent(name)
+	}
+	return "INSERT INTO " + table.quoted() + " (" + strings.Join(quoted, ", ") + ") VALUES "
+}
+
+// insertRecords inserts records with one multi-row INSERT.
+func insertRecords(ctx context.Context, tx *sql.Tx, prefix string, width int, records []csvRecord) error {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", width), ", ") + ")"
+	var query strings.Builder
+	query.WriteString(prefix)
+	args := make([]any, 0, width*len(records))
+	for i, rec := range records {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(row)
+		args = append(args, rec.values...)
+	}
+	_, err := tx.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// createTableSQL creates table with column types inferred from sample.
+func createTableSQL(table tableName, columns []string, sample []csvRecord) string {
+	defs := make([]string, len(columns))
+	for i, name := range columns {
+		var values []string
+		for _, rec := range sample {
+			if rec.err == nil && rec.values[i] != nil {
+				values = append(values, rec.values[i].(string))
+			}
+		}
+		defs[i] = quoteIdent(name) + " " + inferColumnType(values)
+	}
+	return "CREATE TABLE " + table.quoted() + " (" + strings.Join(defs, ", ") + ")"
+}
+
+// inferColumnType picks the narrowest MySQL type holding all of values.
+func inferColumnType(values []string) string {
+	isInt, isFloat, isDate, isDatetime := true, true, true, true
+	longest := 0
+	for _, v := range values {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			isInt = false
+		}
+		if f, err := strconv.ParseFloat(v, 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			isFloat = false
+		}
+		if _, err := time.Parse(time.DateOnly, v); err != nil {
+			isDate = false
+		}
+		if _, err := time.Parse(time.DateTime, v); err != nil {
+			isDatetime = false
+		}
+		longest = max(longest, utf8.RuneCountInString(v))
+	}
+
+	switch {
+	case len(values) == 0:
+		return "TEXT"
+	case isInt:
+		return "BIGINT"
+	case isFloat:
+		return "DOUBLE"
+	case isDate:
+		return "DATE"
+	case isDatetime:
+		return "DATETIME"
+	case longest <= 255:
+		return "VARCHAR(255)"
+	default:
+		return "TEXT"
+	}
+}
+
+// importCSVHandler loads an uploaded CSV file into a table, reporting the
+// rows inserted and skipped.
+func (s *Server) importCSVHandler(c *gin.Context) {
+	imp := csvImport{delimiter: ',', hasHeader: true}
+	if file, ok := readUpload(c, imp.set); ok {
+		s.uploadCSV(c, &imp, file)
+	}
+}
+
+func (s *Server) uploadCSV(c *gin.Context, imp *csvImport, file io.Reader) {
+	if imp.table.Name == "" {
+		respondBadRequest(c, "A table is required, sent before the file")
+		return
+	}
+	db, creds, ok := s.openConnection(c, imp.ref)
+	if !ok {
+		return
+	}
+	if creds.ReadOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Imports are not allowed on a read-only connection")
+		return
+	}
+
+	start := time.Now()
+	result, err := imp.run(c.Request.Context(), db, file)
+	s.resultsCache.noteWrite(sessionID(c), creds)
+	if targets, err := imp.targets(); err == nil {
+		// Recorded as one INSERT, however many batches it took
+		insert := insertStmt{prefix: insertPrefix(imp.table, targets)}
+		defer func() { s.recordHandlerQuery(c, creds, insert.template(len(targets)), start, result.Inserted) }()
+	}
+	var lineErr *csvLineError
+	var mysqlErr *mysql.MySQLError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, result)
+	case errors.As(err, &tooLarge):
+		respondBodyTooLarge(c, tooLarge.Limit)
+	case errors.Is(err, errInvalidCSV):
+		respondBadRequest(c, err.Error())
+	case errors.As(err, &lineErr) && errors.As(lineErr.err, &mysqlErr):
+		status, body := classifyDBError(lineErr.err)
+		body.Message = fmt.Sprintf("Line %d: %s", lineErr.line, body.Message)
+		respondAPIError(c, status, body)
+	case errors.As(err, &lineErr):
+		respondBadRequest(c, fmt.Sprintf("Line %d: %s", lineErr.line, lineErr.err))
+	default:
+		respondDBError(c, err)
+	}
+}
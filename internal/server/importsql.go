@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sqlImport is a POST /import/sql upload of a SQL script.
+type sqlImport struct {
+	ref connectionRef
+	// transaction runs the script in one transaction, rolled back when it
+	// stops on an error. Statements that commit implicitly, such as DDL,
+	// still take effect.
+	transaction bool
+	stopOnError bool
+	// dryRun only splits and counts the statements
+	dryRun bool
+}
+
+func (imp *sqlImport) set(name, value string) error {
+	handled, err := setConnectionField(&imp.ref, name, value)
+	switch {
+	case handled:
+	case name == "transaction":
+		imp.transaction, err = strconv.ParseBool(value)
+	case name == "stopOnError":
+		imp.stopOnError, err = strconv.ParseBool(value)
+	case name == "dryRun":
+		imp.dryRun, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("unknown field %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+type scriptError struct {
+	Statement int    `json:"statement"`
+	Line      int    `json:"line"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+type scriptResult struct {
+	// Statements counts the statements read; reading ends when the script
+	// stops on an error
+	Statements int           `json:"statements"`
+	Executed   int           `json:"executed"`
+	Failed     int           `json:"failed"`
+	DurationMs int64         `json:"elapsed_ms"`
+	DryRun     bool          `json:"dry_run"`
+	RolledBack bool          `json:"rolled_back"`
+	Errors     []scriptError `json:"errors"`
+}
+
+// execer is what a script runs on: a transaction or a single connection,
+// so session state such as USE carries from one statement to the next.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// importSQLHandler runs an uploaded SQL script statement by statement.
+// Clients that accept text/event-stream get progress events while it runs,
+// as with /execute-query/events, and the summary as the result event.
+func (s *Server) importSQLHandler(c *gin.Context) {
+	imp := sqlImport{stopOnError: true}
+	file, ok := readUpload(c, imp.set)
+	if !ok {
+		return
+	}
+
+	var (
+		db    *sql.DB
+		creds dbCredentials
+	)
+	if !imp.dryRun {
+		if db, creds, ok = s.openConnection(c, imp.ref); !ok {
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	var run execer
+	var tx *sql.Tx
+	if !imp.dryRun {
+		// A script may SET variables or USE another database, so its
+		// connection is not handed back to the pool
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		defer discardConn(conn)
+		run = conn
+		if imp.transaction {
+			if tx, err = conn.BeginTx(ctx, nil); err != nil {
+				respondDBError(c, err)
+				return
+			}
+			defer tx.Rollback()
+			run = tx
+		}
+	}
+
+	var events *sseWriter
+	var processed atomic.Int64
+	start := time.Now()
+	stop := func() {}
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		events = newSSEWriter(c)
+		tickerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop = cancel
+		go sseTicker(tickerCtx, events, &processed, start)
+	}
+
+	result, status, apiErr := s.runScript(ctx, sessionID(c), &imp, run, creds, file, &processed)
+	if apiErr == nil {
+		if err := imp.finish(tx, &result, start); err != nil {
+			var body apiError
+			status, body = classifyDBError(err)
+			apiErr = &body
+		}
+	}
+	if !imp.dryRun {
+		// Even a failed script may have run some statements
+		s.resultsCache.noteWrite(sessionID(c), creds)
+	}
+	// Stop the ticker so no progress event follows the final one
+	stop()
+	switch {
+	case events != nil && apiErr != nil:
+		events.errorEvent(*apiErr)
+	case events != nil:
+		events.event("result", result)
+	case apiErr != nil:
+		respondAPIError(c, status, *apiErr)
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// runScript executes the statements of file, imported by imp for the
+// session, on run, counting each one processed and recording each one run. Statement failures go into the result; the
+// error is for a script that cannot be read.
+func (s *Server) runScript(ctx context.Context, session string, imp *sqlImport, run execer, creds dbCredentials, file io.Reader, processed *atomic.Int64) (scriptResult, int, *apiError) {
+	result := scriptResult{DryRun: imp.dryRun, Errors: []scriptError{}}
+	splitter := newScriptSplitter(file)
+	for {
+		stmt, err := splitter.next()
+		if errors.Is(err, io.EOF) {
+			return result, 0, nil
+		}
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			return result, http.StatusRequestEntityTooLarge, &apiError{Code: codePayloadTooLarge, Message: fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit)}
+		case err != nil:
+			return result, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: sanitizeError(err)}
+		}
+
+		result.Statements++
+		if imp.dryRun {
+			processed.Add(1)
+			continue
+		}
+
+		var failure *apiError
+		switch {
+		case creds.ReadOnly && !isReadOnlyQuery(stmt.text):
+			failure = &apiError{Code: codeReadOnly, Message: "Only read-only statements are allowed on this connection"}
+		case !s.isQueryAllowed(stmt.text):
+			failure = &apiError{Code: codeQueryNotAllowed, Message: "The query is not allowed by the server's query policy"}
+		default:
+			start := time.Now()
+			entry := historyEntry{Query: stmt.text, Status: "success", ExecutedAt: start.UTC()}
+			// The server's maximum holds each statement, not the script
+			stmtCtx, cancel := s.withMaxTimeout(ctx, creds)
+			res, err := run.ExecContext(stmtCtx, stmt.text)
+			cancel()
+			if err != nil {
+				_, body := classifyDBError(err)
+				failure = &body
+				entry.Status = "error"
+			} else if n, err := res.RowsAffected(); err == nil {
+				entry.RowCount = int(n)
+			}
+			entry.DurationMs = time.Since(start).Milliseconds()
+			s.recordQuery(ctx, session, creds, entry)
+		}
+		processed.Add(1)
+
+		if failure == nil {
+			result.Executed++
+			continue
+		}
+		result.Failed++
+		if len(result.Errors) < importMaxErrors {
+			result.Errors = append(result.Errors, scriptError{
+				Statement: result.Statements,
+				Line:      stmt.line,
+				Code:      failure.Code,
+				Message:   failure.Message,
+			})
+		}
+		if imp.stopOnError || ctx.Err() != nil {
+			return result, 0, nil
+		}
+	}
+}
+
+// finish commits or rolls back the script's transaction and fills in the
+// elapsed time.
+func (imp *sqlImport) finish(tx *sql.Tx, result *scriptResult, start time.Time) error {
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+	if tx == nil {
+		return nil
+	}
+	if result.Failed > 0 && imp.stopOnError {
+		result.RolledBack = true
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
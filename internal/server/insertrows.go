@@ -0,0 +1,383 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+type insertRowsRequest struct {
+	connectionRef
+	Table string           `json:"table"`
+	Rows  []map[string]any `json:"rows"`
+	// OnDuplicate is "ignore" for INSERT IGNORE or "update" for ON
+	// DUPLICATE KEY UPDATE of the given columns; duplicates fail otherwise
+	OnDuplicate string `json:"onDuplicate"`
+}
+
+// tableColumn is a column of a table, from information_schema.
+type tableColumn struct {
+	name     string
+	dataType string
+	primary  bool // part of the primary key
+}
+
+// insertRowError is a row that could not be inserted; row is its index in
+// the request.
+type insertRowError struct {
+	row    int
+	column string
+	err    error
+}
+
+func (e *insertRowError) Error() string {
+	if e.column == "" {
+		return fmt.Sprintf("row %d: %v", e.row, e.err)
+	}
+	return fmt.Sprintf("row %d, column %s: %v", e.row, e.column, e.err)
+}
+
+func (e *insertRowError) Unwrap() error { return e.err }
+
+// insertRows inserts JSON rows into a table with multi-row INSERTs of up
+// to cfg.InsertBatchSize rows, in one transaction. Columns a row leaves out
+// get their DEFAULT. The insert ids assume the consecutive auto-increment
+// values InnoDB gives a multi-row INSERT.
+func (s *Server) insertRows(c *gin.Context) {
+	var req insertRowsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	table, ok := parseTableName(req.Table)
+	if !ok {
+		respondBadRequest(c, "A table name such as orders or shop.orders is required")
+		return
+	}
+	if len(req.Rows) == 0 {
+		respondBadRequest(c, "At least one row is required")
+		return
+	}
+	switch req.OnDuplicate {
+	case "", "ignore", "update":
+	default:
+		respondBadRequest(c, "onDuplicate must be ignore or update")
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+	if creds.ReadOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Rows cannot be inserted on a read-only connection")
+		return
+	}
+
+	ctx := c.Request.Context()
+	known, err := tableColumns(ctx, db, table)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if len(known) == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "Table not found: "+table.String())
+		return
+	}
+
+	// The columns of the statement are every column any row sets, in
+	// table order
+	var columns []tableColumn
+	for _, col := range known {
+		for _, row := range req.Rows {
+			if _, ok := lookupFold(row, col.name); ok {
+				columns = append(columns, col)
+				break
+			}
+		}
+	}
+	for i, row := range req.Rows {
+		for name := range row {
+			if !slices.ContainsFunc(known, func(col tableColumn) bool { return strings.EqualFold(col.name, name) }) {
+				respondBadRequest(c, fmt.Sprintf("Row %d: unknown column %s", i, name))
+				return
+			}
+		}
+	}
+
+	values := make([][]any, len(req.Rows))
+	for i, row := range req.Rows {
+		values[i] = make([]any, len(columns))
+		for j, col := range columns {
+			val, ok := lookupFold(row, col.name)
+			if !ok {
+				values[i][j] = insertDefault
+				continue
+			}
+			if values[i][j], err = coerceColumnValue(col.dataType, val); err != nil {
+				respondBadRequest(c, fmt.Sprintf("Row %d, column %s: %s", i, col.name, err))
+				return
+			}
+		}
+	}
+
+	stmt := newInsertStmt(table, columns, req.OnDuplicate)
+	if !s.isQueryAllowed(stmt.prefix + stmt.suffix) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+
+	start := time.Now()
+	var inserted int64
+	defer func() { s.recordHandlerQuery(c, creds, stmt.template(len(columns)), start, int(inserted)) }()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Batches also stay within the placeholders one statement may have
+	batchRows := min(s.cfg.InsertBatchSize, importMaxParams/max(len(columns), 1))
+	var firstID, lastID int64
+	for start := 0; start < len(values); start += batchRows {
+		batch := values[start:min(start+batchRows, len(values))]
+		res, err := stmt.exec(ctx, tx, batch)
+		if err != nil && isRowError(err) {
+			err = findFailingRow(ctx, tx, stmt, batch, start, err)
+		}
+		if err != nil {
+			respondInsertError(c, err)
+			return
+		}
+		affected, _ := res.RowsAffected()
+		inserted += affected
+		if id, err := res.LastInsertId(); err == nil && id > 0 && affected > 0 {
+			if firstID == 0 {
+				firstID = id
+			}
+			// Rows INSERT IGNORE skips take no id; the affected rows of an
+			// upsert count updates twice
+			n := affected
+			if req.OnDuplicate == "update" {
+				n = int64(len(batch))
+			}
+			lastID = id + n - 1
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	s.resultsCache.noteWrite(sessionID(c), creds)
+
+	response := gin.H{"table": table.String(), "inserted": inserted, "first_insert_id": nil, "last_insert_id": nil}
+	if firstID > 0 {
+		response["first_insert_id"], response["last_insert_id"] = firstID, lastID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// insertDefault marks a column a row leaves out.
+var insertDefault = new(struct{})
+
+// tableColumns returns the columns of table in order, resolving an
+// unqualified name against the current database.
+func tableColumns(ctx context.Context, q queryer, table tableName) ([]tableColumn, error) {
+	var schema any
+	if table.Schema != "" {
+		schema = table.Schema
+	}
+	rows, err := q.QueryContext(ctx,
+		"SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY = 'PRI' FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []tableColumn
+	for rows.Next() {
+		var col tableColumn
+		if err := rows.Scan(&col.name, &col.dataType, &col.primary); err != nil {
+			return nil, err
+		}
+		col.dataType = strings.ToLower(col.dataType)
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func lookupFold(row map[string]any, name string) (any, bool) {
+	if val, ok := row[name]; ok {
+		return val, true
+	}
+	for k, val := range row {
+		if strings.EqualFold(k, name) {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// coerceColumnValue converts a JSON value to what a column of dataType
+// takes, so a mistyped value is reported by row and column before anything
+// is sent to the server.
+func coerceColumnValue(dataType string, val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+	switch dataType {
+	case "json":
+		raw, err := json.Marshal(val)
+		return string(raw), err
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "year", "bit":
+		switch v := val.(type) {
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return v, nil
+			}
+			if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+				return v, nil
+			}
+		}
+		return nil, errors.New("must be an integer")
+	case "decimal", "float", "double":
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case string:
+			// Kept as text so a DECIMAL loses no precision
+			if decimalPattern.MatchString(v) {
+				return v, nil
+			}
+		}
+		return nil, errors.New("must be a number")
+	}
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return nil, errors.New("must be a string")
+}
+
+// insertStmt is an INSERT whose rows go between prefix, which runs up to
+// VALUES, and suffix, the ON DUPLICATE KEY clause if any.
+type insertStmt struct {
+	prefix, suffix string
+}
+
+func newInsertStmt(table tableName, columns []tableColumn, onDuplicate string) insertStmt {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	prefix := insertPrefix(table, names)
+	switch onDuplicate {
+	case "ignore":
+		return insertStmt{prefix: "INSERT IGNORE" + strings.TrimPrefix(prefix, "INSERT")}
+	case "update":
+		updates := make([]string, len(names))
+		for i, name := range names {
+			updates[i] = quoteIdent(name) + " = VALUES(" + quoteIdent(name) + ")"
+		}
+		return insertStmt{prefix: prefix, suffix: " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")}
+	}
+	return insertStmt{prefix: prefix}
+}
+
+// template is the statement for one row of width placeholders, as history
+// and the audit log record it.
+func (stmt insertStmt) template(width int) string {
+	return stmt.prefix + "(" + strings.TrimSuffix(strings.Repeat("?, ", width), ", ") + ")" + stmt.suffix
+}
+
+// exec inserts rows with one statement.
+func (stmt insertStmt) exec(ctx context.Context, tx *sql.Tx, rows [][]any) (sql.Result, error) {
+	var query strings.Builder
+	query.WriteString(stmt.prefix)
+	var args []any
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j, val := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			if val == insertDefault {
+				query.WriteString("DEFAULT")
+				continue
+			}
+			query.WriteString("?")
+			args = append(args, val)
+		}
+		query.WriteString(")")
+	}
+	query.WriteString(stmt.suffix)
+	return tx.ExecContext(ctx, query.String(), args...)
+}
+
+// findFailingRow retries a failed batch row by row to report which row
+// the server rejected; the transaction is rolled back either way. offset is
+// the index of the batch's first row in the request.
+func findFailingRow(ctx context.Context, tx *sql.Tx, stmt insertStmt, batch [][]any, offset int, batchErr error) error {
+	for i, row := range batch {
+		if _, err := stmt.exec(ctx, tx, [][]any{row}); err != nil {
+			return &insertRowError{row: offset + i, column: errorColumn(err), err: err}
+		}
+	}
+	return batchErr
+}
+
+// errorColumn returns the column a MySQL error such as "Incorrect integer
+// value: 'x' for column 'qty' at row 1" names, if any.
+func errorColumn(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return ""
+	}
+	_, rest, ok := strings.Cut(mysqlErr.Message, "column '")
+	if !ok {
+		return ""
+	}
+	column, _, _ := strings.Cut(rest, "'")
+	return column
+}
+
+// respondInsertError reports a failed insert, naming the row when known.
+func respondInsertError(c *gin.Context, err error) {
+	var rowErr *insertRowError
+	if !errors.As(err, &rowErr) {
+		respondDBError(c, err)
+		return
+	}
+	status, body := classifyDBError(rowErr.err)
+	if rowErr.column != "" {
+		body.Message = fmt.Sprintf("Row %d, column %s: %s", rowErr.row, rowErr.column, body.Message)
+	} else {
+		body.Message = fmt.Sprintf("Row %d: %s", rowErr.row, body.Message)
+	}
+	respondAPIError(c, status, body)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiV1Path is where the API lives under the base path.
+const apiV1Path = "/api/v1"
+
+// apiRoute returns the route of the API path, which is under the base path
+// and possibly /api/v1, and whether it is under /api/v1.
+func (s *Server) apiRoute(path string) (string, bool) {
+	path = strings.TrimPrefix(path, s.cfg.BasePath)
+	route, v1 := strings.CutPrefix(path, apiV1Path)
+	if route == "" {
+		route = "/"
+	}
+	return route, v1
+}
+
+// deprecatedPath marks a response from an unversioned API path as
+// deprecated, linking to the path under /api/v1. Clients of these paths
+// keep today's responses; changes to the response shape go to v1 only.
+// Each route's use is logged once, so old clients do not flood the log.
+func (s *Server) deprecatedPath(c *gin.Context) {
+	route, _ := s.apiRoute(c.Request.URL.Path)
+	s.markDeprecated(c, s.cfg.BasePath+apiV1Path+route)
+	c.Next()
+}
+
+// deprecatedAlias marks the responses of a route kept as an alias of route,
+// an API path, as deprecated in the same way, linking to route under
+// /api/v1.
+func (s *Server) deprecatedAlias(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.markDeprecated(c, s.cfg.BasePath+apiV1Path+route)
+		c.Next()
+	}
+}
+
+// markDeprecated sets the headers of a deprecated response whose path is
+// served at successor, logging the use of the route once.
+func (s *Server) markDeprecated(c *gin.Context, successor string) {
+	c.Header("Deprecation", "true")
+	c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+	if _, logged := s.deprecatedPathsLogged.LoadOrStore(c.Request.Method+" "+c.FullPath(), true); !logged {
+		logRequestf(c, "Deprecated path %s %s used; it is served at %s", c.Request.Method, c.Request.URL.Path, successor)
+	}
+}
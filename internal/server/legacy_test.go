@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeprecatedPathsMatchV1(t *testing.T) {
+	for _, basePath := range []string{"", "/boba"} {
+		t.Run("base path "+basePath, func(t *testing.T) {
+			s := newTestServer(func(c *config) { c.BasePath = basePath })
+			mock := withMockDB(t, s)
+			for range 2 {
+				mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+			}
+			r := s.Handler()
+
+			for _, tt := range []struct{ method, route, body string }{
+				{http.MethodGet, "/drivers", ""},
+				{http.MethodPost, "/format", `{"query":"select 1"}`},
+				{http.MethodPost, "/format", `{"query":"select 1","nonsense":true}`},
+				{http.MethodPost, "/execute-query", `{"credentials":{"username":"app","host":"db","port":"3306"},"query":"SELECT 1"}`},
+			} {
+				serve := func(path string) *httptest.ResponseRecorder {
+					w := httptest.NewRecorder()
+					req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+					// The same ID on both, so errors compare equal
+					req.Header.Set(requestIDHeader, "legacy-test")
+					r.ServeHTTP(w, req)
+					return w
+				}
+				v1Path := basePath + apiV1Path + tt.route
+				v1, old := serve(v1Path), serve(basePath+tt.route)
+
+				if v1.Code != old.Code {
+					t.Errorf("%s %s: status %d, v1 %d", tt.method, tt.route, old.Code, v1.Code)
+				}
+				if tt.route != "/execute-query" && old.Body.String() != v1.Body.String() {
+					t.Errorf("%s %s: body %s, v1 %s", tt.method, tt.route, old.Body, v1.Body)
+				}
+				if old.Header().Get("Deprecation") != "true" {
+					t.Errorf("%s %s: no Deprecation header", tt.method, tt.route)
+				}
+				if link := old.Header().Get("Link"); link != "<"+v1Path+`>; rel="successor-version"` {
+					t.Errorf("%s %s: Link %q", tt.method, tt.route, link)
+				}
+				if v1.Header().Get("Deprecation") != "" || v1.Header().Get("Link") != "" {
+					t.Errorf("%s %s: v1 response marked deprecated", tt.method, v1Path)
+				}
+			}
+		})
+	}
+}
+
+func TestDeprecatedPathLoggedOnce(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+
+	r := newTestServer().Handler()
+	for range 3 {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/drivers", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, apiV1Path+"/drivers", nil))
+	}
+	if n := strings.Count(logged.String(), "Deprecated path"); n != 1 {
+		t.Errorf("deprecated use logged %d times:\n%s", n, logged.String())
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func respondBodyTooLarge(c *gin.Context, limit int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Request body exceeds %d bytes", limit))
+}
+
+// uploadRoutes take file uploads, which are capped at cfg.MaxUploadBytes
+// rather than cfg.MaxBodyBytes.
+var uploadRoutes = map[string]bool{
+	"/import/csv": true,
+	"/import/sql": true,
+}
+
+// bodyLimitMiddleware caps request bodies at cfg.MaxBodyBytes. Bodies that
+// declare a larger Content-Length are rejected up front; others fail once
+// reading passes the limit.
+func (s *Server) bodyLimitMiddleware(c *gin.Context) {
+	limit := s.cfg.MaxBodyBytes
+	if route, _ := s.apiRoute(c.FullPath()); uploadRoutes[route] {
+		limit = s.cfg.MaxUploadBytes
+	}
+	if c.Request.ContentLength > limit {
+		respondBodyTooLarge(c, limit)
+		c.Abort()
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	c.Next()
+}
+
+// checkQueryLength returns the error for a query over cfg.MaxQueryLength,
+// or nil when it is within the limit.
+func (s *Server) checkQueryLength(query string) *apiError {
+	if int64(len(query)) <= s.cfg.MaxQueryLength {
+		return nil
+	}
+	return &apiError{Code: codeQueryTooLong, Message: fmt.Sprintf("The query is %d bytes, over the limit of %d", len(query), s.cfg.MaxQueryLength)}
+}
+
+// respondQueryLength responds 400 and returns false when any of queries is
+// over cfg.MaxQueryLength.
+func (s *Server) respondQueryLength(c *gin.Context, queries ...string) bool {
+	for _, query := range queries {
+		if apiErr := s.checkQueryLength(query); apiErr != nil {
+			respondAPIError(c, http.StatusBadRequest, *apiErr)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Lint checks, named as in BOBA_LINT_DISABLE and the code of each warning.
+const (
+	lintUpdateWithoutWhere = "update_without_where"
+	lintDeleteWithoutWhere = "delete_without_where"
+	lintSelectStar         = "select_star_large_table"
+	lintImplicitCrossJoin  = "implicit_cross_join"
+	lintLeadingWildcard    = "leading_wildcard_like"
+	lintOrderWithoutLimit  = "order_by_without_limit"
+)
+
+var lintChecks = []string{
+	lintUpdateWithoutWhere,
+	lintDeleteWithoutWhere,
+	lintSelectStar,
+	lintImplicitCrossJoin,
+	lintLeadingWildcard,
+	lintOrderWithoutLimit,
+}
+
+// lintWarning is a likely mistake in a statement. Warnings never stop a
+// statement from running.
+type lintWarning struct {
+	// Level is set on the warnings of the server: Note, Warning or Error
+	Level   string `json:"level,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// tableName is a table referenced by a statement; Schema is empty when the
+// name is unqualified.
+type tableName struct {
+	Schema string
+	Name   string
+}
+
+func (t tableName) String() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// tableNamePattern is the table names endpoints taking one by name
+// accept: a plain identifier, optionally qualified with a schema.
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}(\.[A-Za-z0-9_$]{1,64})?$`)
+
+// parseTableName parses a request's "schema.table" or "table", reporting
+// whether it matches tableNamePattern.
+func parseTableName(s string) (tableName, bool) {
+	if !tableNamePattern.MatchString(s) {
+		return tableName{}, false
+	}
+	if schema, name, ok := strings.Cut(s, "."); ok {
+		return tableName{Schema: schema, Name: name}, true
+	}
+	return tableName{Name: s}, true
+}
+
+// quoted is t as it is written in generated SQL.
+func (t tableName) quoted() string {
+	if t.Schema == "" {
+		return quoteIdent(t.Name)
+	}
+	return quoteIdent(t.Schema) + "." + quoteIdent(t.Name)
+}
+
+// lintStatement is what the checks need to know about one statement.
+type lintStatement struct {
+	kind              string // the leading keyword
+	hasWhere          bool
+	hasLimit          bool
+	hasOrderBy        bool
+	selectStar        bool
+	implicitCrossJoin bool
+	leadingWildcard   []string // the offending LIKE patterns
+	tables            []tableName
+}
+
+// analyzeStatements splits query into statements and records what the
+// lint checks look at. Only the outermost query of each statement counts
+// for WHERE, LIMIT, ORDER BY and SELECT *; tables and LIKE patterns are
+// collected from subqueries too.
+func analyzeStatements(query string) ([]lintStatement, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	toks := significantTokens(tokens)
+
+	var stmts []lintStatement
+	var st *lintStatement
+	depth := 0
+	var prev sqlToken
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.isSymbol(";") {
+			st, depth, prev = nil, 0, sqlToken{}
+			continue
+		}
+		if st == nil {
+			stmts = append(stmts, lintStatement{})
+			st = &stmts[len(stmts)-1]
+		}
+		if st.kind == "" && t.is(tokWord) {
+			st.kind = strings.ToUpper(t.text)
+		}
+
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		case t.isSymbol("*") && depth == 0 && (prev.isWord("SELECT") || prev.isSymbol(",") || isSelectModifier(prev)):
+			st.selectStar = true
+		case t.isWord("WHERE") && depth == 0:
+			st.hasWhere = true
+		case t.isWord("LIMIT") && depth == 0:
+			st.hasLimit = true
+		case t.isWord("ORDER") && depth == 0 && i+1 < len(toks) && toks[i+1].isWord("BY"):
+			st.hasOrderBy = true
+		case t.isWord("LIKE") && i+1 < len(toks) && toks[i+1].is(tokString):
+			if lit := toks[i+1].text; len(lit) > 1 && (lit[1] == '%' || lit[1] == '_') {
+				st.leadingWildcard = append(st.leadingWildcard, lit)
+			}
+		case t.isWord("FROM") || (t.isWord("UPDATE") && prev == sqlToken{}):
+			i = st.readTables(toks, i+1, true)
+		case t.isWord("JOIN") || t.isWord("STRAIGHT_JOIN"):
+			explicitCross := prev.isWord("CROSS") || prev.isWord("NATURAL")
+			i = st.readTables(toks, i+1, false)
+			if next := peek(toks, i+1); !explicitCross && !next.isWord("ON") && !next.isWord("USING") {
+				st.implicitCrossJoin = true
+			}
+		}
+		prev = t
+	}
+	return stmts, nil
+}
+
+func peek(toks []sqlToken, i int) sqlToken {
+	if i < len(toks) {
+		return toks[i]
+	}
+	return sqlToken{}
+}
+
+// readTables reads a table reference, and with list set any further
+// comma-separated ones, starting at toks[i]. It returns the index of the
+// last token consumed.
+func (st *lintStatement) readTables(toks []sqlToken, i int, list bool) int {
+	for {
+		t := peek(toks, i)
+		if !t.is(tokWord) && !t.is(tokQuotedIdent) {
+			// A derived table or something the checks do not follow
+			return i - 1
+		}
+		name := tableName{Name: unquoteIdent(t.text)}
+		if peek(toks, i+1).isSymbol(".") {
+			name = tableName{Schema: name.Name, Name: unquoteIdent(peek(toks, i+2).text)}
+			i += 2
+		}
+		if !strings.EqualFold(name.Name, "dual") && !slices.Contains(st.tables, name) {
+			st.tables = append(st.tables, name)
+		}
+
+		// Skip an alias, with or without AS
+		if peek(toks, i+1).isWord("AS") {
+			i += 2
+		} else if a := peek(toks, i+1); a.is(tokQuotedIdent) || (a.is(tokWord) && !formatKeywords[strings.ToUpper(a.text)]) {
+			i++
+		}
+
+		if !list || !peek(toks, i+1).isSymbol(",") {
+			return i
+		}
+		st.implicitCrossJoin = true
+		i += 2
+	}
+}
+
+// unquoteIdent strips backticks from an identifier.
+func unquoteIdent(s string) string {
+	if len(s) >= 2 && s[0] == '`' && s[len(s)-1] == '`' {
+		return strings.ReplaceAll(s[1:len(s)-1], "``", "`")
+	}
+	return s
+}
+
+// quoteIdent quotes an identifier for use in generated SQL on driverName.
+func quoteIdent(s string) string {
+	return quoteIdentifier(driverName, s)
+}
+
+// quoteIdentifier quotes name the way driver's database expects, doubling
+// any quote character inside it: backticks for MySQL, brackets for SQL
+// Server and the standard double quotes otherwise, as Postgres uses.
+func quoteIdentifier(driver, name string) string {
+	switch driver {
+	case "mysql":
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	case "sqlserver", "mssql":
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	default:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+}
+
+// lintQuery runs the enabled checks against query. The checks that depend
+// on table sizes are only run when db is non-nil; lookups that fail are
+// skipped, since linting must never get in the way of a query.
+func (s *Server) lintQuery(ctx context.Context, db *sql.DB, query string) []lintWarning {
+	warnings := []lintWarning{}
+	stmts, err := analyzeStatements(query)
+	if err != nil {
+		return warnings
+	}
+
+	enabled := func(check string) bool { return !s.cfg.LintDisabled[check] }
+	add := func(check, format string, args ...any) {
+		if enabled(check) {
+			warnings = append(warnings, lintWarning{Code: check, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	for _, st := range stmts {
+		switch {
+		case st.kind == "UPDATE" && !st.hasWhere:
+			add(lintUpdateWithoutWhere, "UPDATE without WHERE changes every row")
+		case st.kind == "DELETE" && !st.hasWhere:
+			add(lintDeleteWithoutWhere, "DELETE without WHERE removes every row")
+		}
+		if st.implicitCrossJoin {
+			add(lintImplicitCrossJoin, "Tables are joined without a join condition; use JOIN ... ON")
+		}
+		for _, pattern := range st.leadingWildcard {
+			add(lintLeadingWildcard, "LIKE %s starts with a wildcard and cannot use an index", pattern)
+		}
+
+		checkStar := st.selectStar && enabled(lintSelectStar)
+		checkOrder := st.hasOrderBy && !st.hasLimit && enabled(lintOrderWithoutLimit)
+		if db == nil || (!checkStar && !checkOrder) {
+			continue
+		}
+		for _, table := range st.tables {
+			rows, ok := tableRows(ctx, db, table)
+			if !ok || rows < int64(s.cfg.LintLargeTableRows) {
+				continue
+			}
+			if checkStar {
+				add(lintSelectStar, "SELECT * on %s, which has about %d rows", table, rows)
+			}
+			if checkOrder {
+				add(lintOrderWithoutLimit, "ORDER BY without LIMIT sorts all of %s, about %d rows", table, rows)
+			}
+		}
+	}
+	return warnings
+}
+
+// tableRows returns the estimated row count information_schema keeps for
+// table, resolving an unqualified name against the current database.
+func tableRows(ctx context.Context, db *sql.DB, table tableName) (int64, bool) {
+	var schema any
+	if table.Schema != "" {
+		schema = table.Schema
+	}
+	var rows sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = COALESCE(?, DATABASE()) AND TABLE_NAME = ?",
+		schema, table.Name,
+	).Scan(&rows)
+	if err != nil {
+		return 0, false
+	}
+	return rows.Int64, rows.Valid
+}
+
+type lintRequest struct {
+	connectionRef
+	Query string `json:"query"`
+}
+
+// lintHandler returns lint warnings for a query without running it. The
+// connection is optional; without one the table-size checks are skipped.
+func (s *Server) lintHandler(c *gin.Context) {
+	var req lintRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		respondBadRequest(c, "Query cannot be empty")
+		return
+	}
+	if !s.respondQueryLength(c, req.Query) {
+		return
+	}
+
+	var db *sql.DB
+	if req.connectionRef != (connectionRef{}) {
+		var ok bool
+		if db, _, ok = s.openConnection(c, req.connectionRef); !ok {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"warnings": s.lintQuery(c.Request.Context(), db, req.Query)})
+}
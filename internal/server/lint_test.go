@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		driver, name, want string
+	}{
+		{"mysql", "order", "`order`"},
+		{"mysql", "we`ird", "`we``ird`"},
+		{"mysql", "``", "``````"},
+		{"mysql", "a.b", "`a.b`"},
+		{"postgres", "order", `"order"`},
+		{"postgres", `say "hi"`, `"say ""hi"""`},
+		{"postgres", "we`ird", "\"we`ird\""},
+		{"sqlserver", "order", "[order]"},
+		{"sqlserver", "a]b[c", "[a]]b[c]"},
+		{"mssql", "]", "[]]]"},
+	}
+	for _, tt := range tests {
+		if got := quoteIdentifier(tt.driver, tt.name); got != tt.want {
+			t.Errorf("quoteIdentifier(%q, %q) = %s, want %s", tt.driver, tt.name, got, tt.want)
+		}
+		if tt.driver == "mysql" {
+			if got := unquoteIdent(quoteIdentifier(tt.driver, tt.name)); got != tt.name {
+				t.Errorf("unquoteIdent(quoteIdentifier(%q)) = %q", tt.name, got)
+			}
+		}
+	}
+}
+
+func TestPreviewQuotesReservedWords(t *testing.T) {
+	s := newTestServer()
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("SELECT * FROM `select`.`order` LIMIT ?").WithArgs(previewDefaultLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := `{"credentials":{"username":"app","host":"db","port":"3306"},"table":"select.order"}`
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/preview", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
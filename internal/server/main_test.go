@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// testAssets stands in for the UI the boba command embeds.
+var testAssets = fstest.MapFS{"index.html": {Data: []byte("<!doctype html><title>boba</title>")}}
+
+// newTestServer returns a server with the default configuration, changed
+// by each of set, serving testAssets.
+func newTestServer(set ...func(*config)) *Server {
+	c := defaultConfig()
+	for _, f := range set {
+		f(c)
+	}
+	return newServer(c, testAssets)
+}
+
+// mockConnector hands every request the same sqlmock database.
+type mockConnector struct{ db *sql.DB }
+
+func (m mockConnector) connect(dbCredentials) (*sql.DB, error) { return m.db, nil }
+
+// failingConnector fails every connection with err.
+type failingConnector struct{ err error }
+
+func (f failingConnector) connect(dbCredentials) (*sql.DB, error) { return nil, f.err }
+
+// mysqlValueConverter passes uint64 values through whole, as the MySQL
+// driver returns UNSIGNED BIGINT values in the binary protocol, where the
+// database/sql default refuses those above math.MaxInt64.
+type mysqlValueConverter struct{}
+
+func (mysqlValueConverter) ConvertValue(v any) (driver.Value, error) {
+	if n, ok := v.(uint64); ok {
+		return n, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// withMockDB routes the connections of s to a sqlmock database, whose
+// expectations must all be met by the end of the test.
+func withMockDB(t testing.TB, s *Server) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.ValueConverterOption(mysqlValueConverter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlmock forgets the database once its last connection closes, as
+	// discardConn closes those of writes, so one is held open throughout
+	held, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.connector = mockConnector{db}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		held.Close()
+		db.Close()
+	})
+	return mock
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceOperations maps an operation to its statement and whether it
+// only reads, and so is allowed on read-only connections.
+var maintenanceOperations = map[string]struct {
+	stmt     string
+	readOnly bool
+}{
+	"optimize": {"OPTIMIZE TABLE", false},
+	"analyze":  {"ANALYZE TABLE", false},
+	"check":    {"CHECK TABLE", true},
+}
+
+type maintenanceRequest struct {
+	connectionRef
+	// Operation is optimize, analyze or check
+	Operation string   `json:"operation"`
+	Tables    []string `json:"tables"`
+	// Table names a single table, as an alternative to Tables
+	Table string `json:"table"`
+	// Async runs the operation as a /queries/async job
+	Async bool `json:"async"`
+}
+
+// maintenanceRow is a status row of OPTIMIZE, ANALYZE or CHECK TABLE.
+type maintenanceRow struct {
+	Table   string `json:"table"`
+	Op      string `json:"op"`
+	MsgType string `json:"msg_type"`
+	MsgText string `json:"msg_text"`
+}
+
+// corrupt reports whether the row says the table is damaged.
+func (r maintenanceRow) corrupt() bool {
+	text := strings.ToLower(r.MsgText)
+	return strings.EqualFold(r.MsgType, "error") || strings.Contains(text, "corrupt") || strings.Contains(text, "crashed")
+}
+
+// tableMaintenance runs OPTIMIZE, ANALYZE or CHECK TABLE over one or more
+// tables and returns the status rows MySQL reports, listing the tables
+// found corrupted. These statements can take long on big tables, so async
+// hands them to the async job queue instead. BOBA_ALLOW_MAINTENANCE=false
+// turns it off, and BOBA_MAINTENANCE_TOKEN restricts it to those with the
+// token.
+func (s *Server) tableMaintenance(c *gin.Context) {
+	if !s.cfg.AllowMaintenance {
+		respondError(c, http.StatusForbidden, codeForbidden, "Table maintenance is disabled on this server; set BOBA_ALLOW_MAINTENANCE=true to enable it")
+		return
+	}
+	if s.cfg.MaintenanceToken != "" && !bearerAuthorized(c, s.cfg.MaintenanceToken, "boba maintenance", "A valid maintenance token is required") {
+		return
+	}
+	var req maintenanceRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Table != "" {
+		req.Tables = append(req.Tables, req.Table)
+	}
+	op, ok := maintenanceOperations[strings.ToLower(req.Operation)]
+	if !ok {
+		respondBadRequest(c, "operation must be optimize, analyze or check")
+		return
+	}
+	if len(req.Tables) == 0 {
+		respondBadRequest(c, "At least one table is required")
+		return
+	}
+	quoted := make([]string, len(req.Tables))
+	for i, name := range req.Tables {
+		table, ok := parseTableName(name)
+		if !ok {
+			respondBadRequest(c, "Invalid table name: "+name)
+			return
+		}
+		quoted[i] = table.quoted()
+	}
+	stmt := op.stmt + " " + strings.Join(quoted, ", ")
+	if !s.isQueryAllowed(stmt) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+
+	creds, status, err := s.resolveCredentials(req.connectionRef)
+	if err != nil {
+		respondStatusError(c, status, err)
+		return
+	}
+	if creds.ReadOnly && !op.readOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Only check is allowed on a read-only connection")
+		return
+	}
+
+	prepared := preparedQuery{query: stmt, creds: creds}
+	if req.Async {
+		job, err := s.asyncJobs.start(sessionID(c), stmt, prepared, nil)
+		if err != nil {
+			respondJobError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, s.asyncJobs.view(job))
+		return
+	}
+
+	db, err := s.connectToDatabase(creds)
+	if err != nil {
+		respondConnectionError(c, err)
+		return
+	}
+
+	start := time.Now()
+	results := []maintenanceRow{}
+	defer func() { s.recordHandlerQuery(c, creds, stmt, start, len(results)) }()
+	ctx, cancel := s.withMaxTimeout(c.Request.Context(), creds)
+	defer cancel()
+	defer s.trackRunningQuery(c, cancel)()
+	rows, err := db.QueryContext(ctx, stmt)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	corrupted := []string{}
+	for rows.Next() {
+		var r maintenanceRow
+		if err := rows.Scan(&r.Table, &r.Op, &r.MsgType, &r.MsgText); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		results = append(results, r)
+		if r.corrupt() && !slices.Contains(corrupted, r.Table) {
+			corrupted = append(corrupted, r.Table)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"operation": strings.ToLower(req.Operation),
+		"results":   results,
+		"corrupted": corrupted,
+	})
+}
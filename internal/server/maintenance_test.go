@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMaintenanceToken(t *testing.T) {
+	s := newTestServer(func(c *config) { c.MaintenanceToken = "upkeep" })
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("CHECK TABLE `t`").WillReturnRows(sqlmock.NewRows([]string{"Table", "Op", "Msg_type", "Msg_text"}).AddRow("db.t", "check", "status", "OK"))
+	body := `{` + credentialsJSON + `,"operation":"check","table":"t"}`
+
+	for _, tt := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer guess", http.StatusUnauthorized},
+		{"Bearer upkeep", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tables/maintenance", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		s.Handler().ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: status %d, want %d: %s", tt.auth, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestMaintenanceAliasDeprecated(t *testing.T) {
+	s := newTestServer(func(c *config) { c.AllowMaintenance = false })
+	for _, path := range []string{"/api/v1/maintenance", "/maintenance"} {
+		w := postJSON(t, s, path, `{}`)
+		if w.Header().Get("Deprecation") != "true" {
+			t.Errorf("%s: no Deprecation header", path)
+		}
+		if link := w.Header().Get("Link"); link != "</api/v1/tables/maintenance>; rel=\"successor-version\"" {
+			t.Errorf("%s: Link %q", path, link)
+		}
+	}
+	if w := postJSON(t, s, "/api/v1/tables/maintenance", `{}`); w.Header().Get("Deprecation") != "" {
+		t.Error("/tables/maintenance marked deprecated")
+	}
+}
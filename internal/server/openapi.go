@@ -0,0 +1,349 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeDoc describes a route for the OpenAPI document. Body is a value of
+// the type the route binds its JSON body to, nil when it takes none.
+type routeDoc struct {
+	Summary string
+	Body    any
+	// Query are the query parameters the route reads
+	Query []string
+	// Form are the fields of a multipart upload, sent before its file
+	Form []string
+}
+
+var connectionForm = []string{"credentials", "connection", "profileId"}
+
+// routeDocs documents the routes of registerAPI, keyed by method and path
+// under /api/v1. A route added there without an entry is still
+// listed in the document, with no body, and logged when it is built.
+var routeDocs = map[string]routeDoc{
+	"POST /login":                    {Summary: "Check credentials, optionally pinning a sticky connection", Body: loginRequest{}},
+	"POST /execute-query":            {Summary: "Run a query; Accept: application/vnd.boba.v2+json returns the version 2 envelope", Body: queryRequest{}},
+	"POST /execute-query.json":       {Summary: "Run a query, returning JSON", Body: queryRequest{}},
+	"POST /execute-query.csv":        {Summary: "Run a query, returning CSV", Body: queryRequest{}},
+	"POST /execute-query.xlsx":       {Summary: "Run a query, returning an Excel workbook", Body: queryRequest{}},
+	"POST /execute-query.arrow":      {Summary: "Run a query, returning an Arrow IPC stream", Body: queryRequest{}},
+	"POST /execute-query/events":     {Summary: "Run a query, streaming progress as server-sent events", Body: queryRequest{}},
+	"POST /execute-query/stream":     {Summary: "Hold a query for GET /execute-query/stream, returning its token", Body: queryRequest{}},
+	"GET /execute-query/stream":      {Summary: "Stream a query's rows as server-sent events", Query: []string{"token", "query", "connection", "profileId", "batch_size"}},
+	"POST /execute-batch":            {Summary: "Run one statement with many parameter sets in a transaction", Body: executeBatchRequest{}},
+	"POST /preview":                  {Summary: "Read the first rows of a table", Body: previewRequest{}},
+	"POST /count":                    {Summary: "Count the rows of a table", Body: countRequest{}},
+	"GET /charsets":                  {Summary: "List the character sets and collations", Query: []string{"connection", "profileId"}},
+	"POST /foreign-keys":             {Summary: "List foreign keys", Body: foreignKeysRequest{}},
+	"POST /diff":                     {Summary: "Diff a query's result between two connections", Body: diffRequest{}},
+	"POST /compare":                  {Summary: "Compare the results of two queries by key", Body: compareRequest{}},
+	"POST /schema/diff":              {Summary: "Diff the schemas of two databases", Body: schemaDiffRequest{}},
+	"POST /ddl":                      {Summary: "Return a table's CREATE statement", Body: ddlRequest{}},
+	"POST /describe-query":           {Summary: "Report a query's columns without running it", Body: queryRequest{}},
+	"POST /databases/create":         {Summary: "Create a database", Body: createDatabaseRequest{}},
+	"POST /databases/drop":           {Summary: "Drop a database", Body: dropDatabaseRequest{}},
+	"POST /tables/maintenance":       {Summary: "Run ANALYZE, OPTIMIZE or CHECK; needs Authorization: Bearer with BOBA_MAINTENANCE_TOKEN when it is set", Body: maintenanceRequest{}},
+	"POST /maintenance":              {Summary: "Deprecated alias of /tables/maintenance", Body: maintenanceRequest{}},
+	"POST /tables/insert":            {Summary: "Insert JSON rows into a table", Body: insertRowsRequest{}},
+	"POST /tables/update-row":        {Summary: "Update one row by its primary key", Body: rowEditRequest{}},
+	"POST /tables/delete-row":        {Summary: "Delete one row by its primary key", Body: rowEditRequest{}},
+	"POST /keep-alive":               {Summary: "Keep the session's sticky connection open"},
+	"DELETE /cursors/{id}":           {Summary: "Close a paged result"},
+	"GET /connections":               {Summary: "List the server-side connections"},
+	"GET /drivers":                   {Summary: "List the database drivers"},
+	"POST /server-info":              {Summary: "Report the server's version and settings", Body: connectionRef{}},
+	"POST /server/processlist":       {Summary: "List the server's threads", Body: connectionRef{}},
+	"POST /server/kill":              {Summary: "Kill a query or connection", Body: killRequest{}},
+	"POST /server/status":            {Summary: "Read status variables", Body: serverVariablesRequest{}},
+	"POST /server/variables":         {Summary: "Read system variables", Body: serverVariablesRequest{}},
+	"POST /server/users":             {Summary: "List the server's accounts", Body: connectionRef{}},
+	"POST /server/grants":            {Summary: "Show an account's grants", Body: grantsRequest{}},
+	"POST /privileges":               {Summary: "Report what the connected account may do", Body: connectionRef{}},
+	"POST /processlist":              {Summary: "List the server's threads", Body: connectionRef{}},
+	"POST /kill":                     {Summary: "Kill a query or connection", Body: killRequest{}},
+	"POST /format":                   {Summary: "Format SQL", Body: formatRequest{}},
+	"POST /lint":                     {Summary: "Lint SQL", Body: lintRequest{}},
+	"POST /profiles":                 {Summary: "Create a connection profile", Body: profileRequest{}},
+	"GET /profiles":                  {Summary: "List connection profiles"},
+	"GET /profiles/{id}":             {Summary: "Get a connection profile"},
+	"PUT /profiles/{id}":             {Summary: "Update a connection profile", Body: profileRequest{}},
+	"DELETE /profiles/{id}":          {Summary: "Delete a connection profile"},
+	"POST /saved-queries":            {Summary: "Save a query", Body: savedQuery{}},
+	"GET /saved-queries":             {Summary: "List saved queries", Query: []string{"tag", "q"}},
+	"GET /saved-queries/export":      {Summary: "Export the saved queries"},
+	"POST /saved-queries/import":     {Summary: "Import saved queries", Body: savedQueriesExport{}},
+	"GET /saved-queries/{id}":        {Summary: "Get a saved query"},
+	"PUT /saved-queries/{id}":        {Summary: "Update a saved query", Body: savedQuery{}},
+	"DELETE /saved-queries/{id}":     {Summary: "Delete a saved query"},
+	"POST /bookmarks":                {Summary: "Save a query", Body: savedQuery{}},
+	"GET /bookmarks":                 {Summary: "List saved queries", Query: []string{"tag", "q"}},
+	"GET /bookmarks/export":          {Summary: "Export the saved queries"},
+	"POST /bookmarks/import":         {Summary: "Import saved queries", Body: savedQueriesExport{}},
+	"GET /bookmarks/{id}":            {Summary: "Get a saved query"},
+	"PUT /bookmarks/{id}":            {Summary: "Update a saved query", Body: savedQuery{}},
+	"DELETE /bookmarks/{id}":         {Summary: "Delete a saved query"},
+	"POST /schedules":                {Summary: "Schedule a query", Body: schedule{}},
+	"GET /schedules":                 {Summary: "List schedules"},
+	"GET /schedules/{id}":            {Summary: "Get a schedule"},
+	"PUT /schedules/{id}":            {Summary: "Update a schedule", Body: schedule{}},
+	"DELETE /schedules/{id}":         {Summary: "Delete a schedule"},
+	"GET /schedules/{id}/runs":       {Summary: "List a schedule's runs"},
+	"GET /schedules/{id}/runs/{run}": {Summary: "Get a run's result", Query: []string{"format"}},
+	"POST /snapshots":                {Summary: "Share a result by link", Body: createSnapshotRequest{}},
+	"GET /snapshots/{id}":            {Summary: "Get a shared result"},
+	"POST /import/csv":               {Summary: "Load a CSV file into a table", Form: append([]string{"table", "delimiter", "hasHeader", "columns", "continueOnError", "createTable", "nullValue"}, connectionForm...)},
+	"POST /import/sql":               {Summary: "Run a SQL script", Form: append([]string{"transaction", "stopOnError", "dryRun"}, connectionForm...)},
+	"POST /export/sql":               {Summary: "Dump tables as SQL", Body: sqlExportRequest{}},
+	"POST /queries/async":            {Summary: "Start a query in the background", Body: asyncQueryRequest{}},
+	"GET /queries/async/{id}":        {Summary: "Get a background query's status and result"},
+	"DELETE /queries/async/{id}":     {Summary: "Cancel a background query"},
+	"GET /webhooks/deliveries":       {Summary: "List webhook deliveries", Query: []string{"jobId", "scheduleId", "limit"}},
+	"GET /history":                   {Summary: "List the query history", Query: []string{"page", "per_page", "q"}},
+	"DELETE /history":                {Summary: "Clear the query history"},
+	"DELETE /history/{id}":           {Summary: "Delete a history entry"},
+	"GET /audit":                     {Summary: "List the audit log; needs Authorization: Bearer with BOBA_AUDIT_TOKEN", Query: []string{"from", "to", "user", "host", "database", "session", "status", "page", "per_page"}},
+	"GET /ws":                        {Summary: "WebSocket for live updates"},
+	"GET /ws/query":                  {Summary: "WebSocket that runs queries"},
+}
+
+// openAPIDoc is the OpenAPI 3 document, with only the parts boba uses.
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Servers    []map[string]string                     `json:"servers"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*jsonSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *jsonSchema `json:"schema"`
+}
+
+type openAPIBody struct {
+	Required bool                              `json:"required,omitempty"`
+	Content  map[string]map[string]*jsonSchema `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                            `json:"description"`
+	Content     map[string]map[string]*jsonSchema `json:"content,omitempty"`
+}
+
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Nullable             bool                   `json:"nullable,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+}
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+var routeParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// buildOpenAPIDoc documents the /api/v1 routes of routes, gin's route
+// table, from routeDocs.
+// The schemas are read from the request types by reflection, the way
+// encoding/json sees them.
+func (s *Server) buildOpenAPIDoc(routes gin.RoutesInfo) *openAPIDoc {
+	doc := &openAPIDoc{OpenAPI: "3.0.3", Servers: []map[string]string{{"url": s.cfg.BasePath + apiV1Path}}, Paths: map[string]map[string]*openAPIOperation{}}
+	doc.Info.Title, doc.Info.Version = "boba", "1"
+	doc.Components.Schemas = map[string]*jsonSchema{}
+	errorSchema := doc.schemaFor(reflect.TypeOf(errorResponse{}))
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	for _, route := range routes {
+		path, v1 := s.apiRoute(route.Path)
+		if !v1 {
+			continue
+		}
+		params := routeParamPattern.FindAllStringSubmatch(path, -1)
+		path = routeParamPattern.ReplaceAllString(path, "{$1}")
+		rd, ok := routeDocs[route.Method+" "+path]
+		if !ok {
+			log.Printf("No API documentation for %s %s", route.Method, path)
+		}
+
+		op := &openAPIOperation{
+			Summary: rd.Summary,
+			Responses: map[string]*openAPIResponse{
+				"200":     {Description: "Success"},
+				"default": {Description: "Error", Content: map[string]map[string]*jsonSchema{"application/json": {"schema": errorSchema}}},
+			},
+		}
+		for _, p := range params {
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: p[1], In: "path", Required: true, Schema: &jsonSchema{Type: "string"}})
+		}
+		for _, name := range rd.Query {
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: name, In: "query", Schema: &jsonSchema{Type: "string"}})
+		}
+		switch {
+		case rd.Body != nil:
+			op.RequestBody = &openAPIBody{Required: true, Content: map[string]map[string]*jsonSchema{
+				"application/json": {"schema": doc.schemaFor(reflect.TypeOf(rd.Body))},
+			}}
+		case rd.Form != nil:
+			form := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{"file": {Type: "string", Format: "binary"}}}
+			for _, name := range rd.Form {
+				form.Properties[name] = &jsonSchema{Type: "string"}
+			}
+			op.RequestBody = &openAPIBody{Required: true, Content: map[string]map[string]*jsonSchema{"multipart/form-data": {"schema": form}}}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the schema of t. Named structs are added to the
+// components once and referenced.
+func (doc *openAPIDoc) schemaFor(t reflect.Type) *jsonSchema {
+	switch t {
+	case timeType:
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &jsonSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := doc.schemaFor(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: doc.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: doc.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+		ref := &jsonSchema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+			// Set first, so a type that refers to itself ends
+			doc.Components.Schemas[t.Name()] = &jsonSchema{}
+			*doc.Components.Schemas[t.Name()] = *doc.structSchema(t)
+		}
+		return ref
+	}
+	return &jsonSchema{}
+}
+
+// structSchema lists the fields of t encoding/json reads, with those of
+// embedded structs promoted.
+func (doc *openAPIDoc) structSchema(t reflect.Type) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}}
+	for _, f := range reflect.VisibleFields(t) {
+		if len(f.Index) > 1 && !promotedField(t, f.Index) {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = doc.schemaFor(f.Type)
+	}
+	return s
+}
+
+// promotedField reports whether the field at index is reached only
+// through untagged embedded structs, as encoding/json promotes them.
+func promotedField(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); !f.Anonymous || name != "" {
+			return false
+		}
+		t = f.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+	}
+	return true
+}
+
+// serveOpenAPI returns the handler of GET /openapi.json, which documents
+// r's routes. They are all registered by the time it is first called.
+func (s *Server) serveOpenAPI(r *gin.Engine) gin.HandlerFunc {
+	var once sync.Once
+	var doc *openAPIDoc
+	return func(c *gin.Context) {
+		once.Do(func() { doc = s.buildOpenAPIDoc(r.Routes()) })
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>boba API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// swaggerUI serves Swagger UI for /openapi.json, loaded from unpkg.
+func swaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
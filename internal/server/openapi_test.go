@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// bodylessRoutes are the POST, PUT and PATCH routes that read no body.
+var bodylessRoutes = map[string]bool{"POST /keep-alive": true}
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	s := newTestServer()
+	r := s.setupRouter()
+	doc := s.buildOpenAPIDoc(r.Routes())
+	documented := map[string]bool{}
+	for _, route := range r.Routes() {
+		path, v1 := s.apiRoute(route.Path)
+		if !v1 {
+			continue
+		}
+		path = routeParamPattern.ReplaceAllString(path, "{$1}")
+		key := route.Method + " " + path
+		documented[key] = true
+
+		rd, ok := routeDocs[key]
+		if !ok {
+			t.Errorf("%s has no routeDocs entry", key)
+			continue
+		}
+		if rd.Summary == "" {
+			t.Errorf("%s has no summary", key)
+		}
+		op := doc.Paths[path][strings.ToLower(route.Method)]
+		if op == nil {
+			t.Errorf("%s is not in the document", key)
+			continue
+		}
+		if resp := op.Responses["default"]; resp == nil || resp.Content["application/json"]["schema"].Ref != "#/components/schemas/errorResponse" {
+			t.Errorf("%s does not document the error response", key)
+		}
+		takesBody := route.Method == http.MethodPost || route.Method == http.MethodPut || route.Method == http.MethodPatch
+		if takesBody && !bodylessRoutes[key] && op.RequestBody == nil {
+			t.Errorf("%s has no request body schema", key)
+		}
+	}
+	for key := range routeDocs {
+		if !documented[key] {
+			t.Errorf("routeDocs has %s, which is not a route", key)
+		}
+	}
+}
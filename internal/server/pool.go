@@ -0,0 +1,311 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const poolPingTimeout = 10 * time.Second
+
+// poolThrottleCooldown is how long a pool stays capped after the server
+// refused it a connection.
+const poolThrottleCooldown = 30 * time.Second
+
+// dbPool is the *sql.DB shared by every request that connects with the same
+// credentials, so they reuse its connections rather than dialing their own.
+type dbPool struct {
+	db    *sql.DB
+	creds dbCredentials
+	// label names the pool in logs without its password
+	label string
+
+	resource *idleResource
+
+	// throttle lifts the cap throttle set, guarded by poolManager.mu
+	throttleTimer *time.Timer
+}
+
+type poolManager struct {
+	srv           *Server
+	mu            sync.Mutex
+	pools         map[string]*dbPool // by DSN
+	heartbeatOnce sync.Once
+}
+
+// get returns the pool for dsn, opening it if there is none. created is set
+// when the pool is new, so a caller whose first ping fails can drop it.
+func (m *poolManager) get(dsn string, creds dbCredentials) (db *sql.DB, created bool, err error) {
+	m.heartbeatOnce.Do(func() { go m.heartbeat() })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.pools[dsn]; ok {
+		p.resource.touch()
+		return p.db, false, nil
+	}
+
+	if creds.usesTLS() {
+		if err := m.srv.registerTLS(creds); err != nil {
+			return nil, false, err
+		}
+	}
+	if db, err = sql.Open(driverName, dsn); err != nil {
+		return nil, false, err
+	}
+	// Connections are retired before MySQL's wait_timeout can close them
+	// under the pool
+	db.SetConnMaxLifetime(m.srv.cfg.PoolConnMaxLifetime)
+	p := &dbPool{db: db, creds: creds, label: poolLabel(creds)}
+	p.resource = m.srv.idleResources.track("connection pool", p.label, m.srv.cfg.IdleTimeout, func() bool {
+		// A pool with connections checked out is not idle
+		if db.Stats().InUse > 0 {
+			return false
+		}
+		m.remove(dsn, p)
+		return true
+	})
+	m.pools[dsn] = p
+	return db, true, nil
+}
+
+// remove closes p if it is still the pool for dsn.
+func (m *poolManager) remove(dsn string, p *dbPool) {
+	m.mu.Lock()
+	current := m.pools[dsn] == p
+	if current {
+		delete(m.pools, dsn)
+		m.releaseTLS(p.creds)
+	}
+	m.mu.Unlock()
+	if current {
+		m.srv.idleResources.untrack(p.resource)
+		p.db.Close()
+	}
+}
+
+// releaseTLS deregisters the TLS config of creds once no pool uses it, so
+// configs do not pile up in the driver. m.mu must be held.
+func (m *poolManager) releaseTLS(creds dbCredentials) {
+	if !creds.usesTLS() {
+		return
+	}
+	name := creds.tlsConfigName()
+	for _, p := range m.pools {
+		if p.creds.usesTLS() && p.creds.tlsConfigName() == name {
+			return
+		}
+	}
+	mysql.DeregisterTLSConfig(name)
+}
+
+// discard drops the pool for dsn if it is still db, after its first
+// connection failed.
+func (m *poolManager) discard(dsn string, db *sql.DB) {
+	m.mu.Lock()
+	p, ok := m.pools[dsn]
+	m.mu.Unlock()
+	if ok && p.db == db {
+		m.remove(dsn, p)
+	}
+}
+
+// evict closes the pools opened with creds, so a profile that was changed
+// or deleted stops connecting the old way. Queries still running on them
+// fail.
+func (m *poolManager) evict(creds dbCredentials) {
+	m.mu.Lock()
+	var stale []*dbPool
+	var dsns []string
+	for dsn, p := range m.pools {
+		if sameCredentials(p.creds, creds) {
+			stale = append(stale, p)
+			dsns = append(dsns, dsn)
+		}
+	}
+	m.mu.Unlock()
+	for i, p := range stale {
+		m.remove(dsns[i], p)
+		log.Printf("Closed connection pool %s after its profile changed", p.label)
+	}
+}
+
+// heartbeat pings every pool each cfg.PoolHeartbeat, which keeps an idle
+// connection from reaching the server's wait_timeout and logs servers that
+// stopped answering. A connection found dead is dropped by database/sql
+// and redialed by the next query, which withRetry covers.
+func (m *poolManager) heartbeat() {
+	if m.srv.cfg.PoolHeartbeat <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.srv.cfg.PoolHeartbeat)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, p := range m.list() {
+			ctx, cancel := context.WithTimeout(context.Background(), poolPingTimeout)
+			if err := p.db.PingContext(ctx); err != nil {
+				log.Printf("Heartbeat of connection pool %s failed: %s", p.label, sanitizeError(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// list returns the open pools.
+func (m *poolManager) list() []*dbPool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pools := make([]*dbPool, 0, len(m.pools))
+	for _, p := range m.pools {
+		pools = append(pools, p)
+	}
+	return pools
+}
+
+// throttle caps the pool of db at the connections it has open, after the
+// server refused it another with too many connections, so later requests
+// wait for one of those rather than dialing more. The cap lifts once
+// poolThrottleCooldown passes without another refusal.
+func (m *poolManager) throttle(db *sql.DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var p *dbPool
+	for _, candidate := range m.pools {
+		if candidate.db == db {
+			p = candidate
+			break
+		}
+	}
+	if p == nil {
+		return
+	}
+	if p.throttleTimer != nil {
+		p.throttleTimer.Reset(poolThrottleCooldown)
+		return
+	}
+	limit := max(db.Stats().OpenConnections, 1)
+	db.SetMaxOpenConns(limit)
+	log.Printf("Capped connection pool %s at %d connections after the server refused another", p.label, limit)
+	p.throttleTimer = time.AfterFunc(poolThrottleCooldown, func() {
+		m.mu.Lock()
+		p.throttleTimer = nil
+		m.mu.Unlock()
+		db.SetMaxOpenConns(0)
+		// Lowering the cap lowered the idle connections kept too; this is
+		// database/sql's default
+		db.SetMaxIdleConns(2)
+	})
+}
+
+// throttleOnRefusal throttles the pool of q when err is the server
+// refusing a connection. Queries on a connection or transaction, which
+// already hold theirs, are left alone.
+func (s *Server) throttleOnRefusal(q queryer, err error) {
+	if !isTooManyConnections(err) {
+		return
+	}
+	switch q := q.(type) {
+	case *sql.DB:
+		s.dbPools.throttle(q)
+	case *poolConn:
+		s.dbPools.throttle(q.db)
+	}
+}
+
+// poolLabel names the pool for creds as user@host/database.
+func poolLabel(creds dbCredentials) string {
+	addr := creds.Socket
+	if addr == "" {
+		addr = net.JoinHostPort(creds.Host, creds.Port)
+	}
+	return creds.Username + "@" + addr + "/" + creds.Database
+}
+
+// discardConn closes conn instead of returning it to its pool, for
+// connections left with session state such as session variables that the
+// next request must not inherit.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// poolConn is a connection taken from db by the first statement run on it
+// and kept for the ones after, as SHOW WARNINGS and SHOW SESSION STATUS only
+// see the statements of their own connection. A statement that fails hands
+// the connection back, so queryWithRetry can retry it on a fresh one as it
+// would on db itself; nothing a poolConn runs may leave session state a
+// retry would need.
+type poolConn struct {
+	db   *sql.DB
+	conn *sql.Conn
+	// discard closes the connection with discardConn rather than returning
+	// it to db, for statements that may leave session state behind
+	discard bool
+}
+
+func (p *poolConn) take(ctx context.Context) (*sql.Conn, error) {
+	if p.conn == nil {
+		conn, err := p.db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+	}
+	return p.conn, nil
+}
+
+// done hands the connection back when err says the statement failed.
+func (p *poolConn) done(err error) {
+	if err != nil && p.conn != nil {
+		p.close()
+	}
+}
+
+func (p *poolConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	conn, err := p.take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, query, args...)
+	p.done(err)
+	return rows, err
+}
+
+func (p *poolConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	conn, err := p.take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := conn.ExecContext(ctx, query, args...)
+	p.done(err)
+	return result, err
+}
+
+// QueryRowContext runs query on the pool itself when no connection can be
+// had, as a *sql.Row cannot be made to carry the error.
+func (p *poolConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	conn, err := p.take(ctx)
+	if err != nil {
+		return p.db.QueryRowContext(ctx, query, args...)
+	}
+	return conn.QueryRowContext(ctx, query, args...)
+}
+
+// close hands the connection, if one was taken, back.
+func (p *poolConn) close() {
+	if p.conn == nil {
+		return
+	}
+	if p.discard {
+		discardConn(p.conn)
+	} else {
+		p.conn.Close()
+	}
+	p.conn = nil
+}
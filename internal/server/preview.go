@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	previewDefaultLimit = 100
+	previewMaxLimit     = 1000
+)
+
+type previewRequest struct {
+	connectionRef
+	Table string `json:"table"`
+	// Limit caps the rows returned; previewDefaultLimit when zero
+	Limit int `json:"limit"`
+}
+
+// previewTable returns the first rows of a table, in the /execute-query
+// result shape, for browsing a table without writing SQL.
+func (s *Server) previewTable(c *gin.Context) {
+	var req previewRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	table, ok := parseTableName(req.Table)
+	if !ok {
+		respondBadRequest(c, "A table name of letters, digits, _ and $, optionally schema-qualified, is required")
+		return
+	}
+	if req.Limit < 0 || req.Limit > previewMaxLimit {
+		respondBadRequest(c, fmt.Sprintf("limit must be between 1 and %d", previewMaxLimit))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = previewDefaultLimit
+	}
+
+	query := "SELECT * FROM " + table.quoted() + " LIMIT ?"
+	if !s.isQueryAllowed(query) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+
+	rows, err := s.queryWithRetry(c.Request.Context(), db, query, req.Limit)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, scanOptions{})
+	results := []map[string]any{}
+	for rows.Next() {
+		row, err := scanner.scan(rows)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	editable := notEditable("The connection is read-only")
+	if !creds.ReadOnly {
+		editable = tableEditability(c.Request.Context(), db, table, scanner.columns)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"columns":  scanner.columns,
+		"results":  results,
+		"count":    len(results),
+		"editable": editable,
+	})
+}
+
+type countRequest struct {
+	connectionRef
+	Table string `json:"table"`
+	// Exact counts the rows even on a large table
+	Exact bool `json:"exact"`
+}
+
+// countRows returns the row count of a table: exact with COUNT(*) for
+// tables information_schema estimates at up to cfg.LintLargeTableRows
+// rows, the estimate for larger ones unless exact is set, so sizing a huge
+// table never scans it by surprise.
+func (s *Server) countRows(c *gin.Context) {
+	var req countRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	table, ok := parseTableName(req.Table)
+	if !ok {
+		respondBadRequest(c, "A table name of letters, digits, _ and $, optionally schema-qualified, is required")
+		return
+	}
+
+	db, _, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if !req.Exact {
+		// Views and missing tables have no estimate and are counted
+		estimate, ok := tableRows(ctx, db, table)
+		if ok && estimate > int64(s.cfg.LintLargeTableRows) {
+			c.JSON(http.StatusOK, gin.H{"table": table.String(), "count": estimate, "exact": false})
+			return
+		}
+	}
+
+	query := "SELECT COUNT(*) FROM " + table.quoted()
+	if !s.isQueryAllowed(query) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+	var count int64
+	if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"table": table.String(), "count": count, "exact": true})
+}
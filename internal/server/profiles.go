@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errProfileNotFound = errors.New("profile not found")
+
+// storedProfile is a saved connection profile. The full credentials,
+// password included, are kept only in Sealed, encrypted with
+// BOBA_SECRET_KEY; the plain fields exist for listing.
+type storedProfile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username"`
+	Host      string    `json:"host"`
+	Port      string    `json:"port"`
+	Database  string    `json:"database"`
+	Sealed    []byte    `json:"sealed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// public returns the profile as shown to clients, without secrets.
+func (p storedProfile) public() gin.H {
+	return gin.H{
+		"id":         p.ID,
+		"name":       p.Name,
+		"username":   p.Username,
+		"host":       p.Host,
+		"port":       p.Port,
+		"database":   p.Database,
+		"created_at": p.CreatedAt,
+		"updated_at": p.UpdatedAt,
+	}
+}
+
+func (s *Server) sealProfile(p *storedProfile, creds dbCredentials) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	if p.Sealed, err = s.encryptSecret(data); err != nil {
+		return err
+	}
+	p.Username = creds.Username
+	p.Host = creds.Host
+	p.Port = creds.Port
+	p.Database = creds.Database
+	return nil
+}
+
+func (s *Server) unsealProfile(p storedProfile) (dbCredentials, error) {
+	data, err := s.decryptSecret(p.Sealed)
+	if err != nil {
+		return dbCredentials{}, err
+	}
+	var creds dbCredentials
+	err = json.Unmarshal(data, &creds)
+	return creds, err
+}
+
+type profileRequest struct {
+	Name        string        `json:"name"`
+	Credentials dbCredentials `json:"credentials"`
+}
+
+func (s *Server) loadProfile(id string) (storedProfile, error) {
+	var p storedProfile
+	found, err := s.storeGet(profilesBucket, id, &p)
+	if err != nil {
+		return p, err
+	}
+	if !found {
+		return p, errProfileNotFound
+	}
+	return p, nil
+}
+
+// profileCredentials returns the decrypted credentials of profile id.
+func (s *Server) profileCredentials(id string) (dbCredentials, error) {
+	p, err := s.loadProfile(id)
+	if err != nil {
+		return dbCredentials{}, err
+	}
+	return s.unsealProfile(p)
+}
+
+// profileErrorStatus maps profile and store errors to an HTTP status.
+func profileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errProfileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errSecretKeyUnset), errors.Is(err, errStoreClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func respondProfileError(c *gin.Context, err error) {
+	respondStatusError(c, profileErrorStatus(err), err)
+}
+
+func (s *Server) createProfile(c *gin.Context) {
+	var req profileRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Name == "" || req.Credentials.Host == "" {
+		respondBadRequest(c, "Profile name and host are required")
+		return
+	}
+
+	now := time.Now().UTC()
+	p := storedProfile{ID: newID(), Name: req.Name, CreatedAt: now, UpdatedAt: now}
+	if err := s.sealProfile(&p, req.Credentials); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	if err := s.storePut(profilesBucket, p.ID, p); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, p.public())
+}
+
+func (s *Server) listProfiles(c *gin.Context) {
+	profiles := []gin.H{}
+	err := s.storeEach(profilesBucket, func(_ string, data []byte) error {
+		var p storedProfile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		profiles = append(profiles, p.public())
+		return nil
+	})
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i]["name"].(string) < profiles[j]["name"].(string)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles})
+}
+
+func (s *Server) getProfile(c *gin.Context) {
+	p, err := s.loadProfile(c.Param("id"))
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p.public())
+}
+
+// updateProfile replaces a profile's name and credentials. An empty
+// password or missing ssh block keeps the stored one, since clients never
+// see the existing secrets.
+func (s *Server) updateProfile(c *gin.Context) {
+	var req profileRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	p, err := s.loadProfile(c.Param("id"))
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	current, err := s.unsealProfile(p)
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	creds := req.Credentials
+	if creds.Password == "" {
+		creds.Password = current.Password
+	}
+	if creds.SSH == nil {
+		creds.SSH = current.SSH
+	}
+	if !creds.usesTLS() {
+		creds.CACert, creds.ClientCert, creds.ClientKey = current.CACert, current.ClientCert, current.ClientKey
+	}
+	if req.Name != "" {
+		p.Name = req.Name
+	}
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.sealProfile(&p, creds); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	if err := s.storePut(profilesBucket, p.ID, p); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	s.dbPools.evict(current)
+
+	c.JSON(http.StatusOK, p.public())
+}
+
+func (s *Server) deleteProfile(c *gin.Context) {
+	// Read first, so the profile's connection pool can be closed after
+	current, credsErr := s.profileCredentials(c.Param("id"))
+	found, err := s.storeDelete(profilesBucket, c.Param("id"))
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+	if !found {
+		respondProfileError(c, errProfileNotFound)
+		return
+	}
+	if credsErr == nil {
+		s.dbPools.evict(current)
+	}
+	c.Status(http.StatusNoContent)
+}
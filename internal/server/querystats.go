@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// handlerCounters reads the session's Handler_% status counters, which
+// count the row reads and writes of the storage engine.
+func handlerCounters(ctx context.Context, q queryer) (map[string]int64, error) {
+	rows, err := q.QueryContext(ctx, "SHOW SESSION STATUS LIKE 'Handler%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counters := map[string]int64{}
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if n, err := strconv.ParseInt(value.String, 10, 64); err == nil {
+			counters[name] = n
+		}
+	}
+	return counters, rows.Err()
+}
+
+// diffCounters returns how much each counter grew from before to after,
+// leaving out those that did not move.
+func diffCounters(before, after map[string]int64) map[string]int64 {
+	diff := map[string]int64{}
+	for name, n := range after {
+		if d := n - before[name]; d != 0 {
+			diff[name] = d
+		}
+	}
+	return diff
+}
+
+// serverWarnings returns the warnings the last statement on q raised, as
+// SHOW WARNINGS lists them. q must be the connection the statement ran on.
+func serverWarnings(ctx context.Context, q queryer) ([]lintWarning, error) {
+	rows, err := q.QueryContext(ctx, "SHOW WARNINGS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var warnings []lintWarning
+	for rows.Next() {
+		var w lintWarning
+		if err := rows.Scan(&w.Level, &w.Code, &w.Message); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings, rows.Err()
+}
+
+// rowsPerSecond is the scan rate of count rows read in elapsed.
+func rowsPerSecond(count int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / elapsed.Seconds()
+}
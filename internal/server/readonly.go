@@ -0,0 +1,143 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// readOnlyKeywords are the leading keywords of statements allowed on a
+// read-only connection.
+var readOnlyKeywords = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+	"WITH":     true,
+	"TABLE":    true,
+	"VALUES":   true,
+}
+
+// stripLeadingComments returns query from its first token that is not
+// whitespace or a comment, so users can annotate what they paste. The text
+// of a leading /*! */ comment, which MySQL runs, is kept without its
+// version number: "/*!40101 SET x = 1 */" strips to "SET x = 1 ". An
+// unterminated comment strips to "", as it hides the rest of the query.
+func stripLeadingComments(query string) string {
+	for {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(query, "#") || isLineCommentStart(query, 0):
+			_, rest, ok := strings.Cut(query, "\n")
+			if !ok {
+				return ""
+			}
+			query = rest
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query[2:], "*/")
+			if end == -1 {
+				return ""
+			}
+			body, rest := query[2:2+end], query[2+end+2:]
+			if !strings.HasPrefix(body, "!") {
+				query = rest
+				continue
+			}
+			body = strings.TrimLeftFunc(body[1:], func(r rune) bool { return r >= '0' && r <= '9' })
+			query = body + " " + rest
+		default:
+			return query
+		}
+	}
+}
+
+// firstKeyword returns the upper-cased leading keyword of query, skipping
+// whitespace, comments and opening parentheses.
+func firstKeyword(query string) string {
+	for {
+		query = stripLeadingComments(query)
+		if !strings.HasPrefix(query, "(") {
+			break
+		}
+		query = query[1:]
+	}
+	end := strings.IndexFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if end == -1 {
+		end = len(query)
+	}
+	return strings.ToUpper(query[:end])
+}
+
+// writeKeywords lead the statements that change rows. They can also come
+// after a WITH list of common table expressions, and after EXPLAIN
+// ANALYZE, which runs the statement it explains.
+var writeKeywords = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+}
+
+// isReadOnlyQuery reports whether query is a read-only statement: it
+// starts with a read-only keyword, the statement a WITH list or EXPLAIN
+// ANALYZE leads is not a write, and it writes no file with INTO OUTFILE or
+// DUMPFILE. Read-only connections also mark the session
+// transaction_read_only, so there this is a fast, friendly rejection; for
+// the result cache and retries it is the only check.
+func isReadOnlyQuery(query string) bool {
+	keyword := firstKeyword(query)
+	if !readOnlyKeywords[keyword] {
+		return false
+	}
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return false
+	}
+	tokens = significantTokens(tokens)
+
+	// led is set while looking for the statement WITH or EXPLAIN ANALYZE
+	// leads, the first SELECT, TABLE, VALUES or write outside parentheses
+	led := keyword == "WITH"
+	depth := 0
+	for i, t := range tokens {
+		word := ""
+		if t.is(tokWord) {
+			word = strings.ToUpper(t.text)
+		}
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		case word == "INTO" && i+1 < len(tokens) && (tokens[i+1].isWord("OUTFILE") || tokens[i+1].isWord("DUMPFILE")):
+			return false
+		case word == "ANALYZE" && i == 1 && (keyword == "EXPLAIN" || keyword == "DESCRIBE" || keyword == "DESC"):
+			led = true
+		case led && depth == 0 && writeKeywords[word]:
+			return false
+		case led && depth == 0 && (word == "SELECT" || word == "TABLE" || word == "VALUES"):
+			led = false
+		}
+	}
+	return true
+}
+
+// isQueryAllowed checks query against cfg.QueryAllow and cfg.QueryBlock.
+func (s *Server) isQueryAllowed(query string) bool {
+	if len(s.cfg.QueryAllow) > 0 && !matchesAny(s.cfg.QueryAllow, query) {
+		return false
+	}
+	return !matchesAny(s.cfg.QueryBlock, query)
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
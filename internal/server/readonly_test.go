@@ -0,0 +1,97 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsReadOnlyQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM t", true},
+		{"  /* report */ (SELECT 1)", true},
+		{"SHOW TABLES", true},
+		{"EXPLAIN DELETE FROM t", true},
+		{"TABLE t", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"WITH RECURSIVE x (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM x WHERE n < 5) SELECT * FROM x", true},
+		{"WITH x AS (SELECT id FROM t) SELECT * FROM x FOR UPDATE", true},
+		{"SELECT 'INTO OUTFILE' FROM t", true},
+		{"SELECT a INTO @a FROM t", true},
+		{"SELECT * FROM t WHERE note = 'delete'", true},
+
+		{"DELETE FROM t", false},
+		{"INSERT INTO t VALUES (1)", false},
+		{"WITH x AS (SELECT 1) DELETE FROM t", false},
+		{"WITH x AS (SELECT id FROM t) UPDATE t JOIN x USING (id) SET a = 1", false},
+		{"with x as (select 1) insert into t select * from x", false},
+		{"SELECT * FROM t INTO OUTFILE '/tmp/t.csv'", false},
+		{"SELECT a INTO DUMPFILE '/tmp/a' FROM t", false},
+		{"TABLE t INTO OUTFILE '/tmp/t'", false},
+		{"EXPLAIN ANALYZE DELETE FROM t", false},
+		{"SELECT 'unterminated", false},
+	}
+	for _, tt := range tests {
+		if got := isReadOnlyQuery(tt.query); got != tt.want {
+			t.Errorf("isReadOnlyQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStripLeadingComments(t *testing.T) {
+	tests := []struct{ query, want string }{
+		{"SELECT 1", "SELECT 1"},
+		{"  \n\tSELECT 1", "SELECT 1"},
+		{"-- report\nSELECT 1", "SELECT 1"},
+		{"# report\nSELECT 1", "SELECT 1"},
+		{"/* report */ SELECT 1", "SELECT 1"},
+		{"/* a */ -- b\n/* c\n d */\n# e\n  DELETE FROM t", "DELETE FROM t"},
+		{"/*!40101 SET x = 1 */", "SET x = 1  "},
+		{"--not a comment", "--not a comment"},
+		{"-- only a comment", ""},
+		{"/* unterminated SELECT 1", ""},
+	}
+	for _, tt := range tests {
+		if got := stripLeadingComments(tt.query); got != tt.want {
+			t.Errorf("stripLeadingComments(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestLeadingCommentsDoNotHideTheStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		keyword  string
+		readOnly bool
+	}{
+		{"-- delete old rows\nSELECT * FROM t", "SELECT", true},
+		{"/* SELECT */ DELETE FROM t", "DELETE", false},
+		{"# select\nUPDATE t SET a = 1", "UPDATE", false},
+		{"/* a */ -- b\n  ( /* c */ SELECT 1)", "SELECT", true},
+		{"-- x\n/* y */ WITH d AS (SELECT 1) DELETE FROM t", "WITH", false},
+		{"/*!50000 DROP TABLE t */", "DROP", false},
+		{"/* shipped */ show tables", "SHOW", true},
+	}
+	for _, tt := range tests {
+		if got := firstKeyword(tt.query); got != tt.keyword {
+			t.Errorf("firstKeyword(%q) = %q, want %q", tt.query, got, tt.keyword)
+		}
+		if got := isReadOnlyQuery(tt.query); got != tt.readOnly {
+			t.Errorf("isReadOnlyQuery(%q) = %v, want %v", tt.query, got, tt.readOnly)
+		}
+	}
+
+	stmts, err := analyzeStatements("-- first\nSELECT 1; /* second */ DELETE FROM t; # third\n UPDATE t SET a = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, st := range stmts {
+		kinds = append(kinds, st.kind)
+	}
+	if got := strings.Join(kinds, " "); got != "SELECT DELETE UPDATE" {
+		t.Errorf("statement kinds = %s", got)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recoveryMiddleware turns a handler panic into the 500 JSON error every
+// other failure returns, logging the stack with the request ID. A
+// response already under way cannot be replaced, so it is cut short.
+func recoveryMiddleware(c *gin.Context) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(rec)
+		}
+		log.Printf("Panic serving %s %s: %v request_id=%s\n%s", c.Request.Method, c.Request.URL.Path, rec, requestID(c), debug.Stack())
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		respondError(c, http.StatusInternalServerError, codeInternal, "internal server error")
+		c.Abort()
+	}()
+	c.Next()
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecoveryRespondsWithJSON(t *testing.T) {
+	s := newTestServer()
+	r := s.setupRouter()
+	r.GET("/panic", func(*gin.Context) { panic("boom") })
+	r.GET("/panic-large", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("x", 4*s.cfg.GzipMinSize))
+		panic("boom")
+	})
+
+	for _, encoding := range []string{"", "gzip"} {
+		t.Run("encoding="+encoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want 500", w.Code)
+			}
+			var body io.Reader = w.Body
+			if w.Header().Get("Content-Encoding") == "gzip" {
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			var resp struct{ Error apiError }
+			if err := json.NewDecoder(body).Decode(&resp); err != nil {
+				t.Fatalf("body is not the JSON error: %v", err)
+			}
+			if resp.Error.Code != codeInternal || resp.Error.RequestID == "" {
+				t.Errorf("error = %+v, want code %q with a request ID", resp.Error, codeInternal)
+			}
+		})
+	}
+
+	t.Run("after writing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/panic-large", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(gz)
+		if strings.Contains(string(data), codeInternal) {
+			t.Error("JSON error appended to a response already under way")
+		}
+	})
+}
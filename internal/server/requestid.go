@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin and request context key of the request ID.
+type requestIDKey struct{}
+
+const requestIDContextKey = "requestID"
+
+// validRequestID limits a client's ID to characters that are safe in a log
+// line and a header, so one cannot forge log fields.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware gives every request an ID, the client's X-Request-ID
+// when it is usable and a new UUID otherwise, and echoes it in the
+// response header.
+func requestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDContextKey, id)
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("boba.request_id", id))
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+// requestID is the ID of the request, "" outside requestIDMiddleware.
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// contextRequestID is the ID of the request ctx derives from, for code that
+// only has the query's context.
+func contextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequestf logs a line about the request c with its ID appended.
+func logRequestf(c *gin.Context, format string, args ...any) {
+	logContextf(c.Request.Context(), format, args...)
+}
+
+// logContextf logs a line about the request ctx derives from with its ID
+// appended, when it has one.
+func logContextf(ctx context.Context, format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	if id := contextRequestID(ctx); id != "" {
+		line += " request_id=" + id
+	}
+	log.Print(line)
+}
+
+// accessLogLine is the access log format, gin's fields as key=value pairs
+// with the request ID.
+func accessLogLine(p gin.LogFormatterParams) string {
+	line := fmt.Sprintf("[GIN] time=%s status=%d latency=%s client=%s method=%s path=%q request_id=%s",
+		p.TimeStamp.Format(time.RFC3339), p.StatusCode, p.Latency, p.ClientIP, p.Method, p.Path, p.Keys[requestIDContextKey])
+	if p.ErrorMessage != "" {
+		line += fmt.Sprintf(" error=%q", p.ErrorMessage)
+	}
+	return line + "\n"
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resultCacheMaxTTL caps how long a result can be cached, which is also
+// how long a session's writes are remembered.
+const resultCacheMaxTTL = time.Hour
+
+// cacheOptions opt a query into the result cache.
+type cacheOptions struct {
+	// TTLSeconds is how long the result is served from the cache, up to
+	// resultCacheMaxTTL
+	TTLSeconds int `json:"ttlSeconds"`
+}
+
+// cachedResult is a serialized /execute-query response.
+type cachedResult struct {
+	key        string
+	database   string
+	body       []byte
+	executedAt time.Time
+	expires    time.Time
+}
+
+// resultCache holds the results of read-only queries that asked to be
+// cached, evicting the least recently used once cfg.ResultCacheBytes is
+// reached. It also keeps when each session last wrote to each database,
+// so a session never gets a cached result from before its own write.
+type resultCache struct {
+	maxBytes int64
+	mu       sync.Mutex
+	entries  map[string]*list.Element // of *cachedResult
+	lru      *list.List
+	size     int64
+	// writes is, by session and then database, when the session last ran
+	// a write
+	writes map[string]map[string]time.Time
+}
+
+func newResultCache(c *config) *resultCache {
+	return &resultCache{
+		maxBytes: c.ResultCacheBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		writes:   map[string]map[string]time.Time{},
+	}
+}
+
+// cacheKeySecret keys the cache key HMAC, so a key, which covers the
+// password, cannot be tested against guesses outside the process.
+var cacheKeySecret = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// cacheKey identifies a query's result: the normalized query text and its
+// arguments, what affects how rows are decoded, and every credential it
+// runs with, password, SSH secrets and certificates included. A result is
+// therefore only served to requests that could log in and run the query
+// themselves, even though the lookup comes before connecting.
+func cacheKey(p preparedQuery) string {
+	h := hmac.New(sha256.New, cacheKeySecret)
+	json.NewEncoder(h).Encode([]any{
+		normalizeQueryText(p.query), p.args, p.sessionVariables, p.useDatabase,
+		p.scan.rawJSON, p.scan.booleanTinyint, p.scan.boolColumns, p.scan.geoJSON,
+		p.creds,
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheDatabase names the database creds connect to, for tracking writes.
+func cacheDatabase(creds dbCredentials) string {
+	addr := creds.Socket
+	if addr == "" {
+		addr = net.JoinHostPort(creds.Host, creds.Port)
+	}
+	return addr + "/" + creds.Database
+}
+
+// normalizeQueryText drops comments and collapses whitespace, so queries
+// that differ only in layout share a cache entry.
+func normalizeQueryText(query string) string {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return query
+	}
+	tokens = significantTokens(tokens)
+	parts := make([]string, len(tokens))
+	for i, t := range tokens {
+		parts[i] = t.text
+	}
+	return strings.Join(parts, " ")
+}
+
+// get returns the cached result for key unless it expired or session wrote
+// to its database after it was cached.
+func (rc *resultCache) get(session, key string) (*cachedResult, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cachedResult)
+	if time.Now().After(entry.expires) {
+		rc.remove(el)
+		return nil, false
+	}
+	if written, ok := rc.writes[session][entry.database]; ok && !written.Before(entry.executedAt) {
+		return nil, false
+	}
+	rc.lru.MoveToFront(el)
+	return entry, true
+}
+
+// put caches the response of a query run with creds at executedAt,
+// replacing any earlier result for the same key. Results larger than the
+// whole cache are not kept.
+func (rc *resultCache) put(key string, creds dbCredentials, response any, executedAt time.Time, ttl time.Duration) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	size := int64(len(body))
+	if size > rc.maxBytes {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[key]; ok {
+		rc.remove(el)
+	}
+	entry := &cachedResult{key: key, database: cacheDatabase(creds), body: body, executedAt: executedAt, expires: time.Now().Add(ttl)}
+	rc.entries[key] = rc.lru.PushFront(entry)
+	rc.size += size
+	for rc.size > rc.maxBytes {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+// remove drops el; rc.mu must be held.
+func (rc *resultCache) remove(el *list.Element) {
+	entry := rc.lru.Remove(el).(*cachedResult)
+	delete(rc.entries, entry.key)
+	rc.size -= int64(len(entry.body))
+}
+
+// noteWrite records that session wrote to the database of creds, so its
+// next cached reads of it are refreshed.
+func (rc *resultCache) noteWrite(session string, creds dbCredentials) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	// Writes older than any cached result can be are of no more use
+	for s, dbs := range rc.writes {
+		for db, t := range dbs {
+			if now.Sub(t) > resultCacheMaxTTL {
+				delete(dbs, db)
+			}
+		}
+		if len(dbs) == 0 {
+			delete(rc.writes, s)
+		}
+	}
+	if rc.writes[session] == nil {
+		rc.writes[session] = map[string]time.Time{}
+	}
+	rc.writes[session][cacheDatabase(creds)] = now
+}
+
+// respondCached writes a cached result, marked with when it was executed.
+func respondCached(c *gin.Context, entry *cachedResult) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(entry.body, &response); err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "The cached result could not be read")
+		return
+	}
+	response["cached"] = json.RawMessage("true")
+	response["cachedAt"], _ = json.Marshal(entry.executedAt.UTC())
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// transientErrorNumbers are MySQL server errors that are worth retrying.
+var transientErrorNumbers = map[uint16]bool{
+	1040: true, // ER_CON_COUNT_ERROR: too many connections
+	1203: true, // ER_TOO_MANY_USER_CONNECTIONS
+}
+
+// isTransientError reports whether err is a network blip or server
+// overload that may succeed on retry. Syntax, permission and other
+// deterministic errors are never transient.
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return transientErrorNumbers[mysqlErr.Number]
+	}
+
+	// The driver reports "server gone away" and "lost connection" (2006
+	// and 2013 in the C client) as ErrInvalidConn.
+	return errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// lockErrorNumbers are the lock conflicts a request's retry policy retries.
+// The statement was rolled back, and may well succeed once the other
+// transaction is done.
+var lockErrorNumbers = map[uint16]bool{
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+}
+
+func isLockConflict(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && lockErrorNumbers[mysqlErr.Number]
+}
+
+// isTooManyConnections reports whether err is the server refusing a
+// connection because it or the account has as many as it allows.
+func isTooManyConnections(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1040 || mysqlErr.Number == 1203)
+}
+
+// isRefusedConnection reports whether err is the server turning a new
+// connection away, so no statement reached it.
+func isRefusedConnection(err error) bool {
+	return isTooManyConnections(err) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// withRetry runs fn until it succeeds, fails with a non-transient error, or
+// cfg.RetryAttempts is exhausted, with exponential backoff between tries.
+func (s *Server) withRetry(ctx context.Context, fn func() error) error {
+	return s.retryWhile(ctx, isTransientError, fn)
+}
+
+// retryWhile is withRetry retrying the errors retryable accepts.
+func (s *Server) retryWhile(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	backoff := s.cfg.RetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= s.cfg.RetryAttempts || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// queryer runs queries on a pool, a dedicated connection or a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// queryWithRetry is db.QueryContext retried on transient errors, when that
+// is safe. Only a pool, or a poolConn that takes a fresh connection from
+// one, is retried, as a lost dedicated connection or transaction is gone
+// for good. A read-only statement is retried on any transient error, but a
+// write only when the server refused the connection: one cut off by a lost
+// connection may have committed.
+func (s *Server) queryWithRetry(ctx context.Context, db queryer, query string, args ...any) (*sql.Rows, error) {
+	retryable := func(error) bool { return false }
+	switch db.(type) {
+	case *sql.DB, *poolConn:
+		retryable = isRefusedConnection
+		if isReadOnlyQuery(query) {
+			retryable = isTransientError
+		}
+	}
+	var rows *sql.Rows
+	err := s.retryWhile(ctx, retryable, func() error {
+		var err error
+		rows, err = db.QueryContext(ctx, query, args...)
+		s.throttleOnRefusal(db, err)
+		return err
+	})
+	return rows, err
+}
+
+const (
+	retryMaxRetries   = 10
+	retryMaxBackoffMs = 10000
+)
+
+// retryOptions opt a query in to retrying lock conflicts, on top of the
+// transient errors every query retries.
+type retryOptions struct {
+	// Max is the number of retries after the first attempt
+	Max int `json:"max"`
+	// BackoffMs is the wait before the first retry, doubled before each
+	// further one; 0 waits cfg.RetryBackoff
+	BackoffMs int `json:"backoffMs"`
+}
+
+// retryPolicy is how a query retries lock conflicts; the zero policy does
+// not.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// retryPolicy checks req.Retries for query. Read-only statements may always
+// be retried; writes, including those a WITH list leads, only when
+// req.Idempotent says running them again is harmless. Other statements are
+// never retried.
+func (s *Server) retryPolicy(req *queryRequest, query string) (retryPolicy, error) {
+	if req.Retries == nil {
+		return retryPolicy{}, nil
+	}
+	if req.Retries.Max < 1 || req.Retries.Max > retryMaxRetries {
+		return retryPolicy{}, fmt.Errorf("retries.max must be between 1 and %d", retryMaxRetries)
+	}
+	if req.Retries.BackoffMs < 0 || req.Retries.BackoffMs > retryMaxBackoffMs {
+		return retryPolicy{}, fmt.Errorf("retries.backoffMs must be between 0 and %d", retryMaxBackoffMs)
+	}
+	keyword := firstKeyword(query)
+	switch {
+	case isReadOnlyQuery(query):
+	case writeKeywords[keyword] || keyword == "WITH":
+		if !req.Idempotent {
+			return retryPolicy{}, fmt.Errorf("%s statements are only retried when the request sets idempotent", keyword)
+		}
+	default:
+		return retryPolicy{}, fmt.Errorf("%s statements cannot be retried", keyword)
+	}
+	backoff := s.cfg.RetryBackoff
+	if req.Retries.BackoffMs > 0 {
+		backoff = time.Duration(req.Retries.BackoffMs) * time.Millisecond
+	}
+	return retryPolicy{retries: req.Retries.Max, backoff: backoff}, nil
+}
+
+// queryWithPolicy is queryWithRetry run again under p while it fails with a
+// lock conflict. Only the statement is retried: a conflict while its rows
+// are read fails the query. It gives up with the last error when ctx, which
+// carries the query's timeout, would end before the next attempt, and
+// returns the number of attempts made.
+func (s *Server) queryWithPolicy(ctx context.Context, db queryer, p retryPolicy, query string, args ...any) (*sql.Rows, int, error) {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		rows, err := s.queryWithRetry(ctx, db, query, args...)
+		if err == nil || attempt > p.retries || !isLockConflict(err) {
+			return rows, attempt, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return nil, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, attempt, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestQueryWithRetryOnlyRepeatsSafeStatements(t *testing.T) {
+	s := newTestServer(func(c *config) { c.RetryAttempts, c.RetryBackoff = 3, time.Millisecond })
+	tooMany := &mysql.MySQLError{Number: 1040, Message: "Too many connections"}
+
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		dedicate bool
+		attempts int
+	}{
+		{"select on lost connection", "SELECT 1", mysql.ErrInvalidConn, false, 3},
+		{"update on lost connection", "UPDATE t SET a = 1", mysql.ErrInvalidConn, false, 1},
+		{"cte delete on lost connection", "WITH x AS (SELECT 1) DELETE FROM t", mysql.ErrInvalidConn, false, 1},
+		{"update refused", "UPDATE t SET a = 1", tooMany, false, 3},
+		{"select on a dedicated connection", "SELECT 1", mysql.ErrInvalidConn, true, 1},
+		{"syntax error", "SELEC 1", &mysql.MySQLError{Number: 1064}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			for range tt.attempts {
+				mock.ExpectQuery(tt.query).WillReturnError(tt.err)
+			}
+
+			var q queryer = db
+			if tt.dedicate {
+				conn, err := db.Conn(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				q = conn
+			}
+			// A further attempt fails with sqlmock's error instead
+			if _, err := s.queryWithRetry(context.Background(), q, tt.query); !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("want %d attempts: %v", tt.attempts, err)
+			}
+		})
+	}
+}
+
+func TestExecuteQueryRetriesOnFreshConnection(t *testing.T) {
+	s := newTestServer(func(c *config) { c.RetryAttempts, c.RetryBackoff = 3, time.Millisecond })
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("SELECT 1").WillReturnError(mysql.ErrInvalidConn)
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	w := postJSON(t, s, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"SELECT 1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+}
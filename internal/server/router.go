@@ -0,0 +1,1050 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+type dbCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Database string `json:"database"`
+	// Socket connects over a Unix socket instead of TCP; Host and Port are
+	// ignored when it is set
+	Socket string `json:"socket"`
+	// SSH optionally tunnels the connection through a jump host
+	SSH *sshCredentials `json:"ssh,omitempty"`
+	// ReadOnly rejects statements that could modify data
+	ReadOnly bool `json:"read_only"`
+	// ConnectTimeout is how many seconds connecting may take;
+	// defaultConnectTimeout when zero
+	ConnectTimeout int `json:"connect_timeout"`
+	// Charset and Collation override the connection's utf8mb4 default
+	Charset   string `json:"charset,omitempty"`
+	Collation string `json:"collation,omitempty"`
+	// BoolColumns returns TINYINT(1) columns as true or false in every
+	// query on the connection, as the bool_columns query flag does
+	BoolColumns bool `json:"bool_columns,omitempty"`
+	// CACert verifies the server against a private CA, and ClientCert and
+	// ClientKey authenticate with a client certificate; each is PEM data
+	// or the path of a PEM file within BOBA_TLS_CERT_DIR. Setting any of
+	// them connects over TLS.
+	CACert     string `json:"ca_cert,omitempty"`
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+}
+
+// defaultConnectTimeout keeps an unreachable host from hanging a request
+// for the operating system's TCP timeout.
+const defaultConnectTimeout = 10 * time.Second
+
+var errConnectTimeout = errors.New("timed out connecting to the database")
+
+// charset returns the connection charset and collation: utf8mb4 unless
+// overridden, so text outside latin1 survives whatever the server default.
+func (c dbCredentials) charset() (string, string) {
+	if c.Charset == "" && c.Collation == "" {
+		return "utf8mb4", "utf8mb4_unicode_ci"
+	}
+	if c.Charset == "" {
+		return "utf8mb4", c.Collation
+	}
+	return c.Charset, c.Collation
+}
+
+// connectTimeout is how long connecting to c may take.
+func (c dbCredentials) connectTimeout() time.Duration {
+	if c.ConnectTimeout > 0 {
+		return time.Duration(c.ConnectTimeout) * time.Second
+	}
+	return defaultConnectTimeout
+}
+
+func (c dbCredentials) isZero() bool {
+	return c == dbCredentials{}
+}
+
+type loginRequest struct {
+	dbCredentials
+	// Connection names a server-side connection instead of inline credentials
+	Connection string `json:"connection"`
+	// ProfileID references a saved connection profile
+	ProfileID string `json:"profileId"`
+	// Sticky pins the session to one connection, which /execute-query
+	// calls with the same connection then share
+	Sticky bool `json:"sticky"`
+}
+
+// connectionRef identifies the database a request runs against: either
+// inline credentials or the name of a server-side connection.
+type connectionRef struct {
+	Credentials dbCredentials `json:"credentials"`
+	Connection  string        `json:"connection"`
+	ProfileID   string        `json:"profileId"`
+}
+
+type queryRequest struct {
+	connectionRef
+	Query string `json:"query"`
+	// Format selects the response body: "json" (the default), "csv",
+	// "xlsx", "arrow" for an Arrow IPC stream, or "markdown" or "ascii" for
+	// a plain text table. The .json, .csv, .xlsx and .arrow paths of
+	// /execute-query set it too.
+	Format string `json:"format"`
+	// SavedQueryID runs a saved query instead of Query
+	SavedQueryID string `json:"savedQueryId"`
+	// Lint adds lint warnings for the query to the response's warnings,
+	// which list the server's warnings whenever there are any
+	Lint bool `json:"lint"`
+	// ConfirmIfExpensive checks the EXPLAIN estimate first and, above
+	// cfg.ExpensiveQueryRows, asks for confirmation instead of running
+	ConfirmIfExpensive bool `json:"confirm_if_expensive"`
+	// Confirmed runs the query even if it is expensive
+	Confirmed bool `json:"confirmed"`
+	// Template is a query with ${name} placeholders, run instead of Query
+	// once they are replaced with the text of the variables of the same
+	// name. They are meant for identifiers and snippets; values go in
+	// {{name}} placeholders, which are bound as parameters.
+	Template string `json:"template"`
+	// Variables fill the query's {{name}} and the template's ${name}
+	// placeholders
+	Variables map[string]any `json:"variables"`
+	// PageSize returns the result a page at a time: the response holds the
+	// first PageSize rows and a next_cursor for the rest
+	PageSize int `json:"page_size"`
+	// Cursor continues a paged result instead of running a query
+	Cursor string `json:"cursor"`
+	// SessionVariables are set with SET SESSION, on a connection of the
+	// request's own, before the query runs
+	SessionVariables map[string]any `json:"sessionVariables"`
+	// SessionVars is another name for SessionVariables
+	SessionVars map[string]any `json:"session_vars"`
+	// UseDatabase switches the query's connection to another database on
+	// the same server with USE, so one pool serves them all
+	UseDatabase string `json:"use_database"`
+	// RawJSON returns JSON columns as strings instead of nested JSON
+	RawJSON bool `json:"rawJson"`
+	// BooleanTinyint returns TINYINT columns as true or false
+	BooleanTinyint bool `json:"booleanTinyint"`
+	// BoolColumns returns only the columns declared TINYINT(1), as BOOL
+	// and BOOLEAN columns are, as true or false
+	BoolColumns bool `json:"bool_columns"`
+	// SpatialFormat returns GEOMETRY columns as WKT, "wkt" or the default "",
+	// or as GeoJSON objects, "geojson"
+	SpatialFormat string `json:"spatial_format"`
+	// EnumValues adds the allowed members of the result's ENUM and SET
+	// columns to the response
+	EnumValues bool `json:"enumValues"`
+	// OutParams names the OUT parameters of a CALL, which passes each as
+	// @name; their values are returned in outParams
+	OutParams []string `json:"outParams"`
+	// CollectStats adds how much the query moved the session's Handler_%
+	// status counters, such as Handler_read_next, to the response
+	CollectStats bool `json:"collectStats"`
+	// TimeoutSeconds cancels the query after this many seconds; it cannot
+	// exceed cfg.MaxQueryTimeout
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// Cache serves the result of a read-only query from the result cache
+	// for its TTL, so polling the same query does not rerun it
+	Cache *cacheOptions `json:"cache"`
+	// BypassCache reruns a cached query and caches the fresh result
+	BypassCache bool `json:"bypassCache"`
+	// Retries retries the query when it fails with a deadlock or lock wait
+	// timeout, within its timeout
+	Retries *retryOptions `json:"retries"`
+	// Idempotent allows Retries for INSERT, UPDATE, DELETE and REPLACE,
+	// which the client knows are harmless to run again
+	Idempotent bool `json:"idempotent"`
+	// Queue, when not false, waits up to cfg.QueryQueueTimeout for a free
+	// slot when too many queries are running; false fails at once with 429
+	Queue *bool `json:"queue"`
+	// Snapshot stores the result as a snapshot, kept for snapshotDefaultTTL,
+	// and adds its link to the response
+	Snapshot bool `json:"snapshot"`
+
+	// variableDecls are the variables declared by the saved query run
+	variableDecls []templateVariable
+}
+
+// driverName is the database/sql driver used for every connection.
+const driverName = "mysql"
+
+func (s *Server) buildDSN(dbCredentials dbCredentials) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = dbCredentials.Username
+	cfg.Passwd = dbCredentials.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(dbCredentials.Host, dbCredentials.Port)
+	cfg.DBName = dbCredentials.Database
+	if dbCredentials.ConnectTimeout < 0 {
+		return "", errors.New("connect_timeout cannot be negative")
+	}
+	for _, name := range []string{dbCredentials.Charset, dbCredentials.Collation} {
+		if name != "" && !charsetNamePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid charset or collation: %s", name)
+		}
+	}
+	cfg.Timeout = dbCredentials.connectTimeout()
+	if err := cfg.Apply(mysql.Charset(dbCredentials.charset())); err != nil {
+		return "", err
+	}
+	if dbCredentials.ReadOnly {
+		cfg.Params = map[string]string{"transaction_read_only": "1"}
+	}
+	if dbCredentials.usesTLS() {
+		cfg.TLSConfig = dbCredentials.tlsConfigName()
+	}
+
+	if dbCredentials.Socket != "" {
+		if dbCredentials.SSH != nil {
+			return "", errors.New("socket connections cannot use an SSH tunnel")
+		}
+		info, err := os.Stat(dbCredentials.Socket)
+		if err != nil {
+			return "", fmt.Errorf("socket %s is not accessible: %w", dbCredentials.Socket, err)
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return "", fmt.Errorf("%s is not a Unix socket", dbCredentials.Socket)
+		}
+		cfg.Net = "unix"
+		cfg.Addr = dbCredentials.Socket
+	}
+
+	if dbCredentials.SSH != nil {
+		network, err := s.tunnels.register(*dbCredentials.SSH)
+		if err != nil {
+			return "", err
+		}
+		cfg.Net = network
+	}
+
+	return cfg.FormatDSN(), nil
+}
+
+// connectToDatabase returns the connection pool for dbCredentials, which is
+// shared with other requests and must not be closed.
+func (s *Server) connectToDatabase(dbCredentials dbCredentials) (*sql.DB, error) {
+	return s.connector.connect(dbCredentials)
+}
+
+// poolConnector connects through the shared pools, pinging each pool to
+// check the connection.
+type poolConnector struct {
+	srv *Server
+}
+
+func (p poolConnector) connect(dbCredentials dbCredentials) (*sql.DB, error) {
+	dsn, err := p.srv.buildDSN(dbCredentials)
+	if err != nil {
+		return nil, err
+	}
+	db, created, err := p.srv.dbPools.get(dsn, dbCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	timeout := dbCredentials.connectTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = p.srv.withRetry(ctx, func() error {
+		err := db.PingContext(ctx)
+		p.srv.throttleOnRefusal(db, err)
+		return err
+	})
+	if err != nil {
+		if created {
+			p.srv.dbPools.discard(dsn, db)
+		}
+		var netErr net.Error
+		if ctx.Err() != nil || errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("%w after %s", errConnectTimeout, timeout)
+		}
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// openConnection resolves ref and connects to it, writing the error
+// response and returning false on failure.
+func (s *Server) openConnection(c *gin.Context, ref connectionRef) (*sql.DB, dbCredentials, bool) {
+	creds, status, err := s.resolveCredentials(ref)
+	if err != nil {
+		respondStatusError(c, status, err)
+		return nil, dbCredentials{}, false
+	}
+
+	db, err := s.connectToDatabase(creds)
+	if err != nil {
+		respondConnectionError(c, err)
+		return nil, dbCredentials{}, false
+	}
+	return db, creds, true
+}
+
+// preparedQuery is a queryRequest ready to run.
+type preparedQuery struct {
+	query            string
+	args             []any
+	creds            dbCredentials
+	sessionVariables map[string]any
+	scan             scanOptions
+	timeout          time.Duration
+	// useDatabase is the database to USE before the query, if any
+	useDatabase string
+	// timeoutCapped is set when timeout is cfg.MaxQueryTimeout
+	timeoutCapped bool
+	retry         retryPolicy
+}
+
+// prepareQuery turns req into the statement to run: it loads the saved
+// query or substitutes the template, expands the placeholders, checks the
+// session variables, resolves the credentials and enforces read-only
+// connections. On failure it returns the status and error to report.
+func (s *Server) prepareQuery(req *queryRequest) (preparedQuery, int, *apiError) {
+	if req.Template != "" {
+		if req.Query != "" || req.SavedQueryID != "" {
+			return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: "A template cannot be combined with a query or saved query"}
+		}
+		query, rest, err := substituteTemplate(req.Template, req.Variables)
+		if err != nil {
+			return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: err.Error()}
+		}
+		req.Query, req.Variables = query, rest
+	}
+	if req.SavedQueryID != "" {
+		if status, err := s.applySavedQuery(req); err != nil {
+			return preparedQuery{}, status, &apiError{Code: codeForStatus(status), Message: sanitizeError(err)}
+		}
+	}
+
+	// Validate query is not empty
+	if req.Query == "" {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: "Query cannot be empty"}
+	}
+
+	query, args, err := expandTemplate(req.Query, req.Variables, req.variableDecls)
+	if err != nil {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: err.Error()}
+	}
+	if apiErr := s.checkQueryLength(query); apiErr != nil {
+		return preparedQuery{}, http.StatusBadRequest, apiErr
+	}
+	if !s.isQueryAllowed(query) {
+		return preparedQuery{}, http.StatusForbidden, &apiError{Code: codeQueryNotAllowed, Message: "The query is not allowed by the server's query policy"}
+	}
+	if len(req.SessionVars) > 0 {
+		if len(req.SessionVariables) > 0 {
+			return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: "provide either sessionVariables or session_vars, not both"}
+		}
+		req.SessionVariables = req.SessionVars
+	}
+	vars, err := validateSessionVariables(req.SessionVariables)
+	if err != nil {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: err.Error()}
+	}
+	if req.UseDatabase != "" && !databaseNamePattern.MatchString(req.UseDatabase) {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: "use_database must be a database name of letters, digits, _ and $"}
+	}
+	if err := validateOutParams(query, req.OutParams); err != nil {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: err.Error()}
+	}
+	timeout, capped, err := s.queryTimeout(req)
+	if err != nil {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: err.Error()}
+	}
+	if req.SpatialFormat != "" && req.SpatialFormat != spatialWKT && req.SpatialFormat != spatialGeoJSON {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: "spatial_format must be wkt or geojson"}
+	}
+	retry, err := s.retryPolicy(req, query)
+	if err != nil {
+		return preparedQuery{}, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: err.Error()}
+	}
+
+	creds, status, err := s.resolveCredentials(req.connectionRef)
+	if err != nil {
+		return preparedQuery{}, status, &apiError{Code: codeForStatus(status), Message: sanitizeError(err)}
+	}
+	if creds.ReadOnly && !isReadOnlyQuery(req.Query) {
+		return preparedQuery{}, http.StatusForbidden, &apiError{Code: codeReadOnly, Message: "Only read-only statements are allowed on this connection"}
+	}
+	scan := req.scanOptions()
+	scan.boolColumns = scan.boolColumns || creds.BoolColumns
+	return preparedQuery{
+		query:            query,
+		args:             args,
+		creds:            creds,
+		sessionVariables: vars,
+		useDatabase:      req.UseDatabase,
+		scan:             scan,
+		timeout:          timeout,
+		timeoutCapped:    capped,
+		retry:            retry,
+	}, 0, nil
+}
+
+// queryStats summarize how a query went, for display next to its result.
+type queryStats struct {
+	// DurationMs is the wall time of running the query and scanning the
+	// returned rows
+	DurationMs   int64 `json:"duration_ms"`
+	RowCount     int   `json:"row_count"`
+	ColumnsCount int   `json:"columns_count"`
+}
+
+func newQueryStats(start time.Time, rows, columns int) queryStats {
+	return queryStats{DurationMs: time.Since(start).Milliseconds(), RowCount: rows, ColumnsCount: columns}
+}
+
+// queryAttemptsHeader reports how many times a query with a retry policy
+// was run, on every response including errors and exports.
+const queryAttemptsHeader = "X-Boba-Query-Attempts"
+
+func reportAttempts(c *gin.Context, req queryRequest, attempts int) {
+	if req.Retries != nil {
+		c.Header(queryAttemptsHeader, strconv.Itoa(attempts))
+	}
+}
+
+// queue reports whether req waits for a query slot when too many queries
+// are running, which it does unless it sends queue: false.
+func (req *queryRequest) queue() bool {
+	return req.Queue == nil || *req.Queue
+}
+
+// scanOptions are the flags of req that change how values are decoded.
+func (req *queryRequest) scanOptions() scanOptions {
+	return scanOptions{rawJSON: req.RawJSON, booleanTinyint: req.BooleanTinyint, boolColumns: req.BoolColumns, geoJSON: req.SpatialFormat == spatialGeoJSON}
+}
+
+func (s *Server) setupRouter() *gin.Engine {
+	// Create a new Gin router
+	r := gin.New()
+	if s.tracingEnabled {
+		// First, so the request's span covers the other middleware
+		r.Use(otelgin.Middleware("boba"))
+	}
+	r.Use(requestIDMiddleware, gin.LoggerWithFormatter(accessLogLine))
+	if s.cfg.GzipEnabled {
+		r.Use(s.gzipMiddleware)
+	}
+	// Inside gzip, so the error a panic turns into is compressed and sent
+	// like any other response
+	r.Use(recoveryMiddleware, s.sessionMiddleware, s.bodyLimitMiddleware)
+
+	// Every route lives under the base path, "" unless BOBA_BASE_PATH is set
+	root := r.Group(s.cfg.BasePath)
+	root.GET("/", s.serveAsset("index.html"))
+	root.HEAD("/", s.serveAsset("index.html"))
+	root.GET("/openapi.json", s.serveOpenAPI(r))
+	root.GET("/docs", swaggerUI)
+	if s.cfg.EnablePprof {
+		s.registerDebug(root.Group("/debug"))
+	}
+
+	s.registerAPI(r.Group(s.cfg.BasePath + apiV1Path))
+	// The unversioned paths the API had before v1, deprecated
+	s.registerAPI(root.Group("", s.deprecatedPath))
+	return r
+}
+
+// registerAPI registers the JSON API's routes on api.
+func (s *Server) registerAPI(api *gin.RouterGroup) {
+	api.POST("/login", func(c *gin.Context) {
+		var req loginRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+		dbCredentials, status, err := s.resolveCredentials(connectionRef{
+			Credentials: req.dbCredentials,
+			Connection:  req.Connection,
+			ProfileID:   req.ProfileID,
+		})
+		if err != nil {
+			respondStatusError(c, status, err)
+			return
+		}
+		// A new login ends the previous sticky connection
+		s.stickySessions.close(sessionID(c))
+		if req.Sticky {
+			if err := s.stickySessions.open(c.Request.Context(), sessionID(c), dbCredentials); err != nil {
+				respondConnectionError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"message":              "Database connected successfully",
+				"sticky":               true,
+				"idle_timeout_seconds": int(s.cfg.StickyIdleTimeout.Seconds()),
+			})
+			return
+		}
+		if _, err := s.connectToDatabase(dbCredentials); err != nil {
+			respondConnectionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Database connected successfully"})
+	})
+
+	executeQuery := func(c *gin.Context) {
+		var req queryRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		if suffix := c.GetString(formatSuffixKey); suffix != "" {
+			if req.Format != "" && req.Format != suffix {
+				respondBadRequest(c, fmt.Sprintf("format %s conflicts with the .%s suffix of the path", req.Format, suffix))
+				return
+			}
+			req.Format = suffix
+		}
+		if req.Format != "" && req.Format != "json" && req.Format != "csv" && req.Format != "xlsx" && req.Format != "arrow" && !textTableFormats[req.Format] {
+			respondBadRequest(c, "Unsupported format: "+req.Format)
+			return
+		}
+		if req.PageSize < 0 {
+			respondBadRequest(c, "page_size cannot be negative")
+			return
+		}
+		if (req.PageSize > 0 || req.Cursor != "") && req.Format != "" && req.Format != "json" {
+			respondBadRequest(c, "Paged results are only available as json")
+			return
+		}
+		if req.Cursor != "" {
+			s.continueCursor(c, req)
+			return
+		}
+		if req.PageSize > 0 && len(req.OutParams) > 0 {
+			respondBadRequest(c, "outParams cannot be used with paged results")
+			return
+		}
+		if req.Cache != nil {
+			if req.Cache.TTLSeconds < 1 || time.Duration(req.Cache.TTLSeconds)*time.Second > resultCacheMaxTTL {
+				respondBadRequest(c, fmt.Sprintf("cache.ttlSeconds must be between 1 and %d", int(resultCacheMaxTTL.Seconds())))
+				return
+			}
+			if req.PageSize > 0 || req.Format != "" && req.Format != "json" {
+				respondBadRequest(c, "Only json results without paging can be cached")
+				return
+			}
+		}
+		if req.Snapshot && (req.PageSize > 0 || req.Format != "" && req.Format != "json") {
+			respondBadRequest(c, "Only json results without paging can be snapshotted")
+			return
+		}
+		c.Writer.Header().Add("Vary", "Accept")
+		version, ok := responseVersion(c)
+		if !ok {
+			return
+		}
+		if version != defaultResponseVersion && (req.PageSize > 0 || req.Format != "" && req.Format != "json") {
+			respondBadRequest(c, fmt.Sprintf("Response version %d is only available for json results without paging", version))
+			return
+		}
+
+		prepared, status, apiErr := s.prepareQuery(&req)
+		if apiErr != nil {
+			respondAPIError(c, status, *apiErr)
+			return
+		}
+		query, args, creds := prepared.query, prepared.args, prepared.creds
+
+		// Writes are never cached, and refresh the session's cached reads
+		cacheable := req.Cache != nil && s.cfg.ResultCacheBytes > 0 && isReadOnlyQuery(query)
+		var resultKey string
+		if cacheable {
+			resultKey = versionedKey(cacheKey(prepared), version)
+			if entry, ok := s.resultsCache.get(sessionID(c), resultKey); ok && !req.BypassCache {
+				c.Header("Content-Type", responseMediaType(version))
+				respondCached(c, entry)
+				return
+			}
+		}
+		if !isReadOnlyQuery(query) {
+			// Once the statement is done, so a result cached while it ran
+			// is refreshed too
+			defer s.resultsCache.noteWrite(sessionID(c), creds)
+		}
+		start := time.Now()
+		rowCount := 0
+		executed := true
+		defer func() {
+			if !executed {
+				return
+			}
+			s.recordQuery(c.Request.Context(), sessionID(c), creds, historyEntry{
+				Query:      req.Query,
+				Database:   prepared.useDatabase,
+				DurationMs: time.Since(start).Milliseconds(),
+				RowCount:   rowCount,
+				Status:     responseStatus(c),
+				ExecutedAt: start.UTC(),
+			})
+		}()
+
+		if s.coalescable(c, &req, query) {
+			// An identical SELECT already running answers this one too,
+			// and is recorded for it as well
+			key := versionedKey(cacheKey(prepared), version)
+			flight, leader := s.queryFlights.join(c.Request.Context(), key)
+			if !leader {
+				rowCount, executed = flight.follow(c)
+				return
+			}
+			publish := s.queryFlights.lead(c, key, flight)
+			defer func() { publish(rowCount) }()
+		}
+		releaseSlot, queueWait, err := s.queryLimits.acquire(c.Request.Context(), sessionID(c), req.queue())
+		if err != nil {
+			executed = false
+			s.respondQueryLimitError(c, err)
+			return
+		}
+		// A cursor takes ownership of the connection, and keeps the slot
+		// until it is closed
+		paged := false
+		defer func() {
+			if !paged {
+				releaseSlot()
+			}
+		}()
+
+		var (
+			db      *sql.DB
+			conn    *sql.Conn
+			q       queryer
+			release func()
+		)
+		if pinned := s.stickySessions.pin(sessionID(c), creds); pinned != nil {
+			if req.PageSize > 0 {
+				pinned.mu.Unlock()
+				respondBadRequest(c, "Paged results are not available on a sticky connection")
+				return
+			}
+			if req.Retries != nil {
+				// A deadlock rolls back the transaction the connection
+				// may hold, not just the statement
+				pinned.mu.Unlock()
+				respondBadRequest(c, "Retries are not available on a sticky connection")
+				return
+			}
+			if err := prepareConn(c.Request.Context(), pinned.conn, prepared.useDatabase, prepared.sessionVariables); err != nil {
+				pinned.mu.Unlock()
+				respondDBError(c, err)
+				return
+			}
+			db, q = pinned.db, pinned.conn
+			release = func() { s.stickySessions.unpin(sessionID(c), pinned) }
+		} else {
+			var err error
+			_, span := s.startDBSpan(c.Request.Context(), "db.connect", prepared)
+			db, err = s.connectToDatabase(creds)
+			span.end(-1, err)
+			if err != nil {
+				respondConnectionError(c, err)
+				return
+			}
+			if prepared.useDatabase == "" && len(prepared.sessionVariables) == 0 && !req.CollectStats && len(req.OutParams) == 0 {
+				// Nothing is set up on the connection before the statement,
+				// so a lost one can be swapped for a fresh one and the
+				// statement retried
+				pc := &poolConn{db: db, discard: !isReadOnlyQuery(query)}
+				q, release = pc, pc.close
+			} else {
+				// The handler counters and OUT parameters are read
+				// around the statement on its own connection
+				if q, conn, err = sessionQueryer(c.Request.Context(), db, query, prepared.useDatabase, prepared.sessionVariables); err != nil {
+					respondDBError(c, err)
+					return
+				}
+				if conn == nil {
+					if conn, err = db.Conn(c.Request.Context()); err != nil {
+						respondConnectionError(c, err)
+						return
+					}
+					q = conn
+					release = func() { conn.Close() }
+				} else {
+					release = func() { discardConn(conn) }
+				}
+			}
+		}
+		defer func() {
+			if !paged {
+				release()
+			}
+		}()
+
+		if req.ConfirmIfExpensive && !req.Confirmed {
+			estimate, ok, err := s.estimateRowsExamined(c.Request.Context(), q, query, args...)
+			if err != nil {
+				respondDBError(c, err)
+				return
+			}
+			if ok && estimate > int64(s.cfg.ExpensiveQueryRows) {
+				executed = false
+				c.JSON(http.StatusOK, gin.H{
+					"requires_confirmation": true,
+					"estimated_rows":        estimate,
+					"threshold":             s.cfg.ExpensiveQueryRows,
+				})
+				return
+			}
+		}
+
+		var warnings []lintWarning
+		if req.Lint {
+			warnings = s.lintQuery(c.Request.Context(), db, query)
+		}
+
+		if req.PageSize > 0 {
+			// The rows outlive this request, so they get their own context
+			ctx, cancel := prepared.withTimeout(context.Background())
+			queryStart := time.Now()
+			prepared.scan = resolveBoolColumns(ctx, q, query, prepared.scan)
+			rows, attempts, err := s.queryWithPolicy(ctx, q, prepared.retry, query, args...)
+			reportAttempts(c, req, attempts)
+			if err != nil {
+				cancel()
+				respondDBError(c, err)
+				return
+			}
+			columns, err := rows.Columns()
+			if err != nil {
+				rows.Close()
+				cancel()
+				respondDBError(c, err)
+				return
+			}
+			scanner := newRowScanner(columns)
+			scanner.useColumnTypes(rows, prepared.scan)
+			cur, err := s.queryCursors.open(sessionID(c), req.PageSize, func() { release(); releaseSlot() }, rows, scanner, cancel)
+			if err != nil {
+				rows.Close()
+				cancel()
+				respondCursorError(c, err)
+				return
+			}
+			paged = true
+			defer cur.mu.Unlock()
+			// The cursor's connection is busy with the rows
+			extra := gin.H{"editable": queryEditability(c.Request.Context(), db, query, creds, scanner.columns)}
+			if req.Lint {
+				extra["warnings"] = warnings
+			}
+			if req.Retries != nil {
+				extra["attempts"] = attempts
+			}
+			rowCount = s.respondPage(c, cur, req.PageSize, queryStart, extra)
+			return
+		}
+
+		ctx, cancel := prepared.withTimeout(c.Request.Context())
+		defer cancel()
+		defer s.trackRunningQuery(c, cancel)()
+		if err := resetOutParams(ctx, q, req.OutParams); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		var countersBefore map[string]int64
+		if req.CollectStats {
+			var err error
+			if countersBefore, err = handlerCounters(ctx, q); err != nil {
+				respondDBError(c, err)
+				return
+			}
+		}
+		prepared.scan = resolveBoolColumns(ctx, q, query, prepared.scan)
+		queryStart := time.Now()
+		_, span := s.startDBSpan(ctx, "db.query", prepared)
+		rows, attempts, err := s.queryWithPolicy(ctx, q, prepared.retry, query, args...)
+		span.end(-1, err)
+		reportAttempts(c, req, attempts)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		defer rows.Close()
+		_, scanSpan := s.startDBSpan(ctx, "db.scan", prepared)
+
+		columns, err := rows.Columns()
+		if err != nil {
+			scanSpan.end(0, err)
+			respondDBError(c, err)
+			return
+		}
+
+		if req.Format == "csv" {
+			count, err := writeCSV(c, rows, columns, prepared.scan)
+			rowCount = count
+			scanSpan.end(count, err)
+			if err != nil {
+				respondExportError(c, err)
+			}
+			return
+		}
+		if req.Format == "xlsx" {
+			count, err := s.writeXLSX(c, rows, columns)
+			rowCount = count
+			scanSpan.end(count, err)
+			if err != nil {
+				respondExportError(c, err)
+			}
+			return
+		}
+		if req.Format == "arrow" {
+			count, err := writeArrow(c, rows, columns)
+			rowCount = count
+			scanSpan.end(count, err)
+			if err != nil {
+				respondExportError(c, err)
+			}
+			return
+		}
+		if textTableFormats[req.Format] {
+			count, err := s.writeTextTable(c, req.Format, rows, columns, start)
+			rowCount = count
+			scanSpan.end(count, err)
+			if err != nil {
+				respondExportError(c, err)
+			}
+			return
+		}
+
+		scanner := newRowScanner(columns)
+		scanner.useColumnTypes(rows, prepared.scan)
+		var columnTypes []*sql.ColumnType
+		if version != defaultResponseVersion {
+			// Only open rows have column types
+			columnTypes, _ = rows.ColumnTypes()
+		}
+		var enums []string
+		if req.EnumValues {
+			enums = enumColumns(rows)
+		}
+		results := []map[string]any{}
+		for rows.Next() {
+			touchRunningQuery(c)
+			row, err := scanner.scan(rows)
+			if err != nil {
+				scanSpan.end(len(results), err)
+				respondDBError(c, err)
+				return
+			}
+			results = append(results, row)
+		}
+
+		err = rows.Err()
+		scanSpan.end(len(results), err)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		var resultSets []resultSet
+		if firstKeyword(query) == "CALL" {
+			// A procedure can return any number of result sets
+			more, err := scanResultSets(c, rows, prepared.scan)
+			if err != nil {
+				respondDBError(c, err)
+				return
+			}
+			resultSets = append([]resultSet{{Columns: scanner.columns, Results: results, Count: len(results)}}, more...)
+		}
+		elapsed := time.Since(queryStart)
+		stats := newQueryStats(queryStart, len(results), len(scanner.columns))
+		// The connection is free for the statements below once the rows are
+		rows.Close()
+
+		rowCount = len(results)
+		// An unpaged result is always read to its end, so it is complete; a
+		// query that fails or times out partway returns an error instead
+		response := gin.H{
+			"columns":              scanner.columns,
+			"results":              results,
+			"count":                len(results),
+			"complete":             true,
+			"stats":                stats,
+			"durationMs":           stats.DurationMs,
+			"rowsScannedPerSecond": rowsPerSecond(len(results), elapsed),
+			"queueWaitMs":          queueWait.Milliseconds(),
+		}
+		if version == 2 {
+			response = gin.H{
+				"api_version": version,
+				"columns":     describeColumnsV2(scanner.columns, columnTypes, prepared.scan),
+				"rows":        orderedRows(scanner.columns, results),
+				"count":       len(results),
+				"complete":    true,
+				"stats":       responseStatsV2{queryStats: stats, RowsScannedPerSecond: rowsPerSecond(len(results), elapsed), QueueWaitMs: queueWait.Milliseconds()},
+			}
+		}
+		if req.Retries != nil {
+			response["attempts"] = attempts
+		}
+		// Read before anything else runs, as most statements clear them
+		if serverWarns, err := serverWarnings(ctx, q); err == nil {
+			warnings = append(warnings, serverWarns...)
+		}
+		if req.Lint || len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		if resultSets != nil {
+			response["resultSets"] = resultSets
+		}
+		if len(req.OutParams) > 0 {
+			params, err := readOutParams(ctx, q, req.OutParams)
+			if err != nil {
+				respondDBError(c, err)
+				return
+			}
+			response["outParams"] = params
+		}
+		if req.EnumValues {
+			response["enumValues"] = enumMembers(ctx, q, query, enums)
+		}
+		response["editable"] = queryEditability(ctx, q, query, creds, scanner.columns)
+		if req.CollectStats {
+			countersAfter, err := handlerCounters(ctx, q)
+			if err != nil {
+				respondDBError(c, err)
+				return
+			}
+			response["handlerStats"] = diffCounters(countersBefore, countersAfter)
+		}
+		if req.Snapshot {
+			// A failed snapshot leaves the result to be returned as usual
+			shared := req.Query
+			if shared == "" {
+				shared = query
+			}
+			snap, err := s.saveSnapshot(snapshotContent{
+				Query:    shared,
+				Columns:  scanner.columns,
+				Results:  results,
+				Metadata: map[string]any{"database": creds.Database, "executed_at": queryStart.UTC(), "durationMs": stats.DurationMs},
+			}, snapshotDefaultTTL, "")
+			if err != nil {
+				response["snapshot"] = nil
+				warnings = append(warnings, lintWarning{Code: "snapshot_failed", Message: "The result could not be snapshotted: " + sanitizeError(err)})
+				response["warnings"] = warnings
+			} else {
+				response["snapshot"] = s.snapshotInfo(snap)
+			}
+		}
+		if cacheable {
+			response["cached"] = false
+			s.resultsCache.put(resultKey, creds, response, queryStart, time.Duration(req.Cache.TTLSeconds)*time.Second)
+		}
+		c.Header("Content-Type", responseMediaType(version))
+		c.JSON(http.StatusOK, response)
+	}
+	api.POST("/execute-query", executeQuery)
+	for _, suffix := range formatSuffixes {
+		api.POST("/execute-query."+suffix, withFormatSuffix(suffix), executeQuery)
+	}
+	api.POST("/execute-query/events", s.executeQueryEvents)
+	api.POST("/execute-query/stream", s.createStreamToken)
+	api.GET("/execute-query/stream", s.streamQuery)
+	api.POST("/execute-batch", s.executeBatch)
+	api.POST("/preview", s.previewTable)
+	api.POST("/count", s.countRows)
+	api.GET("/charsets", s.listCharsets)
+	api.POST("/foreign-keys", s.listForeignKeys)
+	api.POST("/diff", s.diffQuery)
+	api.POST("/compare", s.compareQueries)
+	api.POST("/schema/diff", s.diffSchemas)
+	api.POST("/ddl", s.tableDDL)
+	api.POST("/describe-query", s.describeQuery)
+	api.POST("/databases/create", s.createDatabase)
+	api.POST("/databases/drop", s.dropDatabase)
+	api.POST("/tables/maintenance", s.tableMaintenance)
+	// The path the endpoint was first added at
+	api.POST("/maintenance", s.deprecatedAlias("/tables/maintenance"), s.tableMaintenance)
+	api.POST("/tables/insert", s.insertRows)
+	api.POST("/tables/update-row", s.updateRow)
+	api.POST("/tables/delete-row", s.deleteRow)
+	api.POST("/keep-alive", s.keepAlive)
+	api.DELETE("/cursors/:id", s.closeCursor)
+
+	api.GET("/connections", s.listConnections)
+	api.GET("/drivers", listDrivers)
+
+	api.POST("/server-info", s.serverInfo)
+	api.POST("/server/processlist", s.processList)
+	api.POST("/server/kill", s.killProcess)
+	api.POST("/server/status", s.serverStatus)
+	api.POST("/server/variables", s.serverVariables)
+	api.POST("/server/users", s.listUsers)
+	api.POST("/server/grants", s.showGrants)
+	api.POST("/privileges", s.currentPrivileges)
+	// The original paths, kept for existing clients
+	api.POST("/processlist", s.processList)
+	api.POST("/kill", s.killProcess)
+
+	api.POST("/format", formatSQLHandler)
+	api.POST("/lint", s.lintHandler)
+
+	api.POST("/profiles", s.createProfile)
+	api.GET("/profiles", s.listProfiles)
+	api.GET("/profiles/:id", s.getProfile)
+	api.PUT("/profiles/:id", s.updateProfile)
+	api.DELETE("/profiles/:id", s.deleteProfile)
+
+	// Bookmarks are the saved queries under another name: tagged, and
+	// referencing a connection rather than holding credentials
+	for _, prefix := range []string{"/saved-queries", "/bookmarks"} {
+		api.POST(prefix, s.createSavedQuery)
+		api.GET(prefix, s.listSavedQueries)
+		api.GET(prefix+"/export", s.exportSavedQueries)
+		api.POST(prefix+"/import", s.importSavedQueries)
+		api.GET(prefix+"/:id", s.getSavedQuery)
+		api.PUT(prefix+"/:id", s.updateSavedQuery)
+		api.DELETE(prefix+"/:id", s.deleteSavedQuery)
+	}
+
+	api.POST("/schedules", s.createSchedule)
+	api.GET("/schedules", s.listSchedules)
+	api.GET("/schedules/:id", s.getSchedule)
+	api.PUT("/schedules/:id", s.updateSchedule)
+	api.DELETE("/schedules/:id", s.deleteSchedule)
+	api.GET("/schedules/:id/runs", s.listScheduleRuns)
+	api.GET("/schedules/:id/runs/:run", s.getScheduleRun)
+
+	api.POST("/snapshots", s.createSnapshot)
+	api.GET("/snapshots/:id", s.getSnapshot)
+
+	api.POST("/import/csv", s.importCSVHandler)
+	api.POST("/import/sql", s.importSQLHandler)
+	api.POST("/export/sql", s.exportSQL)
+
+	api.POST("/queries/async", s.startAsyncQuery)
+	api.GET("/queries/async/:id", s.getAsyncQuery)
+	api.DELETE("/queries/async/:id", s.cancelAsyncQuery)
+
+	api.GET("/webhooks/deliveries", s.listWebhookDeliveries)
+
+	api.GET("/history", s.listHistory)
+	api.DELETE("/history", s.clearHistory)
+	api.DELETE("/history/:id", s.deleteHistoryEntry)
+
+	api.GET("/audit", s.listAudit)
+
+	api.GET("/ws", s.handleWebSocket)
+	api.GET("/ws/query", s.handleQueryWebSocket)
+
+}
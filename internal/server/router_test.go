@@ -0,0 +1,263 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+// credentialsJSON are the credentials the handler tests send, which
+// withMockDB answers whatever they are.
+const credentialsJSON = `"credentials":{"username":"app","password":"secret","host":"db","port":"3306"}`
+
+// postJSON serves a POST of body to path on s.
+func postJSON(t *testing.T, s *Server, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestBuildDSNCharset(t *testing.T) {
+	s := newTestServer()
+	tests := []struct {
+		name               string
+		charset, collation string
+		want               []string
+	}{
+		{"default", "", "", []string{"charset=utf8mb4", "collation=utf8mb4_unicode_ci"}},
+		{"collation only", "", "utf8mb4_0900_ai_ci", []string{"charset=utf8mb4", "collation=utf8mb4_0900_ai_ci"}},
+		{"charset only", "latin1", "", []string{"charset=latin1"}},
+		{"both", "utf8mb4", "utf8mb4_bin", []string{"charset=utf8mb4", "collation=utf8mb4_bin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := s.buildDSN(dbCredentials{Username: "app", Host: "db", Port: "3306", Charset: tt.charset, Collation: tt.collation})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, param := range tt.want {
+				if !strings.Contains(dsn, param) {
+					t.Errorf("%s: no %s", dsn, param)
+				}
+			}
+		})
+	}
+
+	for _, bad := range []string{"utf8mb4&allowAllFiles=true", "latin1 ", "x'"} {
+		if _, err := s.buildDSN(dbCredentials{Username: "app", Host: "db", Port: "3306", Charset: bad}); err == nil {
+			t.Errorf("charset %q accepted", bad)
+		}
+	}
+}
+
+// credsConnector is mockConnector keeping the credentials of the last
+// connection.
+type credsConnector struct {
+	mockConnector
+	last *dbCredentials
+}
+
+func (c credsConnector) connect(creds dbCredentials) (*sql.DB, error) {
+	*c.last = creds
+	return c.mockConnector.connect(creds)
+}
+
+// sqlmock stands in for the server without encoding anything, so what
+// keeps 4-byte text whole on a real one is the utf8mb4 charset the
+// connection's DSN asks for; the text itself must come back through the
+// JSON response unmangled.
+func TestExecuteQueryTextOnUTF8MB4(t *testing.T) {
+	// An emoji, accents, CJK and U+1F600, which needs 4 bytes in UTF-8
+	const text = "🍵 café 日本語 \U0001F600"
+	s := newTestServer()
+	mock := withMockDB(t, s)
+	var creds dbCredentials
+	s.connector = credsConnector{s.connector.(mockConnector), &creds}
+	mock.ExpectQuery("SELECT note FROM notes").
+		WillReturnRows(sqlmock.NewRows([]string{"note"}).AddRow([]byte(text)))
+
+	w := postJSON(t, s, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"SELECT note FROM notes"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	dsn, err := s.buildDSN(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range []string{"charset=utf8mb4", "collation=utf8mb4_unicode_ci"} {
+		if !strings.Contains(dsn, param) {
+			t.Errorf("the query's connection %s has no %s", dsn, param)
+		}
+	}
+	var resp struct {
+		Results []map[string]string `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0]["note"] != text {
+		t.Errorf("results = %q, want %q", resp.Results, text)
+	}
+}
+
+func TestExecuteQueryEmptyResultShape(t *testing.T) {
+	tests := []struct {
+		name, query string
+		rows        func(sqlmock.Sqlmock) *sqlmock.Rows
+		columns     string
+	}{
+		{"no rows", "SELECT a, b FROM t WHERE 0", func(mock sqlmock.Sqlmock) *sqlmock.Rows {
+			return mock.NewRows([]string{"a", "b"})
+		}, `["a","b"]`},
+		{"no columns", "DO SLEEP(0)", func(mock sqlmock.Sqlmock) *sqlmock.Rows {
+			return mock.NewRows(nil)
+		}, `[]`},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{"/api/v1/execute-query", "/execute-query"} {
+			t.Run(tt.name+" "+path, func(t *testing.T) {
+				s := newTestServer()
+				mock := withMockDB(t, s)
+				mock.ExpectQuery(tt.query).WillReturnRows(tt.rows(mock))
+				w := postJSON(t, s, path, `{`+credentialsJSON+`,"query":"`+tt.query+`"}`)
+				if w.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+				var resp map[string]json.RawMessage
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				for field, want := range map[string]string{
+					"columns":  tt.columns,
+					"results":  `[]`,
+					"count":    `0`,
+					"complete": `true`,
+				} {
+					if got := string(resp[field]); got != want {
+						t.Errorf("%s = %s, want %s in %s", field, got, want, w.Body)
+					}
+				}
+			})
+		}
+	}
+}
+
+// decodeError returns the code of the error response in w.
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct{ Error apiError }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v", w.Body, err)
+	}
+	return resp.Error.Code
+}
+
+func TestLogin(t *testing.T) {
+	denied := &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'app'@'10.0.0.1'"}
+	tests := []struct {
+		name      string
+		body      string
+		connector connector
+		status    int
+		code      string
+	}{
+		{"bad JSON", `{"username":`, nil, http.StatusBadRequest, codeBadRequest},
+		{"unknown field", `{"username":"app","passwd":"x"}`, nil, http.StatusBadRequest, codeBadRequest},
+		{"access denied", `{"username":"app","host":"db","port":"3306"}`, failingConnector{denied}, http.StatusForbidden, codeAccessDenied},
+		{"unreachable", `{"username":"app","host":"db","port":"3306"}`, failingConnector{errors.New("dial tcp: connection refused")}, http.StatusBadGateway, codeConnectionFailed},
+		{"connected", `{"username":"app","host":"db","port":"3306"}`, nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			withMockDB(t, s)
+			if tt.connector != nil {
+				s.connector = tt.connector
+			}
+			w := postJSON(t, s, "/api/v1/login", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code != "" {
+				if code := decodeError(t, w); code != tt.code {
+					t.Errorf("code %q, want %q", code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteQueryErrors(t *testing.T) {
+	const query = "SELECT * FROM missing"
+	body := `{` + credentialsJSON + `,"query":"` + query + `"}`
+	tests := []struct {
+		name   string
+		body   string
+		setup  func(*Server, sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{"bad JSON", `{"query":`, nil, http.StatusBadRequest, codeBadRequest},
+		{"empty query", `{` + credentialsJSON + `,"query":""}`, nil, http.StatusBadRequest, codeBadRequest},
+		{"connection failure", body, func(s *Server, _ sqlmock.Sqlmock) {
+			s.connector = failingConnector{errors.New("dial tcp: connection refused")}
+		}, http.StatusBadGateway, codeConnectionFailed},
+		{"unknown table", body, func(_ *Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: 1146, Message: "Table 'shop.missing' doesn't exist"})
+		}, http.StatusNotFound, codeUnknownTable},
+		{"other query error", body, func(_ *Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: 1105, Message: "Unknown error"})
+		}, http.StatusInternalServerError, codeQueryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			mock := withMockDB(t, s)
+			if tt.setup != nil {
+				tt.setup(s, mock)
+			}
+			w := postJSON(t, s, "/api/v1/execute-query", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if code := decodeError(t, w); code != tt.code {
+				t.Errorf("code %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestExecuteQueryValueTypes(t *testing.T) {
+	const query = "SELECT * FROM t"
+	s := newTestServer()
+	mock := withMockDB(t, s)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"i", "f", "s", "b", "ok", "at", "n"}).
+		AddRow(int64(-7), 1.5, "text", []byte("blob"), true, created, nil))
+
+	w := postJSON(t, s, "/api/v1/execute-query", `{`+credentialsJSON+`,"query":"`+query+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Results []json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"at":"2024-01-02T03:04:05.0000006Z","b":"blob","f":1.5,"i":-7,"n":null,"ok":true,"s":"text"}`
+	if len(resp.Results) != 1 || string(resp.Results[0]) != want {
+		t.Errorf("results in %s, want [%s]", w.Body, want)
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const codeRowConflict = "row_conflict"
+
+type rowEditRequest struct {
+	connectionRef
+	Table string `json:"table"`
+	// Key identifies the row by every column of the table's primary key
+	Key map[string]any `json:"key"`
+	// Values are the columns update-row changes
+	Values map[string]any `json:"values"`
+}
+
+// updateRow changes the columns of one row, found by its primary key.
+func (s *Server) updateRow(c *gin.Context) {
+	s.editRow(c, true)
+}
+
+// deleteRow deletes one row, found by its primary key.
+func (s *Server) deleteRow(c *gin.Context) {
+	s.editRow(c, false)
+}
+
+// editRow updates or deletes the row req.Key identifies. The row is locked
+// and counted first, and anything but exactly one row is rolled back as a
+// conflict, so an edit made from a stale view never touches another row.
+func (s *Server) editRow(c *gin.Context, update bool) {
+	var req rowEditRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	table, ok := parseTableName(req.Table)
+	if !ok {
+		respondBadRequest(c, "A table name such as orders or shop.orders is required")
+		return
+	}
+	if len(req.Key) == 0 {
+		respondBadRequest(c, "A key with the row's primary key columns is required")
+		return
+	}
+	if update && len(req.Values) == 0 {
+		respondBadRequest(c, "At least one value to change is required")
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+	if creds.ReadOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Rows cannot be changed on a read-only connection")
+		return
+	}
+
+	ctx := c.Request.Context()
+	known, err := tableColumns(ctx, db, table)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if len(known) == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "Table not found: "+table.String())
+		return
+	}
+
+	var where []string
+	var whereArgs []any
+	for _, col := range known {
+		if !col.primary {
+			continue
+		}
+		val, ok := lookupFold(req.Key, col.name)
+		if !ok {
+			respondBadRequest(c, "The key is missing primary key column "+col.name)
+			return
+		}
+		if val == nil {
+			respondBadRequest(c, fmt.Sprintf("Key column %s cannot be null", col.name))
+			return
+		}
+		if val, err = coerceColumnValue(col.dataType, val); err != nil {
+			respondBadRequest(c, fmt.Sprintf("Key column %s: %s", col.name, err))
+			return
+		}
+		where = append(where, quoteIdent(col.name)+" = ?")
+		whereArgs = append(whereArgs, val)
+	}
+	if len(where) == 0 {
+		respondBadRequest(c, "Table "+table.String()+" has no primary key, so its rows cannot be edited")
+		return
+	}
+	for name := range req.Key {
+		if col, ok := findColumn(known, name); !ok || !col.primary {
+			respondBadRequest(c, "Not a primary key column: "+name)
+			return
+		}
+	}
+
+	var stmt string
+	var args []any
+	if update {
+		var sets []string
+		for name := range req.Values {
+			if _, ok := findColumn(known, name); !ok {
+				respondBadRequest(c, "Unknown column "+name)
+				return
+			}
+		}
+		// In table order, so the same edit always builds the same statement
+		for _, col := range known {
+			val, ok := lookupFold(req.Values, col.name)
+			if !ok {
+				continue
+			}
+			if val, err = coerceColumnValue(col.dataType, val); err != nil {
+				respondBadRequest(c, fmt.Sprintf("Column %s: %s", col.name, err))
+				return
+			}
+			sets = append(sets, quoteIdent(col.name)+" = ?")
+			args = append(args, val)
+		}
+		stmt = "UPDATE " + table.quoted() + " SET " + strings.Join(sets, ", ")
+	} else {
+		stmt = "DELETE FROM " + table.quoted()
+	}
+	stmt += " WHERE " + strings.Join(where, " AND ")
+	args = append(args, whereArgs...)
+	if !s.isQueryAllowed(stmt) {
+		respondError(c, http.StatusForbidden, codeQueryNotAllowed, "The query is not allowed by the server's query policy")
+		return
+	}
+
+	start := time.Now()
+	var affected int64
+	defer func() { s.recordHandlerQuery(c, creds, stmt, start, int(affected)) }()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var matched int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table.quoted()+" WHERE "+strings.Join(where, " AND ")+" FOR UPDATE", whereArgs...).Scan(&matched)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if matched != 1 {
+		respondRowConflict(c, int64(matched))
+		return
+	}
+	res, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if affected, err = res.RowsAffected(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	// An UPDATE that leaves every value as it was affects no rows
+	if affected > 1 || !update && affected != 1 {
+		respondRowConflict(c, affected)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	s.resultsCache.noteWrite(sessionID(c), creds)
+	c.JSON(http.StatusOK, gin.H{"table": table.String(), "affected": affected})
+}
+
+// respondRowConflict reports an edit that would not have changed exactly
+// one row; the transaction is rolled back.
+func respondRowConflict(c *gin.Context, rows int64) {
+	message := "The row was not found; it may have been changed or deleted"
+	if rows > 1 {
+		message = fmt.Sprintf("The key matches %d rows rather than one", rows)
+	}
+	respondError(c, http.StatusConflict, codeRowConflict, message)
+}
+
+// findColumn returns the column of columns named name, ignoring case.
+func findColumn(columns []tableColumn, name string) (tableColumn, bool) {
+	for _, col := range columns {
+		if strings.EqualFold(col.name, name) {
+			return col, true
+		}
+	}
+	return tableColumn{}, false
+}
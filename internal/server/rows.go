@@ -0,0 +1,246 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// rowScanner scans result rows into JSON-friendly maps keyed by column name.
+// The scan buffers are reused between rows.
+type rowScanner struct {
+	columns   []string
+	values    []any
+	valuePtrs []any
+	// kinds are the column kinds scan decodes specially; see useColumnTypes
+	kinds []columnKind
+	// geoJSON is scanOptions.geoJSON
+	geoJSON bool
+}
+
+// columnKind is how scan decodes the values of a column.
+type columnKind int
+
+const (
+	kindDefault columnKind = iota
+	kindJSON
+	kindBit
+	kindBool
+	kindUnsigned
+	kindGeometry
+)
+
+// scanOptions are the request flags that change how values are decoded.
+type scanOptions struct {
+	// rawJSON leaves JSON columns as strings
+	rawJSON bool
+	// booleanTinyint returns TINYINT columns as booleans
+	booleanTinyint bool
+	// boolColumns returns the TINYINT(1) columns named in tinyintOne as
+	// booleans, once resolveBoolColumns has looked them up
+	boolColumns bool
+	tinyintOne  []string
+	// geoJSON returns GEOMETRY columns as GeoJSON rather than WKT
+	geoJSON bool
+}
+
+func newRowScanner(columns []string) *rowScanner {
+	if columns == nil {
+		// Encoded in responses, where it must be [] rather than null
+		columns = []string{}
+	}
+	values := make([]any, len(columns))
+	valuePtrs := make([]any, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	return &rowScanner{columns: columns, values: values, valuePtrs: valuePtrs}
+}
+
+// useColumnTypes makes scan decode values by the column types of rows: JSON
+// as nested objects and arrays rather than strings, BIT as an integer
+// rather than raw bytes, GEOMETRY as WKT or GeoJSON, UNSIGNED BIGINT always
+// as a number and, with booleanTinyint, TINYINT as a boolean.
+// The driver does not report display widths, so booleanTinyint cannot
+// tell TINYINT(1) from other TINYINT columns and converts them all;
+// boolColumns relies on the widths resolveBoolColumns looked up instead.
+// Without column types the values decode as usual.
+func (s *rowScanner) useColumnTypes(rows *sql.Rows, opts scanOptions) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return
+	}
+	s.kinds = make([]columnKind, len(columnTypes))
+	s.geoJSON = opts.geoJSON
+	for i, ct := range columnTypes {
+		switch ct.DatabaseTypeName() {
+		case "JSON":
+			if !opts.rawJSON {
+				s.kinds[i] = kindJSON
+			}
+		case "BIT":
+			s.kinds[i] = kindBit
+		case "GEOMETRY":
+			s.kinds[i] = kindGeometry
+		case "UNSIGNED BIGINT":
+			s.kinds[i] = kindUnsigned
+		case "TINYINT":
+			if _, ok := findFold(opts.tinyintOne, ct.Name()); opts.booleanTinyint || ok {
+				s.kinds[i] = kindBool
+			}
+		}
+	}
+}
+
+// scan reads the current row of rows.
+func (s *rowScanner) scan(rows *sql.Rows) (map[string]any, error) {
+	if err := rows.Scan(s.valuePtrs...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]any, len(s.columns))
+	for i, col := range s.columns {
+		kind := kindDefault
+		if i < len(s.kinds) {
+			kind = s.kinds[i]
+		}
+		switch val := s.values[i]; {
+		case isNull(val):
+			row[col] = nil
+		case kind == kindJSON:
+			row[col] = jsonValue(col, val)
+		case kind == kindBit:
+			row[col] = bitValue(val)
+		case kind == kindBool:
+			row[col] = boolValue(val)
+		case kind == kindUnsigned:
+			row[col] = unsignedValue(val)
+		case kind == kindGeometry:
+			row[col] = geometryValue(val, s.geoJSON)
+		default:
+			row[col] = convertValue(val)
+		}
+	}
+	return row, nil
+}
+
+// jsonValue returns the value of a JSON column as raw JSON, or as a string
+// if the server sent something that does not parse.
+func jsonValue(col string, val any) any {
+	raw, ok := val.([]byte)
+	if !ok {
+		return convertValue(val)
+	}
+	if !json.Valid(raw) {
+		log.Printf("Column %s holds invalid JSON; returning it as a string", col)
+		return string(raw)
+	}
+	// The driver reuses raw for the next row
+	return json.RawMessage(append([]byte(nil), raw...))
+}
+
+// bitValue returns a BIT value, which the driver returns as big-endian
+// bytes, as an unsigned integer.
+func bitValue(val any) any {
+	raw, ok := val.([]byte)
+	if !ok || len(raw) > 8 {
+		return convertValue(val)
+	}
+	var n uint64
+	for _, b := range raw {
+		n = n<<8 | uint64(b)
+	}
+	return convertValue(n)
+}
+
+// unsignedValue returns an UNSIGNED BIGINT value as a number. The driver
+// returns values above math.MaxInt64 as text when the query has arguments.
+func unsignedValue(val any) any {
+	if raw, ok := val.([]byte); ok {
+		if n, err := strconv.ParseUint(string(raw), 10, 64); err == nil {
+			return convertValue(n)
+		}
+	}
+	return convertValue(val)
+}
+
+// boolValue returns a TINYINT value as a boolean: false for 0, true for
+// anything else.
+func boolValue(val any) any {
+	switch v := val.(type) {
+	case int64:
+		return v != 0
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err == nil {
+			return n != 0
+		}
+	}
+	return convertValue(val)
+}
+
+// convertValue turns a scanned driver value into something that encodes
+// cleanly as JSON. SQL NULL is always nil, whatever the column type, so it
+// encodes as null and never as "" or "<nil>".
+func convertValue(val any) any {
+	if isNull(val) {
+		return nil
+	}
+
+	// Handle different data types properly
+	switch v := val.(type) {
+	case []byte:
+		// Handle BLOB/TEXT fields
+		return string(v)
+	case int64:
+		return v
+	case uint64:
+		// As a number literal, since a float64 cannot hold every uint64
+		return json.Number(strconv.FormatUint(v, 10))
+	case int32:
+		return v
+	case int:
+		return v
+	case float64:
+		return v
+	case float32:
+		return v
+	case bool:
+		return v
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case driver.Valuer:
+		// sql.Null* and similar wrappers hold a NULL or a plain value
+		inner, err := v.Value()
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return convertValue(inner)
+	default:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+			return convertValue(rv.Elem().Interface())
+		}
+		// For any other type, convert to string safely
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// isNull reports whether val is a SQL NULL: nil itself, a nil []byte (an
+// empty BLOB is a non-nil empty slice) or a nil pointer.
+func isNull(val any) bool {
+	if val == nil {
+		return true
+	}
+	if b, ok := val.([]byte); ok {
+		return b == nil
+	}
+	rv := reflect.ValueOf(val)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// scanMockRows scans the rows result makes, as returned by the driver for
+// a query, the way /execute-query does.
+func scanMockRows(t *testing.T, result func(sqlmock.Sqlmock) *sqlmock.Rows, opts scanOptions) []map[string]any {
+	t.Helper()
+	s := newTestServer()
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("SELECT * FROM t").WillReturnRows(result(mock))
+	db, _ := s.connector.connect(dbCredentials{})
+	rows, err := db.Query("SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, opts)
+	var scanned []map[string]any
+	for rows.Next() {
+		row, err := scanner.scan(rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanned = append(scanned, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return scanned
+}
+
+// encodeRow is row as JSON, the way clients see it.
+func encodeRow(t *testing.T, row map[string]any) string {
+	t.Helper()
+	b, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestScanNullIsAlwaysNull(t *testing.T) {
+	column := func(name, dbType string, sample any) *sqlmock.Column {
+		return sqlmock.NewColumn(name).OfType(dbType, sample).Nullable(true)
+	}
+	result := func(mock sqlmock.Sqlmock) *sqlmock.Rows {
+		return mock.NewRowsWithColumnDefinition(
+			column("n", "INT", int64(0)),
+			column("d", "DECIMAL", []byte(nil)),
+			column("f", "DOUBLE", float64(0)),
+			column("s", "VARCHAR", []byte(nil)),
+			column("day", "DATE", time.Time{}),
+			column("b", "BLOB", []byte(nil)),
+			column("j", "JSON", []byte(nil)),
+			column("bit", "BIT", []byte(nil)),
+			column("u", "UNSIGNED BIGINT", uint64(0)),
+		).
+			AddRow(nil, nil, nil, nil, nil, nil, nil, nil, nil).
+			AddRow(int64(0), []byte("0.00"), 0.0, []byte{}, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), []byte{}, []byte("null"), []byte{0}, uint64(0))
+	}
+	rows := scanMockRows(t, result, scanOptions{})
+
+	want := []string{
+		`{"b":null,"bit":null,"d":null,"day":null,"f":null,"j":null,"n":null,"s":null,"u":null}`,
+		`{"b":"","bit":0,"d":"0.00","day":"2024-02-29T00:00:00Z","f":0,"j":null,"n":0,"s":"","u":0}`,
+	}
+	for i, row := range rows {
+		if got := encodeRow(t, row); got != want[i] {
+			t.Errorf("row %d = %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestConvertValueTypedNulls(t *testing.T) {
+	var nilTime *time.Time
+	for _, val := range []any{
+		nil,
+		[]byte(nil),
+		nilTime,
+		sql.NullString{},
+		sql.NullInt64{},
+		sql.NullFloat64{},
+		sql.NullTime{},
+		sql.Null[[]byte]{},
+	} {
+		if got := convertValue(val); got != nil {
+			t.Errorf("convertValue(%#v) = %#v, want nil", val, got)
+		}
+	}
+	if got := convertValue([]byte{}); got != "" {
+		t.Errorf("empty bytes = %#v, want \"\"", got)
+	}
+	if got := convertValue(sql.NullString{String: "", Valid: true}); got != "" {
+		t.Errorf("valid empty NullString = %#v, want \"\"", got)
+	}
+}
+
+// wideTextRows is a result of rows rows of 20 text columns, repetitive the
+// way names, statuses and descriptions are.
+func wideTextRows(rows int) *sqlmock.Rows {
+	columns := make([]string, 20)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("col_%02d", i)
+	}
+	result := sqlmock.NewRows(columns)
+	values := make([]driver.Value, len(columns))
+	for r := range rows {
+		for i := range values {
+			values[i] = fmt.Sprintf("customer %d ordered item %d; status shipped, awaiting confirmation", r%50, i)
+		}
+		result.AddRow(values...)
+	}
+	return result
+}
+
+func BenchmarkRowScannerScan(b *testing.B) {
+	s := newTestServer()
+	mock := withMockDB(b, s)
+	db, err := s.connector.connect(dbCredentials{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for range b.N {
+		mock.ExpectQuery("SELECT * FROM orders").WillReturnRows(wideTextRows(1000))
+		rows, err := db.Query("SELECT * FROM orders")
+		if err != nil {
+			b.Fatal(err)
+		}
+		columns, _ := rows.Columns()
+		scanner := newRowScanner(columns)
+		scanner.useColumnTypes(rows, scanOptions{})
+		for rows.Next() {
+			if _, err := scanner.scan(rows); err != nil {
+				b.Fatal(err)
+			}
+		}
+		rows.Close()
+	}
+}
+
+// BenchmarkExecuteQueryGzip runs a wide text-heavy result through
+// /execute-query with and without gzip, reporting the bytes sent.
+func BenchmarkExecuteQueryGzip(b *testing.B) {
+	body := `{"credentials":{"username":"app","host":"db","port":"3306"},"query":"SELECT * FROM orders"}`
+	for _, encoding := range []string{"identity", "gzip"} {
+		b.Run(encoding, func(b *testing.B) {
+			s := newTestServer(func(c *config) { c.GzipEnabled = true })
+			mock := withMockDB(b, s)
+			r := s.Handler()
+			var sent int
+			for range b.N {
+				mock.ExpectQuery("SELECT * FROM orders").WillReturnRows(wideTextRows(1000))
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/execute-query", strings.NewReader(body))
+				req.Header.Set("Accept-Encoding", encoding)
+				r.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+				sent = w.Body.Len()
+				if (encoding == "gzip") != (w.Header().Get("Content-Encoding") == "gzip") {
+					b.Fatalf("Content-Encoding %q", w.Header().Get("Content-Encoding"))
+				}
+			}
+			b.ReportMetric(float64(sent), "sent-bytes/op")
+		})
+	}
+}
+
+func TestScanBitBoolUnsigned(t *testing.T) {
+	result := func(mock sqlmock.Sqlmock) *sqlmock.Rows {
+		return mock.NewRowsWithColumnDefinition(
+			sqlmock.NewColumn("flag").OfType("BIT", []byte(nil)),
+			sqlmock.NewColumn("mask").OfType("BIT", []byte(nil)),
+			sqlmock.NewColumn("active").OfType("TINYINT", int64(0)),
+			sqlmock.NewColumn("big").OfType("UNSIGNED BIGINT", uint64(0)),
+			sqlmock.NewColumn("text_big").OfType("UNSIGNED BIGINT", []byte(nil)),
+		).
+			AddRow([]byte{0x01}, []byte{0x01, 0x02}, int64(1), uint64(18446744073709551615), []byte("9223372036854775808")).
+			AddRow([]byte{0x00}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, int64(0), uint64(7), []byte("7"))
+	}
+
+	tests := []struct {
+		name string
+		opts scanOptions
+		want []string
+	}{
+		{"numbers", scanOptions{}, []string{
+			`{"active":1,"big":18446744073709551615,"flag":1,"mask":258,"text_big":9223372036854775808}`,
+			`{"active":0,"big":7,"flag":0,"mask":18446744073709551615,"text_big":7}`,
+		}},
+		{"booleanTinyint", scanOptions{booleanTinyint: true}, []string{
+			`{"active":true,"big":18446744073709551615,"flag":1,"mask":258,"text_big":9223372036854775808}`,
+			`{"active":false,"big":7,"flag":0,"mask":18446744073709551615,"text_big":7}`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := scanMockRows(t, result, tt.opts)
+			for i, row := range rows {
+				if got := encodeRow(t, row); got != tt.want[i] {
+					t.Errorf("row %d = %s, want %s", i, got, tt.want[i])
+				}
+			}
+			if big, ok := rows[0]["big"].(json.Number); !ok || big.String() != "18446744073709551615" {
+				t.Errorf("big = %#v, want a json.Number", rows[0]["big"])
+			}
+		})
+	}
+}
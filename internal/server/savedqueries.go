@@ -0,0 +1,271 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const savedQueriesBucket = "saved_queries"
+
+var errSavedQueryNotFound = errors.New("saved query not found")
+
+// savedQuery is a reusable statement. The default connection is a
+// reference to a named connection or profile, never inline credentials.
+type savedQuery struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Query       string   `json:"query"`
+	// Variables declares the query's {{name}} placeholders
+	Variables  []templateVariable `json:"variables"`
+	Connection string             `json:"connection,omitempty"`
+	ProfileID  string             `json:"profileId,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+func (q *savedQuery) validate() error {
+	q.Name = strings.TrimSpace(q.Name)
+	if q.Name == "" || strings.TrimSpace(q.Query) == "" {
+		return errors.New("name and query are required")
+	}
+	if q.Connection != "" && q.ProfileID != "" {
+		return errors.New("provide either a default connection or profileId, not both")
+	}
+	if q.Tags == nil {
+		q.Tags = []string{}
+	}
+	if q.Variables == nil {
+		q.Variables = []templateVariable{}
+	}
+	seen := map[string]bool{}
+	for i := range q.Variables {
+		if err := q.Variables[i].validate(); err != nil {
+			return err
+		}
+		if seen[q.Variables[i].Name] {
+			return fmt.Errorf("variable %s is declared twice", q.Variables[i].Name)
+		}
+		seen[q.Variables[i].Name] = true
+	}
+	return nil
+}
+
+func (q savedQuery) hasTag(tag string) bool {
+	for _, t := range q.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether search (lower-cased) occurs in the name or query.
+func (q savedQuery) matches(search string) bool {
+	return strings.Contains(strings.ToLower(q.Name), search) ||
+		strings.Contains(strings.ToLower(q.Query), search)
+}
+
+func (s *Server) loadSavedQuery(id string) (savedQuery, error) {
+	var q savedQuery
+	found, err := s.storeGet(savedQueriesBucket, id, &q)
+	if err != nil {
+		return q, err
+	}
+	if !found {
+		return q, errSavedQueryNotFound
+	}
+	return q, nil
+}
+
+// applySavedQuery fills req from the saved query it references: the query
+// text and its declared variables, and the default connection when req
+// does not name one itself.
+func (s *Server) applySavedQuery(req *queryRequest) (int, error) {
+	q, err := s.loadSavedQuery(req.SavedQueryID)
+	if errors.Is(err, errSavedQueryNotFound) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if req.Query != "" {
+		return http.StatusBadRequest, errors.New("provide either a query or savedQueryId, not both")
+	}
+
+	req.Query = q.Query
+	req.variableDecls = q.Variables
+	if req.connectionRef == (connectionRef{}) {
+		req.Connection = q.Connection
+		req.ProfileID = q.ProfileID
+	}
+	return 0, nil
+}
+
+func respondSavedQueryError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errSavedQueryNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errStoreClosed):
+		status = http.StatusServiceUnavailable
+	}
+	respondStatusError(c, status, err)
+}
+
+func (s *Server) createSavedQuery(c *gin.Context) {
+	var q savedQuery
+	if !bindJSON(c, &q) {
+		return
+	}
+	if err := q.validate(); err != nil {
+		respondBadRequest(c, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	q.ID, q.CreatedAt, q.UpdatedAt = newID(), now, now
+	if err := s.storePut(savedQueriesBucket, q.ID, q); err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, q)
+}
+
+// allSavedQueries returns every saved query sorted by name.
+func (s *Server) allSavedQueries() ([]savedQuery, error) {
+	queries := []savedQuery{}
+	err := s.storeEach(savedQueriesBucket, func(_ string, data []byte) error {
+		var q savedQuery
+		if err := json.Unmarshal(data, &q); err != nil {
+			return err
+		}
+		queries = append(queries, q)
+		return nil
+	})
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries, err
+}
+
+// listSavedQueries returns saved queries, optionally filtered by a tag and
+// a case-insensitive q search over the name and query text.
+func (s *Server) listSavedQueries(c *gin.Context) {
+	queries, err := s.allSavedQueries()
+	if err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+
+	tag := c.Query("tag")
+	search := strings.ToLower(c.Query("q"))
+	filtered := []savedQuery{}
+	for _, q := range queries {
+		if (tag == "" || q.hasTag(tag)) && (search == "" || q.matches(search)) {
+			filtered = append(filtered, q)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved_queries": filtered})
+}
+
+func (s *Server) getSavedQuery(c *gin.Context) {
+	q, err := s.loadSavedQuery(c.Param("id"))
+	if err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+func (s *Server) updateSavedQuery(c *gin.Context) {
+	current, err := s.loadSavedQuery(c.Param("id"))
+	if err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+
+	var q savedQuery
+	if !bindJSON(c, &q) {
+		return
+	}
+	if err := q.validate(); err != nil {
+		respondBadRequest(c, err.Error())
+		return
+	}
+
+	q.ID, q.CreatedAt, q.UpdatedAt = current.ID, current.CreatedAt, time.Now().UTC()
+	if err := s.storePut(savedQueriesBucket, q.ID, q); err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+func (s *Server) deleteSavedQuery(c *gin.Context) {
+	found, err := s.storeDelete(savedQueriesBucket, c.Param("id"))
+	if err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+	if !found {
+		respondSavedQueryError(c, errSavedQueryNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// savedQueriesExport is the document produced by export and accepted by
+// import, so snippets can be moved between boba instances.
+type savedQueriesExport struct {
+	Version      int          `json:"version"`
+	SavedQueries []savedQuery `json:"saved_queries"`
+}
+
+func (s *Server) exportSavedQueries(c *gin.Context) {
+	queries, err := s.allSavedQueries()
+	if err != nil {
+		respondSavedQueryError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="boba-saved-queries.json"`)
+	c.JSON(http.StatusOK, savedQueriesExport{Version: 1, SavedQueries: queries})
+}
+
+// importSavedQueries adds every query in an export document. Imported
+// queries get new ids so they never overwrite existing ones.
+func (s *Server) importSavedQueries(c *gin.Context) {
+	var doc savedQueriesExport
+	if !bindJSON(c, &doc) {
+		return
+	}
+	for i := range doc.SavedQueries {
+		if err := doc.SavedQueries[i].validate(); err != nil {
+			respondBadRequest(c, fmt.Sprintf("saved query %d: %v", i, err))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	imported := make([]savedQuery, 0, len(doc.SavedQueries))
+	for _, q := range doc.SavedQueries {
+		q.ID, q.UpdatedAt = newID(), now
+		if q.CreatedAt.IsZero() {
+			q.CreatedAt = now
+		}
+		if err := s.storePut(savedQueriesBucket, q.ID, q); err != nil {
+			respondSavedQueryError(c, err)
+			return
+		}
+		imported = append(imported, q)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imported": len(imported), "saved_queries": imported})
+}
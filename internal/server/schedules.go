@@ -0,0 +1,516 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// schedulesBucket holds the schedules; scheduleRunsBucket holds one nested
+// bucket of runs per schedule, keyed like the history.
+const (
+	schedulesBucket    = "schedules"
+	scheduleRunsBucket = "schedule_runs"
+)
+
+const (
+	scheduleDefaultRetention = 10
+	scheduleMaxRetention     = 1000
+)
+
+var (
+	errScheduleNotFound    = errors.New("schedule not found")
+	errScheduleRunNotFound = errors.New("schedule run not found")
+)
+
+// schedule runs a query on a cron schedule, in the server's time zone, and
+// keeps the results of its last Retention runs. Like a saved query, it
+// references a named connection or profile rather than holding
+// credentials.
+type schedule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Cron string `json:"cron"`
+	// Query or SavedQueryID is what runs, with Variables filling in its
+	// placeholders
+	Query        string         `json:"query,omitempty"`
+	SavedQueryID string         `json:"savedQueryId,omitempty"`
+	Variables    map[string]any `json:"variables,omitempty"`
+	Connection   string         `json:"connection,omitempty"`
+	ProfileID    string         `json:"profileId,omitempty"`
+	Retention    int            `json:"retention"`
+	// Webhook is posted the outcome of each run
+	Webhook   *webhook  `json:"webhook,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// NextRunAt is filled in for responses, not stored
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+}
+
+func (s *schedule) validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if _, err := parseCron(s.Cron); err != nil {
+		return fmt.Errorf("invalid cron expression: %v", err)
+	}
+	if (strings.TrimSpace(s.Query) == "") == (s.SavedQueryID == "") {
+		return errors.New("provide either a query or savedQueryId")
+	}
+	if s.Connection != "" && s.ProfileID != "" {
+		return errors.New("provide either a connection or profileId, not both")
+	}
+	// A saved query may bring its own default connection
+	if s.SavedQueryID == "" && s.Connection == "" && s.ProfileID == "" {
+		return errors.New("a connection or profileId is required")
+	}
+	if s.Retention == 0 {
+		s.Retention = scheduleDefaultRetention
+	}
+	if s.Retention < 1 || s.Retention > scheduleMaxRetention {
+		return fmt.Errorf("retention must be between 1 and %d", scheduleMaxRetention)
+	}
+	if s.Webhook != nil {
+		if err := s.Webhook.validate(); err != nil {
+			return err
+		}
+	}
+	s.NextRunAt = nil
+	return nil
+}
+
+// view is s as returned: with when it is next due, and without the
+// webhook's secret.
+func (s schedule) view() schedule {
+	s.Webhook = s.Webhook.redacted()
+	if cron, err := parseCron(s.Cron); err == nil {
+		if next := cron.next(time.Now()); !next.IsZero() {
+			next = next.UTC()
+			s.NextRunAt = &next
+		}
+	}
+	return s
+}
+
+// scheduleRun is one execution of a schedule. Columns and Results are only
+// returned when the run itself is fetched.
+type scheduleRun struct {
+	ID         uint64           `json:"id"`
+	ScheduleID string           `json:"scheduleId"`
+	Status     string           `json:"status"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	DurationMs int64            `json:"duration_ms"`
+	RowCount   int              `json:"row_count"`
+	Truncated  bool             `json:"truncated"`
+	Error      *apiError        `json:"error,omitempty"`
+	Columns    []string         `json:"columns,omitempty"`
+	Results    []map[string]any `json:"results,omitempty"`
+}
+
+func (s *Server) loadSchedule(id string) (schedule, error) {
+	var sched schedule
+	found, err := s.storeGet(schedulesBucket, id, &sched)
+	if err != nil {
+		return sched, err
+	}
+	if !found {
+		return sched, errScheduleNotFound
+	}
+	return sched, nil
+}
+
+// allSchedules returns every schedule sorted by name.
+func (s *Server) allSchedules() ([]schedule, error) {
+	schedules := []schedule{}
+	err := s.storeEach(schedulesBucket, func(_ string, data []byte) error {
+		var sched schedule
+		if err := json.Unmarshal(data, &sched); err != nil {
+			return err
+		}
+		schedules = append(schedules, sched)
+		return nil
+	})
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules, err
+}
+
+// scheduleRunner starts due schedules once a minute. A schedule whose
+// previous run is still going when it is due again is skipped that time.
+// Schedules missed while the server was down are not caught up.
+type scheduleRunner struct {
+	srv     *Server
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// loop runs at the start of every minute, for as long as the server does.
+func (r *scheduleRunner) loop() {
+	for {
+		minute := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(minute))
+		r.tick(minute)
+	}
+}
+
+func (r *scheduleRunner) tick(minute time.Time) {
+	schedules, err := r.srv.allSchedules()
+	if err != nil {
+		log.Printf("Failed to load schedules: %s", sanitizeError(err))
+		return
+	}
+	for _, s := range schedules {
+		if cron, err := parseCron(s.Cron); err == nil && cron.matches(minute) {
+			r.start(s)
+		}
+	}
+}
+
+func (r *scheduleRunner) start(s schedule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running[s.ID] {
+		log.Printf("Skipping schedule %s: its previous run has not finished", s.ID)
+		return
+	}
+	r.running[s.ID] = true
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.running, s.ID)
+			r.mu.Unlock()
+		}()
+		run := r.srv.runSchedule(s)
+		if run.ID = r.srv.recordScheduleRun(s.ID, run); run.ID == 0 {
+			return
+		}
+		r.srv.notifyWebhook(s.Webhook, "", webhookEvent{
+			Event:      "schedule_run.finished",
+			ScheduleID: s.ID,
+			RunID:      run.ID,
+			Status:     run.Status,
+			RowCount:   run.RowCount,
+			DurationMs: run.DurationMs,
+			FinishedAt: run.FinishedAt,
+			Error:      run.Error,
+			ResultsURL: r.srv.resultsURL(fmt.Sprintf("/schedules/%s/runs/%d", s.ID, run.ID)),
+		})
+	}()
+}
+
+// runSchedule executes sched as an async job would, collecting up to
+// cfg.AsyncMaxRows rows.
+func (s *Server) runSchedule(sched schedule) scheduleRun {
+	run := scheduleRun{ScheduleID: sched.ID, Status: jobSucceeded, StartedAt: time.Now().UTC()}
+	req := queryRequest{
+		connectionRef: connectionRef{Connection: sched.Connection, ProfileID: sched.ProfileID},
+		Query:         sched.Query,
+		SavedQueryID:  sched.SavedQueryID,
+		Variables:     sched.Variables,
+	}
+	prepared, _, apiErr := s.prepareQuery(&req)
+	if apiErr == nil {
+		run.Columns, run.Results, run.Truncated, apiErr = s.executeAsync(context.Background(), prepared)
+	}
+	run.FinishedAt = time.Now().UTC()
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.RowCount = len(run.Results)
+	if apiErr != nil {
+		run.Status, run.Error = jobFailed, apiErr
+		run.Columns, run.Results = nil, nil
+	}
+	return run
+}
+
+// recordScheduleRun stores run, trimming the schedule's runs to its
+// retention, and returns its id. The run is dropped, and 0 returned, if
+// the schedule was deleted meanwhile.
+func (s *Server) recordScheduleRun(id string, run scheduleRun) uint64 {
+	if s.store == nil {
+		return 0
+	}
+	err := s.store.Update(func(tx *bolt.Tx) error {
+		var sched schedule
+		raw := tx.Bucket([]byte(schedulesBucket)).Get([]byte(id))
+		if raw == nil {
+			return nil
+		}
+		if err := json.Unmarshal(raw, &sched); err != nil {
+			return err
+		}
+		b, err := tx.Bucket([]byte(scheduleRunsBucket)).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		if run.ID, err = b.NextSequence(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(historyKey(run.ID), data); err != nil {
+			return err
+		}
+		return trimOldest(b, sched.Retention)
+	})
+	if err != nil {
+		log.Printf("Failed to record run of schedule %s: %s", id, sanitizeError(err))
+		return 0
+	}
+	return run.ID
+}
+
+func respondScheduleError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errScheduleNotFound), errors.Is(err, errScheduleRunNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errStoreClosed):
+		status = http.StatusServiceUnavailable
+	}
+	respondStatusError(c, status, err)
+}
+
+func (s *Server) createSchedule(c *gin.Context) {
+	var sched schedule
+	if !bindJSON(c, &sched) {
+		return
+	}
+	if err := sched.validate(); err != nil {
+		respondBadRequest(c, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	sched.ID, sched.CreatedAt, sched.UpdatedAt = newID(), now, now
+	if err := s.storePut(schedulesBucket, sched.ID, sched); err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, sched.view())
+}
+
+func (s *Server) listSchedules(c *gin.Context) {
+	schedules, err := s.allSchedules()
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	for i := range schedules {
+		schedules[i] = schedules[i].view()
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+func (s *Server) getSchedule(c *gin.Context) {
+	sched, err := s.loadSchedule(c.Param("id"))
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sched.view())
+}
+
+// updateSchedule replaces a schedule, trimming its stored runs at once if
+// the retention was lowered.
+func (s *Server) updateSchedule(c *gin.Context) {
+	current, err := s.loadSchedule(c.Param("id"))
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	var sched schedule
+	if !bindJSON(c, &sched) {
+		return
+	}
+	// The secret is never returned, so it may be left out to keep it
+	if sched.Webhook != nil && sched.Webhook.Secret == "" && current.Webhook != nil && sched.Webhook.URL == current.Webhook.URL {
+		sched.Webhook.Secret = current.Webhook.Secret
+	}
+	if err := sched.validate(); err != nil {
+		respondBadRequest(c, err.Error())
+		return
+	}
+
+	sched.ID, sched.CreatedAt, sched.UpdatedAt = current.ID, current.CreatedAt, time.Now().UTC()
+	data, err := json.Marshal(sched)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	err = s.store.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(schedulesBucket)).Put([]byte(sched.ID), data); err != nil {
+			return err
+		}
+		if b := tx.Bucket([]byte(scheduleRunsBucket)).Bucket([]byte(sched.ID)); b != nil {
+			return trimOldest(b, sched.Retention)
+		}
+		return nil
+	})
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sched.view())
+}
+
+// deleteSchedule removes a schedule and its runs. A run in progress
+// finishes, but is not stored.
+func (s *Server) deleteSchedule(c *gin.Context) {
+	if s.store == nil {
+		respondScheduleError(c, errStoreClosed)
+		return
+	}
+	id := c.Param("id")
+	found := false
+	err := s.store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(schedulesBucket))
+		if b.Get([]byte(id)) == nil {
+			return nil
+		}
+		found = true
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+		runs := tx.Bucket([]byte(scheduleRunsBucket))
+		if runs.Bucket([]byte(id)) == nil {
+			return nil
+		}
+		return runs.DeleteBucket([]byte(id))
+	})
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	if !found {
+		respondScheduleError(c, errScheduleNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// listScheduleRuns returns a schedule's stored runs newest first, without
+// their results.
+func (s *Server) listScheduleRuns(c *gin.Context) {
+	sched, err := s.loadSchedule(c.Param("id"))
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	runs := []scheduleRun{}
+	err = s.store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(scheduleRunsBucket)).Bucket([]byte(sched.ID))
+		if b == nil {
+			return nil
+		}
+		cursor := b.Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			var run scheduleRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			run.Columns, run.Results = nil, nil
+			runs = append(runs, run)
+		}
+		return nil
+	})
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// getScheduleRun returns one run with its results, as JSON or, with
+// format=csv, as a CSV file of the result rows.
+func (s *Server) getScheduleRun(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		respondBadRequest(c, "format must be json or csv")
+		return
+	}
+	runID, err := strconv.ParseUint(c.Param("run"), 10, 64)
+	if err != nil {
+		respondScheduleError(c, errScheduleRunNotFound)
+		return
+	}
+	sched, err := s.loadSchedule(c.Param("id"))
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	var run scheduleRun
+	err = s.store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(scheduleRunsBucket)).Bucket([]byte(sched.ID))
+		if b == nil {
+			return errScheduleRunNotFound
+		}
+		raw := b.Get(historyKey(runID))
+		if raw == nil {
+			return errScheduleRunNotFound
+		}
+		// Numbers are kept as they were stored rather than made float64
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		return dec.Decode(&run)
+	})
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, run)
+		return
+	}
+	if run.Status != jobSucceeded {
+		respondBadRequest(c, "The run failed, so it has no results to download")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="schedule-%s-run-%d.csv"`, sched.ID, run.ID))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	w.Write(run.Columns)
+	record := make([]string, len(run.Columns))
+	for _, row := range run.Results {
+		for i, col := range run.Columns {
+			record[i] = csvCell(row[col])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+}
+
+// csvCell renders a result value as CSV text: NULL as an empty cell, and
+// JSON documents as their JSON.
+func csvCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
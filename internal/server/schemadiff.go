@@ -0,0 +1,484 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+type schemaDiffRequest struct {
+	// A and B are compared in their databases; the suggested statements
+	// turn B into A
+	A connectionRef `json:"a"`
+	B connectionRef `json:"b"`
+	// Alter adds the ALTER TABLE statements that would reconcile B to A
+	Alter bool `json:"alter"`
+}
+
+// schemaColumn is a column as the schema diff compares it.
+type schemaColumn struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default"`
+	Extra    string  `json:"extra,omitempty"`
+	// Generated is the expression of a generated column
+	Generated string `json:"generated,omitempty"`
+}
+
+type schemaIndex struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Columns []string `json:"columns"`
+}
+
+// schemaTable is a table of one side, with its columns in order.
+type schemaTable struct {
+	columns     []schemaColumn
+	indexes     map[string]schemaIndex
+	foreignKeys map[string]foreignKey
+	// createStmt is SHOW CREATE TABLE, read for tables only A has
+	createStmt string
+}
+
+type schemaSide struct {
+	database string
+	tables   map[string]*schemaTable
+}
+
+type valueChange struct {
+	A any `json:"a"`
+	B any `json:"b"`
+}
+
+type columnChange struct {
+	Column  string                 `json:"column"`
+	Changes map[string]valueChange `json:"changes"`
+}
+
+// tableDiff is what differs in a table both sides have. Changed indexes
+// and foreign keys are listed with both definitions.
+type tableDiff struct {
+	Table   string `json:"table"`
+	Columns struct {
+		OnlyInA []schemaColumn `json:"only_in_a"`
+		OnlyInB []schemaColumn `json:"only_in_b"`
+		Changed []columnChange `json:"changed"`
+	} `json:"columns"`
+	Indexes struct {
+		OnlyInA []schemaIndex `json:"only_in_a"`
+		OnlyInB []schemaIndex `json:"only_in_b"`
+		Changed []valueChange `json:"changed"`
+	} `json:"indexes"`
+	ForeignKeys struct {
+		OnlyInA []foreignKey  `json:"only_in_a"`
+		OnlyInB []foreignKey  `json:"only_in_b"`
+		Changed []valueChange `json:"changed"`
+	} `json:"foreign_keys"`
+
+	alter []string
+}
+
+func (d *tableDiff) empty() bool {
+	return len(d.Columns.OnlyInA)+len(d.Columns.OnlyInB)+len(d.Columns.Changed)+
+		len(d.Indexes.OnlyInA)+len(d.Indexes.OnlyInB)+len(d.Indexes.Changed)+
+		len(d.ForeignKeys.OnlyInA)+len(d.ForeignKeys.OnlyInB)+len(d.ForeignKeys.Changed) == 0
+}
+
+// diffSchemas compares the tables of two databases, possibly on different
+// servers: which tables only one has, and in the tables both have, the
+// columns, indexes and foreign keys that differ. With alter it also
+// suggests the statements that would make B match A; they are never run.
+func (s *Server) diffSchemas(c *gin.Context) {
+	var req schemaDiffRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var (
+		wg      sync.WaitGroup
+		sides   [2]*schemaSide
+		status  [2]int
+		apiErrs [2]*apiError
+	)
+	for i, ref := range []connectionRef{req.A, req.B} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sides[i], status[i], apiErrs[i] = s.readSchemaSide(ctx, ref, i == 0 && req.Alter)
+		}()
+	}
+	wg.Wait()
+	for i, name := range []string{"a", "b"} {
+		if apiErrs[i] != nil {
+			apiErrs[i].Message = name + ": " + apiErrs[i].Message
+			respondAPIError(c, status[i], *apiErrs[i])
+			return
+		}
+	}
+	a, b := sides[0], sides[1]
+
+	onlyInA, onlyInB, common := []string{}, []string{}, []string{}
+	for _, name := range sortedKeys(a.tables) {
+		if _, ok := b.tables[name]; ok {
+			common = append(common, name)
+		} else {
+			onlyInA = append(onlyInA, name)
+		}
+	}
+	for _, name := range sortedKeys(b.tables) {
+		if _, ok := a.tables[name]; !ok {
+			onlyInB = append(onlyInB, name)
+		}
+	}
+
+	tables := []*tableDiff{}
+	var statements []string
+	for _, name := range onlyInA {
+		if stmt := a.tables[name].createStmt; stmt != "" {
+			statements = append(statements, stmt+";")
+		}
+	}
+	for _, name := range common {
+		d := diffTable(name, a.tables[name], b.tables[name], a.database)
+		if d.empty() {
+			continue
+		}
+		tables = append(tables, d)
+		if len(d.alter) > 0 {
+			statements = append(statements, "ALTER TABLE "+quoteIdent(name)+"\n  "+strings.Join(d.alter, ",\n  ")+";")
+		}
+	}
+	for _, name := range onlyInB {
+		statements = append(statements, "DROP TABLE "+quoteIdent(name)+";")
+	}
+
+	response := gin.H{
+		"a_database": a.database,
+		"b_database": b.database,
+		"only_in_a":  onlyInA,
+		"only_in_b":  onlyInB,
+		"tables":     tables,
+		"identical":  len(onlyInA) == 0 && len(onlyInB) == 0 && len(tables) == 0,
+	}
+	if req.Alter {
+		if statements == nil {
+			statements = []string{}
+		}
+		response["suggested_statements"] = statements
+		response["note"] = "Suggestions to run against b to match a, not executed; review them first, as dropping tables, columns and keys loses data"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readSchemaSide introspects the base tables of ref's database, with their
+// CREATE TABLE statements when create is set.
+func (s *Server) readSchemaSide(ctx context.Context, ref connectionRef, create bool) (*schemaSide, int, *apiError) {
+	creds, status, err := s.resolveCredentials(ref)
+	if err != nil {
+		return nil, status, &apiError{Code: codeForStatus(status), Message: sanitizeError(err)}
+	}
+	if creds.Database == "" {
+		return nil, http.StatusBadRequest, &apiError{Code: codeBadRequest, Message: "The connection has no database selected"}
+	}
+	db, err := s.connectToDatabase(creds)
+	if err != nil {
+		status, body := classifyConnectionError(err)
+		return nil, status, &body
+	}
+	side, err := introspectSchema(ctx, db, creds.Database, create)
+	if err != nil {
+		status, body := classifyDBError(err)
+		return nil, status, &body
+	}
+	return side, 0, nil
+}
+
+func introspectSchema(ctx context.Context, db *sql.DB, schema string, create bool) (*schemaSide, error) {
+	side := &schemaSide{database: schema, tables: map[string]*schemaTable{}}
+	rows, err := db.QueryContext(ctx,
+		"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'", schema)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		side.tables[name] = &schemaTable{indexes: map[string]schemaIndex{}, foreignKeys: map[string]foreignKey{}}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx,
+		`SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'YES', COLUMN_DEFAULT, EXTRA, COALESCE(GENERATION_EXPRESSION, '')
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION`, schema)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table string
+		var col schemaColumn
+		var def sql.NullString
+		if err := rows.Scan(&table, &col.Name, &col.Type, &col.Nullable, &def, &col.Extra, &col.Generated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if def.Valid {
+			col.Default = &def.String
+		}
+		if t, ok := side.tables[table]; ok {
+			t.columns = append(t.columns, col)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx,
+		`SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE = 0, COLUMN_NAME
+		FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`, schema)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table, name, column string
+		var unique bool
+		if err := rows.Scan(&table, &name, &unique, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t, ok := side.tables[table]; ok {
+			idx := t.indexes[name]
+			idx.Name, idx.Unique, idx.Columns = name, unique, append(idx.Columns, column)
+			t.indexes[name] = idx
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys, err := readForeignKeys(ctx, db, schema, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, fk := range keys {
+		if t, ok := side.tables[fk.Table]; ok {
+			t.foreignKeys[fk.Name] = *fk
+		}
+	}
+
+	if create {
+		for name, t := range side.tables {
+			var ignored string
+			err := db.QueryRowContext(ctx, "SHOW CREATE TABLE "+quoteIdent(schema)+"."+quoteIdent(name)).Scan(&ignored, &t.createStmt)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return side, nil
+}
+
+// diffTable compares the definitions of table on both sides, collecting
+// the ALTER TABLE clauses that turn b into a. schemaA is a's database, so a
+// foreign key to another table of it points to b's own.
+func diffTable(name string, a, b *schemaTable, schemaA string) *tableDiff {
+	d := &tableDiff{Table: name}
+	d.Columns.OnlyInA, d.Columns.OnlyInB, d.Columns.Changed = []schemaColumn{}, []schemaColumn{}, []columnChange{}
+	d.Indexes.OnlyInA, d.Indexes.OnlyInB, d.Indexes.Changed = []schemaIndex{}, []schemaIndex{}, []valueChange{}
+	d.ForeignKeys.OnlyInA, d.ForeignKeys.OnlyInB, d.ForeignKeys.Changed = []foreignKey{}, []foreignKey{}, []valueChange{}
+
+	// Foreign keys are dropped first, as they may hold on to the indexes
+	// and columns dropped after them
+	for _, fkName := range sortedKeys(b.foreignKeys) {
+		fkA, ok := a.foreignKeys[fkName]
+		fkB := b.foreignKeys[fkName]
+		switch {
+		case !ok:
+			d.ForeignKeys.OnlyInB = append(d.ForeignKeys.OnlyInB, fkB)
+			d.alter = append(d.alter, "DROP FOREIGN KEY "+quoteIdent(fkName))
+		case !sameForeignKey(fkA, fkB):
+			d.ForeignKeys.Changed = append(d.ForeignKeys.Changed, valueChange{A: fkA, B: fkB})
+			d.alter = append(d.alter, "DROP FOREIGN KEY "+quoteIdent(fkName))
+		}
+	}
+	for _, idxName := range sortedKeys(b.indexes) {
+		idxA, ok := a.indexes[idxName]
+		idxB := b.indexes[idxName]
+		switch {
+		case !ok:
+			d.Indexes.OnlyInB = append(d.Indexes.OnlyInB, idxB)
+			d.alter = append(d.alter, dropIndexClause(idxB))
+		case idxA.Unique != idxB.Unique || !slices.Equal(idxA.Columns, idxB.Columns):
+			d.Indexes.Changed = append(d.Indexes.Changed, valueChange{A: idxA, B: idxB})
+			d.alter = append(d.alter, dropIndexClause(idxB))
+		}
+	}
+
+	previous := ""
+	for _, colA := range a.columns {
+		i := slices.IndexFunc(b.columns, func(col schemaColumn) bool { return col.Name == colA.Name })
+		position := " FIRST"
+		if previous != "" {
+			position = " AFTER " + quoteIdent(previous)
+		}
+		previous = colA.Name
+		if i < 0 {
+			d.Columns.OnlyInA = append(d.Columns.OnlyInA, colA)
+			d.alter = append(d.alter, "ADD COLUMN "+columnDefinition(colA)+position)
+			continue
+		}
+		if changes := columnChanges(colA, b.columns[i]); len(changes) > 0 {
+			d.Columns.Changed = append(d.Columns.Changed, columnChange{Column: colA.Name, Changes: changes})
+			d.alter = append(d.alter, "MODIFY COLUMN "+columnDefinition(colA))
+		}
+	}
+	for _, colB := range b.columns {
+		if !slices.ContainsFunc(a.columns, func(col schemaColumn) bool { return col.Name == colB.Name }) {
+			d.Columns.OnlyInB = append(d.Columns.OnlyInB, colB)
+			d.alter = append(d.alter, "DROP COLUMN "+quoteIdent(colB.Name))
+		}
+	}
+
+	for _, idxName := range sortedKeys(a.indexes) {
+		idxA := a.indexes[idxName]
+		idxB, ok := b.indexes[idxName]
+		switch {
+		case !ok:
+			d.Indexes.OnlyInA = append(d.Indexes.OnlyInA, idxA)
+			d.alter = append(d.alter, addIndexClause(idxA))
+		case idxA.Unique != idxB.Unique || !slices.Equal(idxA.Columns, idxB.Columns):
+			d.alter = append(d.alter, addIndexClause(idxA))
+		}
+	}
+	for _, fkName := range sortedKeys(a.foreignKeys) {
+		fkA := a.foreignKeys[fkName]
+		fkB, ok := b.foreignKeys[fkName]
+		switch {
+		case !ok:
+			d.ForeignKeys.OnlyInA = append(d.ForeignKeys.OnlyInA, fkA)
+			d.alter = append(d.alter, addForeignKeyClause(fkA, schemaA))
+		case !sameForeignKey(fkA, fkB):
+			d.alter = append(d.alter, addForeignKeyClause(fkA, schemaA))
+		}
+	}
+	return d
+}
+
+func columnChanges(a, b schemaColumn) map[string]valueChange {
+	changes := map[string]valueChange{}
+	if !strings.EqualFold(a.Type, b.Type) {
+		changes["type"] = valueChange{A: a.Type, B: b.Type}
+	}
+	if a.Nullable != b.Nullable {
+		changes["nullable"] = valueChange{A: a.Nullable, B: b.Nullable}
+	}
+	if (a.Default == nil) != (b.Default == nil) || a.Default != nil && *a.Default != *b.Default {
+		changes["default"] = valueChange{A: a.Default, B: b.Default}
+	}
+	if !strings.EqualFold(a.Extra, b.Extra) {
+		changes["extra"] = valueChange{A: a.Extra, B: b.Extra}
+	}
+	if a.Generated != b.Generated {
+		changes["generated"] = valueChange{A: a.Generated, B: b.Generated}
+	}
+	return changes
+}
+
+func sameForeignKey(a, b foreignKey) bool {
+	return slices.Equal(a.Columns, b.Columns) && a.ReferencedTable == b.ReferencedTable &&
+		slices.Equal(a.ReferencedColumns, b.ReferencedColumns) &&
+		a.OnUpdate == b.OnUpdate && a.OnDelete == b.OnDelete
+}
+
+// currentTimestampPattern matches the defaults MySQL takes unparenthesized.
+var currentTimestampPattern = regexp.MustCompile(`(?i)^(CURRENT_TIMESTAMP|NOW)(\(\d*\))?$`)
+
+// columnDefinition renders col as in CREATE TABLE.
+func columnDefinition(col schemaColumn) string {
+	def := quoteIdent(col.Name) + " " + col.Type
+	extra := strings.TrimSpace(strings.Replace(col.Extra, "DEFAULT_GENERATED", "", 1))
+	if col.Generated != "" {
+		kind := "VIRTUAL"
+		if strings.Contains(strings.ToUpper(extra), "STORED") {
+			kind = "STORED"
+		}
+		def += " GENERATED ALWAYS AS (" + col.Generated + ") " + kind
+		extra = ""
+	}
+	if !col.Nullable {
+		def += " NOT NULL"
+	}
+	switch {
+	case col.Default == nil:
+	case currentTimestampPattern.MatchString(*col.Default):
+		def += " DEFAULT " + *col.Default
+	case strings.Contains(col.Extra, "DEFAULT_GENERATED"):
+		def += " DEFAULT (" + *col.Default + ")"
+	default:
+		def += " DEFAULT " + quoteString(*col.Default)
+	}
+	if extra != "" {
+		def += " " + extra
+	}
+	return def
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func dropIndexClause(idx schemaIndex) string {
+	if idx.Name == "PRIMARY" {
+		return "DROP PRIMARY KEY"
+	}
+	return "DROP INDEX " + quoteIdent(idx.Name)
+}
+
+func addIndexClause(idx schemaIndex) string {
+	switch {
+	case idx.Name == "PRIMARY":
+		return "ADD PRIMARY KEY (" + quoteIdents(idx.Columns) + ")"
+	case idx.Unique:
+		return "ADD UNIQUE INDEX " + quoteIdent(idx.Name) + " (" + quoteIdents(idx.Columns) + ")"
+	}
+	return "ADD INDEX " + quoteIdent(idx.Name) + " (" + quoteIdents(idx.Columns) + ")"
+}
+
+func addForeignKeyClause(fk foreignKey, schemaA string) string {
+	target := quoteIdent(fk.ReferencedTable)
+	if fk.ReferencedSchema != schemaA {
+		target = quoteIdent(fk.ReferencedSchema) + "." + target
+	}
+	return fmt.Sprintf("ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE %s ON UPDATE %s",
+		quoteIdent(fk.Name), quoteIdents(fk.Columns), target, quoteIdents(fk.ReferencedColumns), fk.OnDelete, fk.OnUpdate)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+var errSecretKeyUnset = errors.New("BOBA_SECRET_KEY is not set")
+
+// deriveSecretKey turns the BOBA_SECRET_KEY passphrase into an AES-256 key.
+func deriveSecretKey(passphrase string) []byte {
+	sum := sha256.Sum256([]byte(passphrase))
+	return sum[:]
+}
+
+func (s *Server) secretCipher() (cipher.AEAD, error) {
+	if s.cfg.SecretKey == nil {
+		return nil, errSecretKeyUnset
+	}
+	return keyCipher(s.cfg.SecretKey)
+}
+
+func keyCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret seals plaintext with AES-GCM, prefixing the random nonce.
+func (s *Server) encryptSecret(plaintext []byte) ([]byte, error) {
+	gcm, err := s.secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	return seal(gcm, plaintext)
+}
+
+func (s *Server) decryptSecret(sealed []byte) ([]byte, error) {
+	gcm, err := s.secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	return unseal(gcm, sealed)
+}
+
+func seal(gcm cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func unseal(gcm cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed secret is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
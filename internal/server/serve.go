@@ -0,0 +1,133 @@
+// Package server is the boba HTTP API and the web UI it serves.
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// connector opens the database connections every handler uses. The pool
+// connector is swapped for a fake, such as one returning an sqlmock
+// database, to exercise handlers without a MySQL server.
+type connector interface {
+	// connect returns a *sql.DB for creds that is shared and must not be
+	// closed by the caller
+	connect(creds dbCredentials) (*sql.DB, error)
+}
+
+// Server is a configured boba server: its settings and the stores, pools
+// and limits its handlers share. Servers are independent, so one process,
+// such as a test, may run several with different configurations.
+type Server struct {
+	cfg       *config
+	connector connector
+	// assets is the web UI, which the boba command builds into the binary
+	// so it runs from any directory
+	assets fs.FS
+	// store is the local bbolt database holding server-side state such as
+	// connection profiles, opened by Run
+	store *bolt.DB
+	// auditDB is the SQLite audit log opened from cfg.AuditDB, nil when
+	// audit logging is off. Unlike the history it keeps every query of
+	// every session, and nothing trims it.
+	auditDB *sql.DB
+	// tracingEnabled is set once setupTracing has installed an exporter.
+	// Without one the router has no tracing middleware and startDBSpan
+	// does nothing, so tracing costs nothing.
+	tracingEnabled bool
+
+	dbPools        *poolManager
+	tunnels        *tunnelPool
+	idleResources  *idleReaper
+	queryLimits    *queryLimiter
+	queryFlights   *flightGroup
+	queryCursors   *cursorManager
+	stickySessions *stickyManager
+	resultsCache   *resultCache
+	asyncJobs      *asyncJobManager
+	scheduler      *scheduleRunner
+	streamTokens   *streamTokenStore
+	// gzipWriters holds gzip.Writers at cfg.GzipLevel for reuse
+	gzipWriters sync.Pool
+	// deprecatedPathsLogged holds the routes whose deprecated use was
+	// logged
+	deprecatedPathsLogged sync.Map
+}
+
+// New configures a server from the BOBA_* environment variables and the
+// command-line args, serving the web UI from assets, which must hold
+// index.html.
+func New(args []string, assets fs.FS) (*Server, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := c.parseFlags(args); err != nil {
+		return nil, fmt.Errorf("invalid flags: %w", err)
+	}
+	return newServer(c, assets), nil
+}
+
+// newServer returns a server with configuration c connecting through its
+// own pools.
+func newServer(c *config, assets fs.FS) *Server {
+	s := &Server{cfg: c, assets: assets}
+	s.connector = poolConnector{srv: s}
+	s.idleResources = &idleReaper{resources: map[*idleResource]struct{}{}}
+	s.dbPools = &poolManager{srv: s, pools: map[string]*dbPool{}}
+	s.tunnels = &tunnelPool{tunnels: map[string]*sshTunnel{}}
+	s.queryLimits = &queryLimiter{cfg: c, sessions: map[string]*sessionSlots{}}
+	s.queryFlights = &flightGroup{flights: map[string]*queryFlight{}}
+	s.queryCursors = &cursorManager{cfg: c, idle: s.idleResources, cursors: map[string]*queryCursor{}}
+	s.stickySessions = &stickyManager{srv: s, sessions: map[string]*stickySession{}}
+	s.resultsCache = newResultCache(c)
+	s.asyncJobs = &asyncJobManager{srv: s, jobs: map[string]*asyncJob{}}
+	s.scheduler = &scheduleRunner{srv: s, running: map[string]bool{}}
+	s.streamTokens = &streamTokenStore{tokens: map[string]streamToken{}}
+	s.gzipWriters.New = func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, c.GzipLevel)
+		return gz
+	}
+	return s
+}
+
+// Handler returns the routes, without the store or background jobs Run
+// starts.
+func (s *Server) Handler() http.Handler {
+	return s.setupRouter()
+}
+
+// Run opens the store and audit log, starts tracing, the scheduler and snapshot expiry,
+// and serves on addr until the listener fails.
+func (s *Server) Run(addr string) error {
+	if err := s.openStore(s.cfg.DataFile); err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.cfg.DataFile, err)
+	}
+	defer s.store.Close()
+	if s.cfg.AuditDB != "" {
+		if err := s.openAudit(s.cfg.AuditDB); err != nil {
+			return fmt.Errorf("failed to open the audit log %s: %w", s.cfg.AuditDB, err)
+		}
+		defer s.closeAudit()
+	}
+	shutdownTracing, err := s.setupTracing(context.Background())
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+	go s.scheduler.loop()
+	go s.expireSnapshots()
+
+	r := s.setupRouter()
+	log.Printf("Server starting on %s", addr)
+	return r.Run(addr)
+}
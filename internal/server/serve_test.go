@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestServersAreIndependent(t *testing.T) {
+	open := newTestServer()
+	locked := newTestServer(func(c *config) {
+		c.QueryBlock = []*regexp.Regexp{regexp.MustCompile(`(?i)^SELECT`)}
+		c.QueryMaxConcurrent = 1
+	})
+	mock := withMockDB(t, open)
+	withMockDB(t, locked)
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	// Taking the only slot of locked leaves those of open alone
+	release, _, err := locked.queryLimits.acquire(context.Background(), "other", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	body := `{` + credentialsJSON + `,"query":"SELECT 1","queue":false}`
+	if w := postJSON(t, locked, "/api/v1/execute-query", body); w.Code != http.StatusForbidden {
+		t.Errorf("locked server: status %d: %s", w.Code, w.Body)
+	}
+	// The query reaches the database of open only
+	if w := postJSON(t, open, "/api/v1/execute-query", body); w.Code != http.StatusOK {
+		t.Errorf("open server: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverInfo reports the database version, driver and connected account so
+// clients can enable features based on what the server supports.
+func (s *Server) serverInfo(c *gin.Context) {
+	var req connectionRef
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	db, _, ok := s.openConnection(c, req)
+	if !ok {
+		return
+	}
+
+	var version, user string
+	err := db.QueryRowContext(c.Request.Context(), "SELECT VERSION(), CURRENT_USER()").Scan(&version, &user)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"driver":       driverName,
+		"version":      version,
+		"current_user": user,
+	})
+}
+
+// process is a row of information_schema.PROCESSLIST.
+type process struct {
+	ID      int64   `json:"id"`
+	User    string  `json:"user"`
+	Host    string  `json:"host"`
+	DB      *string `json:"db"`
+	Command string  `json:"command"`
+	Time    int64   `json:"time"`
+	State   *string `json:"state"`
+	Info    *string `json:"info"`
+}
+
+// fields returns scan destinations for columns, matched by name since
+// some servers add columns (MariaDB has Progress).
+func (p *process) fields(columns []string) []any {
+	fields := make([]any, len(columns))
+	for i, col := range columns {
+		switch strings.ToLower(col) {
+		case "id":
+			fields[i] = &p.ID
+		case "user":
+			fields[i] = &p.User
+		case "host":
+			fields[i] = &p.Host
+		case "db":
+			fields[i] = &p.DB
+		case "command":
+			fields[i] = &p.Command
+		case "time":
+			fields[i] = &p.Time
+		case "state":
+			fields[i] = &p.State
+		case "info":
+			fields[i] = &p.Info
+		default:
+			fields[i] = new(any)
+		}
+	}
+	return fields
+}
+
+// processList returns the threads running on the server, from
+// information_schema.PROCESSLIST, to find long-running or blocked queries
+// and their ids.
+func (s *Server) processList(c *gin.Context) {
+	var req connectionRef
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	db, _, ok := s.openConnection(c, req)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), "SELECT * FROM information_schema.PROCESSLIST")
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	processes := []process{}
+	for rows.Next() {
+		var p process
+		if err := rows.Scan(p.fields(columns)...); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		processes = append(processes, p)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"processes": processes})
+}
+
+type killRequest struct {
+	connectionRef
+	ID int64 `json:"id"`
+	// QueryOnly ends the thread's running statement with KILL QUERY but
+	// keeps its connection
+	QueryOnly bool `json:"queryOnly"`
+}
+
+// killProcess terminates a server thread, for queries that keep running
+// after their client went away. It must be enabled with BOBA_ALLOW_KILL
+// and is refused on read-only connections.
+func (s *Server) killProcess(c *gin.Context) {
+	if !s.cfg.AllowKill {
+		respondError(c, http.StatusForbidden, codeForbidden, "Killing processes is disabled on this server; set BOBA_ALLOW_KILL=true to enable it")
+		return
+	}
+	var req killRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.ID <= 0 {
+		respondBadRequest(c, "A process id is required")
+		return
+	}
+
+	db, creds, ok := s.openConnection(c, req.connectionRef)
+	if !ok {
+		return
+	}
+	if creds.ReadOnly {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Processes cannot be killed on a read-only connection")
+		return
+	}
+
+	stmt := "KILL CONNECTION "
+	if req.QueryOnly {
+		stmt = "KILL QUERY "
+	}
+	stmt += strconv.FormatInt(req.ID, 10)
+	defer s.recordHandlerQuery(c, creds, stmt, time.Now(), 0)
+	if _, err := db.ExecContext(c.Request.Context(), stmt); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"killed": req.ID, "query_only": req.QueryOnly})
+}
+
+type serverVariablesRequest struct {
+	connectionRef
+	// Like filters the names with a LIKE pattern, matched case-insensitively
+	Like string `json:"like"`
+}
+
+// serverStatus returns SHOW GLOBAL STATUS as a map, with a summary of the
+// figures a dashboard shows.
+func (s *Server) serverStatus(c *gin.Context) {
+	var req serverVariablesRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	status, ok := s.showVariables(c, req.connectionRef, "SHOW GLOBAL STATUS")
+	if !ok {
+		return
+	}
+	summary := statusSummary(status)
+	c.JSON(http.StatusOK, gin.H{"status": filterVariables(status, req.Like), "summary": summary})
+}
+
+// serverVariables returns SHOW VARIABLES as a map.
+func (s *Server) serverVariables(c *gin.Context) {
+	var req serverVariablesRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	variables, ok := s.showVariables(c, req.connectionRef, "SHOW VARIABLES")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"variables": filterVariables(variables, req.Like)})
+}
+
+// showVariables runs a SHOW STATUS or SHOW VARIABLES statement and returns
+// its rows by name, with numeric values as numbers.
+func (s *Server) showVariables(c *gin.Context, ref connectionRef, stmt string) (map[string]any, bool) {
+	db, _, ok := s.openConnection(c, ref)
+	if !ok {
+		return nil, false
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), stmt)
+	if err != nil {
+		respondDBError(c, err)
+		return nil, false
+	}
+	defer rows.Close()
+	values := map[string]any{}
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			respondDBError(c, err)
+			return nil, false
+		}
+		values[name] = sniffValue(value)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return nil, false
+	}
+	return values, true
+}
+
+// sniffValue returns a variable's value as a number when it is one.
+func sniffValue(value sql.NullString) any {
+	if !value.Valid {
+		return nil
+	}
+	if n, err := strconv.ParseInt(value.String, 10, 64); err == nil {
+		return n
+	}
+	if n, err := strconv.ParseUint(value.String, 10, 64); err == nil {
+		return n
+	}
+	if decimalPattern.MatchString(value.String) {
+		if f, err := strconv.ParseFloat(value.String, 64); err == nil {
+			return f
+		}
+	}
+	return value.String
+}
+
+// filterVariables keeps the values whose names match the LIKE pattern,
+// which is matched here rather than sent to the server.
+func filterVariables(values map[string]any, like string) map[string]any {
+	if like == "" {
+		return values
+	}
+	match := likePattern(like)
+	filtered := map[string]any{}
+	for name, value := range values {
+		if match.MatchString(name) {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+// likePattern compiles a LIKE pattern, with % and _ as wildcards and \
+// escaping them, to a case-insensitive regexp.
+func likePattern(like string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for i := 0; i < len(like); i++ {
+		switch ch := like[i]; {
+		case ch == '\\' && i+1 < len(like):
+			i++
+			b.WriteString(regexp.QuoteMeta(like[i : i+1]))
+		case ch == '%':
+			b.WriteString(".*")
+		case ch == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(like[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// statusSummary computes the dashboard figures from SHOW GLOBAL STATUS;
+// figures the server does not report are null.
+func statusSummary(status map[string]any) gin.H {
+	number := func(name string) (float64, bool) {
+		switch v := status[name].(type) {
+		case int64:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		case float64:
+			return v, true
+		}
+		return 0, false
+	}
+
+	summary := gin.H{"uptime_seconds": nil, "threads_connected": nil, "queries_per_second": nil, "buffer_pool_hit_ratio": nil}
+	uptime, hasUptime := number("Uptime")
+	if hasUptime {
+		summary["uptime_seconds"] = uptime
+	}
+	if threads, ok := number("Threads_connected"); ok {
+		summary["threads_connected"] = threads
+	}
+	if queries, ok := number("Queries"); ok && hasUptime && uptime > 0 {
+		summary["queries_per_second"] = queries / uptime
+	}
+	reads, hasReads := number("Innodb_buffer_pool_reads")
+	if requests, ok := number("Innodb_buffer_pool_read_requests"); ok && hasReads && requests > 0 {
+		summary["buffer_pool_hit_ratio"] = 1 - reads/requests
+	}
+	return summary
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionHeader     = "X-Session-ID"
+	sessionCookie     = "boba_session"
+	sessionContextKey = "session"
+	sessionCookieAge  = 365 * 24 * 60 * 60
+)
+
+// sessionMiddleware identifies the client session, from the X-Session-ID
+// header when given or else a long-lived cookie it issues, and stores it in
+// the request context for per-session state such as history.
+func (s *Server) sessionMiddleware(c *gin.Context) {
+	id := c.GetHeader(sessionHeader)
+	if id == "" {
+		id, _ = c.Cookie(sessionCookie)
+	}
+	if id == "" {
+		id = newID()
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    id,
+			Path:     s.cfg.BasePath + "/",
+			MaxAge:   sessionCookieAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	c.Set(sessionContextKey, id)
+	c.Next()
+}
+
+// sessionID returns the session of the current request.
+func sessionID(c *gin.Context) string {
+	return c.GetString(sessionContextKey)
+}
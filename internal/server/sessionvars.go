@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// sessionVariableNames are the variables a request may set with
+// sessionVariables. Variables that would undo a connection's restrictions,
+// such as transaction_read_only, are deliberately absent.
+var sessionVariableNames = toSet(
+	"sql_mode", "time_zone", "max_execution_time", "sql_select_limit",
+	"group_concat_max_len", "sql_safe_updates", "sql_big_selects",
+	"transaction_isolation", "lock_wait_timeout", "innodb_lock_wait_timeout",
+	"div_precision_increment", "cte_max_recursion_depth", "optimizer_switch",
+	"optimizer_search_depth", "long_query_time", "net_read_timeout",
+	"net_write_timeout", "character_set_results", "collation_connection",
+	"lc_time_names", "sort_buffer_size", "tmp_table_size", "max_heap_table_size",
+)
+
+// validateSessionVariables checks names against sessionVariableNames and
+// converts the values to what SET accepts: strings and numbers, with
+// booleans as 1 or 0.
+func validateSessionVariables(vars map[string]any) (map[string]any, error) {
+	valid := make(map[string]any, len(vars))
+	for name, value := range vars {
+		key := strings.ToLower(name)
+		if !sessionVariableNames[key] {
+			return nil, fmt.Errorf("session variable %s cannot be set", name)
+		}
+		switch v := value.(type) {
+		case string:
+			valid[key] = v
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				valid[key] = int64(v)
+			} else {
+				valid[key] = v
+			}
+		case bool:
+			valid[key] = 0
+			if v {
+				valid[key] = 1
+			}
+		default:
+			return nil, fmt.Errorf("session variable %s must be a string, number or boolean", name)
+		}
+	}
+	return valid, nil
+}
+
+// sessionQueryer returns db itself when there is no database to switch to
+// or variables to set and query is read-only, or else a dedicated
+// connection set up with prepareConn, which the caller must close with
+// discardConn so the next request does not inherit the setup or whatever
+// USE or SET the query ran. Pooled connections would not keep them from
+// one statement to the next.
+func sessionQueryer(ctx context.Context, db *sql.DB, query, database string, vars map[string]any) (queryer, *sql.Conn, error) {
+	if database == "" && len(vars) == 0 && isReadOnlyQuery(query) {
+		return db, nil, nil
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := prepareConn(ctx, conn, database, vars); err != nil {
+		discardConn(conn)
+		return nil, nil, err
+	}
+	return conn, conn, nil
+}
+
+// prepareConn switches conn to database, unless it is "", and sets vars.
+func prepareConn(ctx context.Context, conn *sql.Conn, database string, vars map[string]any) error {
+	if database != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+quoteIdent(database)); err != nil {
+			return err
+		}
+	}
+	return applySessionVariables(ctx, conn, vars)
+}
+
+// applySessionVariables sets vars on conn.
+func applySessionVariables(ctx context.Context, conn *sql.Conn, vars map[string]any) error {
+	// Sorted, so the variables are applied in the same order every time
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		// name is one of sessionVariableNames, so it is safe to splice in
+		if _, err := conn.ExecContext(ctx, "SET SESSION "+name+" = ?", vars[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
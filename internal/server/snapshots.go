@@ -0,0 +1,237 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const snapshotsBucket = "snapshots"
+
+const (
+	snapshotDefaultTTL       = 24 * time.Hour
+	snapshotMaxTTL           = 30 * 24 * time.Hour
+	snapshotGCInterval       = 10 * time.Minute
+	snapshotKDFRounds        = 100000
+	snapshotPassphraseHeader = "X-Snapshot-Passphrase"
+	codePassphraseRequired   = "passphrase_required"
+)
+
+var (
+	errSnapshotNotFound = errors.New("snapshot not found")
+	errSnapshotTooLarge = errors.New("snapshot too large")
+	errWrongPassphrase  = errors.New("wrong passphrase")
+)
+
+// snapshotContent is the result a snapshot shares.
+type snapshotContent struct {
+	Query    string           `json:"query"`
+	Columns  []string         `json:"columns"`
+	Results  []map[string]any `json:"results"`
+	Metadata map[string]any   `json:"metadata,omitempty"`
+}
+
+// storedSnapshot is a snapshot as kept in the store. Data is the JSON of
+// its content, sealed with a key derived from the passphrase and Salt
+// when it has one.
+type storedSnapshot struct {
+	ID        string    `json:"id"`
+	Protected bool      `json:"protected"`
+	Salt      []byte    `json:"salt,omitempty"`
+	Data      []byte    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// snapshotInfo is what is returned about snap when it is created.
+func (s *Server) snapshotInfo(snap storedSnapshot) gin.H {
+	return gin.H{
+		"id":         snap.ID,
+		"url":        s.resultsURL("/snapshots/" + snap.ID),
+		"protected":  snap.Protected,
+		"created_at": snap.CreatedAt,
+		"expires_at": snap.ExpiresAt,
+	}
+}
+
+func snapshotKey(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, snapshotKDFRounds, 32, sha256.New)
+}
+
+// saveSnapshot stores content for ttl, sealed with passphrase unless it is
+// "". Content larger than cfg.SnapshotMaxBytes is refused.
+func (s *Server) saveSnapshot(content snapshotContent, ttl time.Duration, passphrase string) (storedSnapshot, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return storedSnapshot{}, err
+	}
+	if int64(len(data)) > s.cfg.SnapshotMaxBytes {
+		return storedSnapshot{}, errSnapshotTooLarge
+	}
+	now := time.Now().UTC()
+	snap := storedSnapshot{ID: newID() + newID(), Data: data, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	if passphrase != "" {
+		snap.Protected, snap.Salt = true, make([]byte, 16)
+		if _, err := rand.Read(snap.Salt); err != nil {
+			return storedSnapshot{}, err
+		}
+		gcm, err := keyCipher(snapshotKey(passphrase, snap.Salt))
+		if err != nil {
+			return storedSnapshot{}, err
+		}
+		if snap.Data, err = seal(gcm, data); err != nil {
+			return storedSnapshot{}, err
+		}
+	}
+	return snap, s.storePut(snapshotsBucket, snap.ID, snap)
+}
+
+// loadSnapshot returns the content of the snapshot id, opened with
+// passphrase when it is protected.
+func (s *Server) loadSnapshot(id, passphrase string) (storedSnapshot, snapshotContent, error) {
+	var snap storedSnapshot
+	var content snapshotContent
+	found, err := s.storeGet(snapshotsBucket, id, &snap)
+	if err != nil {
+		return snap, content, err
+	}
+	if !found || time.Now().After(snap.ExpiresAt) {
+		return snap, content, errSnapshotNotFound
+	}
+	data := snap.Data
+	if snap.Protected {
+		gcm, err := keyCipher(snapshotKey(passphrase, snap.Salt))
+		if err != nil {
+			return snap, content, err
+		}
+		if data, err = unseal(gcm, snap.Data); err != nil {
+			return snap, content, errWrongPassphrase
+		}
+	}
+	return snap, content, json.Unmarshal(data, &content)
+}
+
+// expireSnapshots deletes expired snapshots every snapshotGCInterval.
+func (s *Server) expireSnapshots() {
+	for range time.Tick(snapshotGCInterval) {
+		if s.store == nil {
+			continue
+		}
+		now := time.Now()
+		var expired []string
+		err := s.storeEach(snapshotsBucket, func(id string, data []byte) error {
+			var snap storedSnapshot
+			if err := json.Unmarshal(data, &snap); err != nil || now.After(snap.ExpiresAt) {
+				expired = append(expired, id)
+			}
+			return nil
+		})
+		if err == nil && len(expired) > 0 {
+			err = s.store.Update(func(tx *bolt.Tx) error {
+				b := tx.Bucket([]byte(snapshotsBucket))
+				for _, id := range expired {
+					if err := b.Delete([]byte(id)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to expire snapshots: %s", sanitizeError(err))
+		}
+	}
+}
+
+// snapshotTTL converts a requested ttlSeconds, 0 for the default.
+func snapshotTTL(seconds int) (time.Duration, error) {
+	if seconds == 0 {
+		return snapshotDefaultTTL, nil
+	}
+	ttl := time.Duration(seconds) * time.Second
+	if seconds < 0 || ttl > snapshotMaxTTL {
+		return 0, fmt.Errorf("ttlSeconds must be between 1 and %d", int(snapshotMaxTTL.Seconds()))
+	}
+	return ttl, nil
+}
+
+func (s *Server) respondSnapshotError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errSnapshotNotFound):
+		respondStatusError(c, http.StatusNotFound, err)
+	case errors.Is(err, errSnapshotTooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("The snapshot exceeds %d bytes", s.cfg.SnapshotMaxBytes))
+	case errors.Is(err, errWrongPassphrase):
+		respondError(c, http.StatusForbidden, codeForbidden, "The passphrase is wrong")
+	case errors.Is(err, errStoreClosed):
+		respondStatusError(c, http.StatusServiceUnavailable, err)
+	default:
+		respondStatusError(c, http.StatusInternalServerError, err)
+	}
+}
+
+type createSnapshotRequest struct {
+	snapshotContent
+	TTLSeconds int `json:"ttlSeconds"`
+	// Passphrase must then be sent to read the snapshot, in the
+	// X-Snapshot-Passphrase header
+	Passphrase string `json:"passphrase"`
+}
+
+// createSnapshot stores a result, such as an /execute-query response, so
+// it can be shared by link until it expires.
+func (s *Server) createSnapshot(c *gin.Context) {
+	var req createSnapshotRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Columns == nil || req.Results == nil {
+		respondBadRequest(c, "columns and results are required")
+		return
+	}
+	ttl, err := snapshotTTL(req.TTLSeconds)
+	if err != nil {
+		respondBadRequest(c, err.Error())
+		return
+	}
+	snap, err := s.saveSnapshot(req.snapshotContent, ttl, req.Passphrase)
+	if err != nil {
+		s.respondSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, s.snapshotInfo(snap))
+}
+
+// getSnapshot returns a snapshot's result. It needs no database
+// credentials, only the passphrase of a protected snapshot.
+func (s *Server) getSnapshot(c *gin.Context) {
+	passphrase := c.GetHeader(snapshotPassphraseHeader)
+	snap, content, err := s.loadSnapshot(c.Param("id"), passphrase)
+	if errors.Is(err, errWrongPassphrase) && passphrase == "" {
+		respondError(c, http.StatusUnauthorized, codePassphraseRequired, "The snapshot is protected; send its passphrase in the "+snapshotPassphraseHeader+" header")
+		return
+	}
+	if err != nil {
+		s.respondSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":         snap.ID,
+		"created_at": snap.CreatedAt,
+		"expires_at": snap.ExpiresAt,
+		"query":      content.Query,
+		"columns":    content.Columns,
+		"results":    content.Results,
+		"count":      len(content.Results),
+		"metadata":   content.Metadata,
+	})
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scriptMaxStatement caps a single statement of a script.
+const scriptMaxStatement = 16 << 20
+
+var errStatementTooLong = fmt.Errorf("statement longer than %d bytes", scriptMaxStatement)
+
+// scriptStatement is a statement of a script and the line it starts on.
+type scriptStatement struct {
+	text string
+	line int
+}
+
+// scriptSplitter splits a SQL script into statements as it is read, the way
+// the mysql client does: a statement ends at the delimiter outside quotes
+// and comments, and DELIMITER lines change the delimiter. Comments leading
+// a statement are dropped, except /*! */ and /*+ */, which MySQL executes.
+type scriptSplitter struct {
+	r         *bufio.Reader
+	delimiter string
+	line      int  // lines read so far
+	quote     byte // the open quote character, if any
+	comment   bool // inside /* */
+	stmt      strings.Builder
+	startLine int
+	content   bool // stmt holds more than whitespace and comments
+	pending   []scriptStatement
+}
+
+func newScriptSplitter(r io.Reader) *scriptSplitter {
+	return &scriptSplitter{r: bufio.NewReader(r), delimiter: ";"}
+}
+
+// next returns the next statement, or io.EOF after the last one.
+func (s *scriptSplitter) next() (scriptStatement, error) {
+	for len(s.pending) == 0 {
+		line, err := s.r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return scriptStatement{}, err
+		}
+		if line == "" {
+			// A final statement needs no delimiter
+			s.end()
+			if len(s.pending) == 0 {
+				return scriptStatement{}, io.EOF
+			}
+			break
+		}
+		s.line++
+		s.scanLine(line)
+		if s.stmt.Len() > scriptMaxStatement {
+			return scriptStatement{}, fmt.Errorf("line %d: %w", s.startLine, errStatementTooLong)
+		}
+	}
+	stmt := s.pending[0]
+	s.pending = s.pending[1:]
+	return stmt, nil
+}
+
+func (s *scriptSplitter) scanLine(line string) {
+	if s.quote == 0 && !s.comment && !s.content {
+		if delimiter, ok := delimiterCommand(line); ok {
+			s.delimiter = delimiter
+			return
+		}
+	}
+
+	for i := 0; i < len(line); {
+		ch := line[i]
+		switch {
+		case s.comment:
+			if strings.HasPrefix(line[i:], "*/") {
+				s.comment = false
+				s.write("*/")
+				i += 2
+				continue
+			}
+			s.write(line[i : i+1])
+			i++
+		case s.quote != 0:
+			n := 1
+			switch {
+			case ch == '\\' && s.quote != '`' && i+1 < len(line):
+				n = 2
+			case ch == s.quote && i+1 < len(line) && line[i+1] == ch:
+				n = 2
+			case ch == s.quote:
+				s.quote = 0
+			}
+			s.write(line[i : i+n])
+			i += n
+		case strings.HasPrefix(line[i:], s.delimiter):
+			s.end()
+			i += len(s.delimiter)
+		case ch == '\'' || ch == '"' || ch == '`':
+			s.begin()
+			s.quote = ch
+			s.write(line[i : i+1])
+			i++
+		case strings.HasPrefix(line[i:], "/*"):
+			if strings.HasPrefix(line[i:], "/*!") || strings.HasPrefix(line[i:], "/*+") {
+				s.begin()
+			}
+			s.comment = true
+			s.write("/*")
+			i += 2
+		case ch == '#' || isLineCommentStart(line, i):
+			s.write(line[i:])
+			i = len(line)
+		default:
+			if ch != ' ' && ch != '\t' && ch != '\r' && ch != '\n' {
+				s.begin()
+			}
+			s.write(line[i : i+1])
+			i++
+		}
+	}
+}
+
+// begin marks the start of a statement's text.
+func (s *scriptSplitter) begin() {
+	if !s.content {
+		s.content = true
+		s.startLine = s.line
+	}
+}
+
+// write adds text to the statement once it has begun.
+func (s *scriptSplitter) write(text string) {
+	if s.content {
+		s.stmt.WriteString(text)
+	}
+}
+
+// end finishes the current statement, skipping empty ones.
+func (s *scriptSplitter) end() {
+	if s.content {
+		s.pending = append(s.pending, scriptStatement{text: strings.TrimSpace(s.stmt.String()), line: s.startLine})
+	}
+	s.stmt.Reset()
+	s.content = false
+}
+
+// delimiterCommand parses a "DELIMITER $$" client command, which may
+// follow a comment on the same line.
+func delimiterCommand(line string) (string, bool) {
+	fields := strings.Fields(stripLeadingComments(line))
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+		return "", false
+	}
+	return fields[1], true
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScriptSplitterLeadingComments(t *testing.T) {
+	script := `-- setup
+/* create the table */
+CREATE TABLE t (a INT); -- trailing
+# seed it
+INSERT INTO t VALUES (1), (2);
+/*!40101 SET NAMES utf8mb4 */;
+/* ; inside a comment */ SELECT ';' FROM t;
+-- a comment with no statement after it
+`
+	splitter := newScriptSplitter(strings.NewReader(script))
+	var got []scriptStatement
+	for {
+		stmt, err := splitter.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmt.text = strings.TrimSpace(stmt.text)
+		got = append(got, stmt)
+	}
+	want := []scriptStatement{
+		{"CREATE TABLE t (a INT)", 3},
+		{"INSERT INTO t VALUES (1), (2)", 5},
+		{"/*!40101 SET NAMES utf8mb4 */", 6},
+		{"SELECT ';' FROM t", 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statements = %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type sqlTokenKind int
+
+const (
+	tokWhitespace  sqlTokenKind = iota
+	tokComment                  // -- and # line comments, /* */ block comments
+	tokString                   // '...' and "..." literals, with any introducer such as _utf8mb4 or X
+	tokQuotedIdent              // `...`
+	tokNumber                   // 42, 1.5e-3, 0x1F
+	tokWord                     // keywords, identifiers and @variables
+	tokSymbol                   // operators, punctuation and ? placeholders
+)
+
+// sqlToken is a lexical token of a MySQL statement. Text is the exact
+// source text, so joining every token reproduces the input byte for byte.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+func (t sqlToken) is(kind sqlTokenKind) bool { return t.kind == kind }
+
+// isWord reports whether t is the (case-insensitive) keyword word.
+func (t sqlToken) isWord(word string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+func (t sqlToken) isSymbol(symbol string) bool {
+	return t.kind == tokSymbol && t.text == symbol
+}
+
+// significant reports whether t is neither whitespace nor a comment.
+func (t sqlToken) significant() bool {
+	return t.kind != tokWhitespace && t.kind != tokComment
+}
+
+var errUnterminatedQuote = errors.New("unterminated quoted string or identifier")
+
+var errUnterminatedComment = errors.New("unterminated comment")
+
+// multiCharSymbols are the operators lexed as one token, longest first.
+var multiCharSymbols = []string{"<=>", "->>", "<=", ">=", "<>", "!=", ":=", "||", "&&", "<<", ">>", "->"}
+
+// tokenizeSQL splits s into tokens using MySQL's lexical rules. It fails
+// only on unterminated quotes and comments.
+func tokenizeSQL(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(s); {
+		start := i
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, sqlToken{tokWhitespace, s[start:i]})
+
+		case r == '#' || isLineCommentStart(s, i):
+			end := strings.IndexByte(s[i:], '\n')
+			if end == -1 {
+				i = len(s)
+			} else {
+				i += end
+			}
+			tokens = append(tokens, sqlToken{tokComment, s[start:i]})
+
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end == -1 {
+				return nil, errUnterminatedComment
+			}
+			i += 2 + end + 2
+			tokens = append(tokens, sqlToken{tokComment, s[start:i]})
+
+		case r == '\'' || r == '"':
+			end, err := scanQuoted(s, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, sqlToken{tokString, s[start:i]})
+
+		case r == '`':
+			end, err := scanQuoted(s, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, sqlToken{tokQuotedIdent, s[start:i]})
+
+		case isDigit(r) || (r == '.' && i+1 < len(s) && isDigit(rune(s[i+1]))):
+			i = scanNumber(s, i)
+			tokens = append(tokens, sqlToken{tokNumber, s[start:i]})
+
+		case isWordRune(r) || r == '@':
+			i += size
+			if r == '@' && i < len(s) && s[i] == '@' {
+				i++
+			}
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				// Variables may contain dots, as in @@session.sql_mode
+				if !isWordRune(r) && !(s[start] == '@' && r == '.') {
+					break
+				}
+				i += size
+			}
+			// A quote straight after a word is an introducer (_utf8mb4'x',
+			// X'0F', N'x') or a quoted variable name (@'x'); keep them
+			// together since a space would change the meaning.
+			if i < len(s) && (s[i] == '\'' || s[i] == '"' || s[i] == '`') && isIntroducer(s[start:i]) {
+				end, err := scanQuoted(s, i)
+				if err != nil {
+					return nil, err
+				}
+				i = end
+				tokens = append(tokens, sqlToken{tokString, s[start:i]})
+				continue
+			}
+			tokens = append(tokens, sqlToken{tokWord, s[start:i]})
+
+		default:
+			text := string(r)
+			for _, sym := range multiCharSymbols {
+				if strings.HasPrefix(s[i:], sym) {
+					text = sym
+					break
+				}
+			}
+			i += len(text)
+			tokens = append(tokens, sqlToken{tokSymbol, text})
+		}
+	}
+	return tokens, nil
+}
+
+// isLineCommentStart reports whether s[i:] starts a "-- " comment; MySQL
+// requires whitespace (or the end of input) after the two dashes.
+func isLineCommentStart(s string, i int) bool {
+	if !strings.HasPrefix(s[i:], "--") {
+		return false
+	}
+	if i+2 == len(s) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s[i+2:])
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+// scanQuoted returns the index just past the quoted run starting at
+// s[start]. The quote is escaped by doubling it or, except in backtick
+// identifiers, with a backslash.
+func scanQuoted(s string, start int) (int, error) {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, errUnterminatedQuote
+}
+
+func scanNumber(s string, i int) int {
+	if strings.HasPrefix(s[i:], "0x") || strings.HasPrefix(s[i:], "0b") {
+		i += 2
+	}
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == 'e' || c == 'E':
+			i++
+			if i < len(s) && (s[i] == '+' || s[i] == '-') {
+				i++
+			}
+		case isDigit(rune(c)) || c == '.' || isWordRune(rune(c)):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isIntroducer(word string) bool {
+	if strings.HasPrefix(word, "@") || strings.HasPrefix(word, "_") {
+		return true
+	}
+	switch strings.ToUpper(word) {
+	case "X", "B", "N":
+		return true
+	}
+	return false
+}
+
+func isDigit(r rune) bool { return r >= '0' && r <= '9' }
+
+// isWordRune reports whether r can appear in an unquoted identifier.
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || isDigit(r) || (r < utf8.RuneSelf && unicode.IsLetter(r)) || r >= 0x80
+}
+
+// significantTokens returns the tokens that are not whitespace or comments.
+func significantTokens(tokens []sqlToken) []sqlToken {
+	out := make([]sqlToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.significant() {
+			out = append(out, t)
+		}
+	}
+	return out
+}
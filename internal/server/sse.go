@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseProgressInterval and sseHeartbeatInterval are how often a stream
+// reports progress and sends a comment to keep proxies from closing it;
+// tests shorten them.
+var (
+	sseProgressInterval  = time.Second
+	sseHeartbeatInterval = 15 * time.Second
+)
+
+const (
+	// sseRowBatch is how many rows a row event of /execute-query/stream
+	// holds unless batch_size says otherwise, up to sseMaxRowBatch
+	sseRowBatch    = 500
+	sseMaxRowBatch = 10000
+	streamTokenTTL = time.Minute
+)
+
+// sseWriter writes server-sent events, serializing writers and flushing
+// after each event so it reaches the client straight away.
+type sseWriter struct {
+	mu        sync.Mutex
+	w         gin.ResponseWriter
+	requestID string
+}
+
+func newSSEWriter(c *gin.Context) *sseWriter {
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	return &sseWriter{w: c.Writer, requestID: requestID(c)}
+}
+
+func (s *sseWriter) event(name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// errorEvent ends the stream with body, tagged with the request ID.
+func (s *sseWriter) errorEvent(body apiError) {
+	body.RequestID = s.requestID
+	s.event("error", gin.H{"error": body})
+}
+
+// comment writes an SSE comment, which clients ignore.
+func (s *sseWriter) comment(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, ": %s\n\n", text)
+	s.w.Flush()
+}
+
+// executeQueryEvents is the server-sent events form of /execute-query. It
+// takes the same body and, once the query is accepted, reports progress
+// events with the rows read so far while the result is scanned, then a
+// result event with the usual JSON payload or an error event. Comments
+// every sseHeartbeatInterval keep idle proxies from closing the stream.
+func (s *Server) executeQueryEvents(c *gin.Context) {
+	var req queryRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Format != "" && req.Format != "json" {
+		respondBadRequest(c, "Event streams only return json results")
+		return
+	}
+	prepared, status, apiErr := s.prepareQuery(&req)
+	if apiErr != nil {
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+
+	s.runQueryEvents(c, req, prepared, 0)
+}
+
+// runQueryEvents runs prepared and reports it as events: progress with the
+// rows read so far while the result is scanned, heartbeat comments, and an
+// error event on failure. With a batch of 0 the rows come in one result
+// event at the end; otherwise a columns event is followed by row events of
+// up to batch rows as they are read, and a done event. The query stops
+// when the client goes away.
+func (s *Server) runQueryEvents(c *gin.Context, req queryRequest, prepared preparedQuery, batch int) {
+	// Before the stream starts, so a full server is an HTTP 429
+	releaseSlot, _, err := s.queryLimits.acquire(c.Request.Context(), sessionID(c), req.queue())
+	if err != nil {
+		s.respondQueryLimitError(c, err)
+		return
+	}
+	defer releaseSlot()
+
+	events := newSSEWriter(c)
+	start := time.Now()
+	var count atomic.Int64
+	ctx, cancel := prepared.withTimeout(c.Request.Context())
+	var ticking sync.WaitGroup
+	ticking.Add(1)
+	go func() {
+		defer ticking.Done()
+		sseTicker(ctx, events, &count, start)
+	}()
+	// stop cancels the query and waits for the ticker, which must not
+	// write once the handler has returned and gin has reused c
+	stop := func() {
+		cancel()
+		ticking.Wait()
+	}
+	defer stop()
+
+	outcome := "error"
+	defer func() {
+		s.recordQuery(c.Request.Context(), sessionID(c), prepared.creds, historyEntry{
+			Query:      req.Query,
+			Database:   prepared.useDatabase,
+			DurationMs: time.Since(start).Milliseconds(),
+			RowCount:   int(count.Load()),
+			Status:     outcome,
+			ExecutedAt: start.UTC(),
+		})
+	}()
+
+	db, err := s.connectToDatabase(prepared.creds)
+	if err != nil {
+		_, body := classifyConnectionError(err)
+		events.errorEvent(body)
+		return
+	}
+	q, conn, err := sessionQueryer(ctx, db, prepared.query, prepared.useDatabase, prepared.sessionVariables)
+	if err != nil {
+		_, body := classifyDBError(err)
+		events.errorEvent(body)
+		return
+	}
+	if conn != nil {
+		defer discardConn(conn)
+	}
+
+	defer s.trackRunningQuery(c, cancel)()
+	prepared.scan = resolveBoolColumns(ctx, q, prepared.query, prepared.scan)
+	rows, err := s.queryWithRetry(ctx, q, prepared.query, prepared.args...)
+	if err != nil {
+		_, body := classifyDBError(err)
+		events.errorEvent(body)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		_, body := classifyDBError(err)
+		events.errorEvent(body)
+		return
+	}
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, prepared.scan)
+	if batch > 0 {
+		events.event("columns", gin.H{"columns": scanner.columns})
+	}
+	results := []map[string]any{}
+	for rows.Next() {
+		touchRunningQuery(c)
+		row, err := scanner.scan(rows)
+		if err != nil {
+			_, body := classifyDBError(err)
+			events.errorEvent(body)
+			return
+		}
+		results = append(results, row)
+		count.Add(1)
+		if batch > 0 && len(results) == batch {
+			if events.event("row", gin.H{"rows": results}) != nil {
+				return
+			}
+			results = []map[string]any{}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		_, body := classifyDBError(err)
+		events.errorEvent(body)
+		return
+	}
+
+	// Stop the ticker first so no progress event follows the result
+	stop()
+	outcome = "success"
+	if batch == 0 {
+		events.event("result", gin.H{"columns": scanner.columns, "results": results, "count": len(results)})
+		return
+	}
+	if len(results) > 0 {
+		events.event("row", gin.H{"rows": results})
+	}
+	events.event("done", gin.H{"count": count.Load(), "durationMs": time.Since(start).Milliseconds()})
+}
+
+// sseTicker sends progress events and heartbeat comments until ctx is done.
+func sseTicker(ctx context.Context, events *sseWriter, count *atomic.Int64, start time.Time) {
+	progress := time.NewTicker(sseProgressInterval)
+	defer progress.Stop()
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-progress.C:
+			events.event("progress", gin.H{"count": count.Load(), "elapsed_ms": time.Since(start).Milliseconds()})
+		case <-heartbeat.C:
+			events.comment("heartbeat")
+		}
+	}
+}
+
+// streamToken is a query posted to /execute-query/stream, waiting for the
+// session's GET to run it.
+type streamToken struct {
+	session  string
+	req      queryRequest
+	prepared preparedQuery
+	expires  time.Time
+}
+
+// streamTokenStore holds the posted queries until they are streamed, for
+// queries that do not fit a URL or need credentials, which must never be
+// put in one. A token is used once.
+type streamTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]streamToken
+}
+
+// createStreamToken takes an /execute-query body and returns the token
+// EventSource clients, which can only GET, pass to /execute-query/stream.
+func (s *Server) createStreamToken(c *gin.Context) {
+	var req queryRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Format != "" && req.Format != "json" {
+		respondBadRequest(c, "Event streams only return json results")
+		return
+	}
+	prepared, status, apiErr := s.prepareQuery(&req)
+	if apiErr != nil {
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+
+	token := newID() + newID()
+	now := time.Now()
+	expires := now.Add(streamTokenTTL)
+	s.streamTokens.mu.Lock()
+	for id, t := range s.streamTokens.tokens {
+		if now.After(t.expires) {
+			delete(s.streamTokens.tokens, id)
+		}
+	}
+	s.streamTokens.tokens[token] = streamToken{session: sessionID(c), req: req, prepared: prepared, expires: expires}
+	s.streamTokens.mu.Unlock()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"expires_at": expires.UTC(),
+		"stream_url": s.resultsURL("/execute-query/stream?token=" + token),
+	})
+}
+
+// streamQuery streams a query's rows as server-sent events, for exports
+// too big to hold in one response: a columns event, row events of up to
+// batch_size rows as they are read, progress events, and a done event with
+// the count. The query is a token from POST /execute-query/stream, or the
+// query parameter with the connection or profileId parameters or the
+// default credentials. A query parameter must be read-only, as any page
+// can make a browser GET a URL with the user's cookies. Closing the stream
+// cancels the query.
+func (s *Server) streamQuery(c *gin.Context) {
+	batch := sseRowBatch
+	if v := c.Query("batch_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > sseMaxRowBatch {
+			respondBadRequest(c, fmt.Sprintf("batch_size must be between 1 and %d", sseMaxRowBatch))
+			return
+		}
+		batch = n
+	}
+
+	if token := c.Query("token"); token != "" {
+		s.streamTokens.mu.Lock()
+		t, ok := s.streamTokens.tokens[token]
+		if ok && t.session == sessionID(c) {
+			delete(s.streamTokens.tokens, token)
+		}
+		s.streamTokens.mu.Unlock()
+		if !ok || t.session != sessionID(c) || time.Now().After(t.expires) {
+			respondError(c, http.StatusNotFound, codeNotFound, "Unknown or expired stream token")
+			return
+		}
+		s.runQueryEvents(c, t.req, t.prepared, batch)
+		return
+	}
+
+	req := queryRequest{
+		connectionRef: connectionRef{Connection: c.Query("connection"), ProfileID: c.Query("profileId")},
+		Query:         c.Query("query"),
+	}
+	prepared, status, apiErr := s.prepareQuery(&req)
+	if apiErr != nil {
+		respondAPIError(c, status, *apiErr)
+		return
+	}
+	if !isReadOnlyQuery(prepared.query) {
+		respondError(c, http.StatusForbidden, codeReadOnly, "Only read-only statements can be streamed from a query parameter; POST the query to /execute-query/stream for a token")
+		return
+	}
+	s.runQueryEvents(c, req, prepared, batch)
+}
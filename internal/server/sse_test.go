@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStreamQueryParameterIsReadOnly(t *testing.T) {
+	s := newTestServer(func(c *config) {
+		c.DefaultCredentials = &dbCredentials{Username: "app", Host: "db.invalid", Port: "3306"}
+	})
+	r := s.Handler()
+	for _, query := range []string{"DELETE FROM t", "UPDATE t SET a = 1", "DROP TABLE t"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/execute-query/stream?query="+url.QueryEscape(query), nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET stream of %q = %d, want 403", query, w.Code)
+		}
+	}
+}
+
+func TestQueryEventsTickerStopsWithHandler(t *testing.T) {
+	saved := sseProgressInterval
+	sseProgressInterval = time.Millisecond
+	t.Cleanup(func() { sseProgressInterval = saved })
+	s := newTestServer()
+	mock := withMockDB(t, s)
+	mock.ExpectQuery("SELECT a FROM t").
+		WillDelayFor(30 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+
+	body := `{"credentials":{"username":"app","host":"db","port":"3306"},"query":"SELECT a FROM t"}`
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/execute-query/events", strings.NewReader(body)))
+
+	// With the race detector, a ticker still running writes concurrently
+	// with this read
+	sent := w.Body.String()
+	time.Sleep(10 * time.Millisecond)
+	if w.Body.String() != sent {
+		t.Error("events written after the handler returned")
+	}
+	if !strings.Contains(sent, "event: progress") {
+		t.Error("no progress event while the query ran")
+	}
+	if !strings.HasSuffix(sent, "\n\n") || !strings.Contains(sent[strings.LastIndex(sent, "event:"):], "event: result") {
+		t.Errorf("stream does not end with the result:\n%s", sent)
+	}
+}
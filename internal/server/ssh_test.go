@@ -0,0 +1,19 @@
+package server
+
+import "testing"
+
+func TestSSHClientConfigRequiresHostKey(t *testing.T) {
+	creds := sshCredentials{Host: "jump", User: "app", Password: "secret"}
+	if _, err := creds.clientConfig(); err == nil {
+		t.Error("tunnel without a host key accepted")
+	}
+	creds.InsecureSkipHostKey = true
+	if _, err := creds.clientConfig(); err != nil {
+		t.Errorf("insecure_skip_host_key: %v", err)
+	}
+	creds.InsecureSkipHostKey = false
+	creds.HostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	if _, err := creds.clientConfig(); err != nil {
+		t.Errorf("pinned host key: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticAsset is an embedded file with its ETag, a hash of its content, so
+// it changes exactly when a build changes the file.
+type staticAsset struct {
+	content []byte
+	etag    string
+}
+
+func (s *Server) loadEmbeddedAsset(name string) (staticAsset, error) {
+	content, err := fs.ReadFile(s.assets, name)
+	if err != nil {
+		return staticAsset{}, err
+	}
+	sum := sha256.Sum256(content)
+	return staticAsset{content: content, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}, nil
+}
+
+// serveAsset serves name, from cfg.StaticDir when set, for working on the
+// UI without rebuilding, and from the binary otherwise. Embedded files are
+// revalidated with their ETag; files from disk are never cached.
+func (s *Server) serveAsset(name string) gin.HandlerFunc {
+	if s.cfg.StaticDir != "" {
+		return func(c *gin.Context) {
+			f, err := os.Open(filepath.Join(s.cfg.StaticDir, name))
+			if err != nil {
+				respondStatusError(c, http.StatusNotFound, err)
+				return
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				respondStatusError(c, http.StatusInternalServerError, err)
+				return
+			}
+			c.Header("Cache-Control", "no-store")
+			http.ServeContent(c.Writer, c.Request, name, info.ModTime(), f)
+		}
+	}
+
+	asset, err := s.loadEmbeddedAsset(name)
+	return func(c *gin.Context) {
+		if err != nil {
+			respondStatusError(c, http.StatusNotFound, err)
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Header("ETag", asset.etag)
+		// Embedded files have no modification time; the ETag stands in
+		http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(asset.content))
+	}
+}
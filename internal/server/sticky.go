@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errNoStickySession = errors.New("the session has no sticky connection")
+
+// stickySession is a session pinned to one connection by a sticky login,
+// so temporary tables, user variables and LAST_INSERT_ID() carry over from
+// one /execute-query call to the next. Queries on it run one at a time.
+type stickySession struct {
+	creds dbCredentials
+	db    *sql.DB
+	conn  *sql.Conn
+
+	// mu is held while a query runs on conn
+	mu     sync.Mutex
+	closed bool
+
+	resource *idleResource
+	idle     *idleReaper
+}
+
+// close releases s and stops tracking it.
+func (s *stickySession) close() {
+	s.idle.untrack(s.resource)
+	s.mu.Lock()
+	s.release()
+	s.mu.Unlock()
+}
+
+// release closes the connection, rather than returning it to the pool
+// with the session's temporary tables and variables; s.mu must be held.
+func (s *stickySession) release() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	discardConn(s.conn)
+}
+
+type stickyManager struct {
+	srv      *Server
+	mu       sync.Mutex
+	sessions map[string]*stickySession
+}
+
+// open pins session to a new connection to creds, replacing the one it
+// had.
+func (m *stickyManager) open(ctx context.Context, session string, creds dbCredentials) error {
+	db, err := m.srv.connectToDatabase(creds)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	s := &stickySession{creds: creds, db: db, conn: conn, idle: m.srv.idleResources}
+	s.resource = s.idle.track("sticky connection", session, m.srv.cfg.StickyIdleTimeout, func() bool {
+		// A connection busy with a query is not idle
+		if !s.mu.TryLock() {
+			return false
+		}
+		defer s.mu.Unlock()
+		m.mu.Lock()
+		if m.sessions[session] == s {
+			delete(m.sessions, session)
+		}
+		m.mu.Unlock()
+		s.release()
+		return true
+	})
+
+	m.mu.Lock()
+	old := m.sessions[session]
+	m.sessions[session] = s
+	m.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// pin returns session's sticky connection, locked, when it was opened with
+// creds, or nil when queries should get a connection of their own.
+func (m *stickyManager) pin(session string, creds dbCredentials) *stickySession {
+	m.mu.Lock()
+	s, ok := m.sessions[session]
+	m.mu.Unlock()
+	if !ok || !sameCredentials(s.creds, creds) {
+		return nil
+	}
+	s.resource.touch()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	return s
+}
+
+// unpin unlocks s after a query. A cancelled query makes the driver close
+// the connection, so a closed one is dropped rather than handed out again.
+func (m *stickyManager) unpin(session string, s *stickySession) {
+	broken := s.conn.Raw(func(dc any) error {
+		if v, ok := dc.(driver.Validator); ok && !v.IsValid() {
+			return driver.ErrBadConn
+		}
+		return nil
+	}) != nil
+	s.mu.Unlock()
+	if !broken {
+		return
+	}
+	m.mu.Lock()
+	current := m.sessions[session] == s
+	if current {
+		delete(m.sessions, session)
+	}
+	m.mu.Unlock()
+	if current {
+		s.close()
+	}
+}
+
+// has reports whether session has a sticky connection.
+func (m *stickyManager) has(session string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.sessions[session]
+	return ok
+}
+
+// close ends session's sticky connection, if it has one.
+func (m *stickyManager) close(session string) {
+	m.mu.Lock()
+	s, ok := m.sessions[session]
+	delete(m.sessions, session)
+	m.mu.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+// sameCredentials reports whether a and b connect the same way; SSH
+// settings are compared by value, since each request decodes its own.
+func sameCredentials(a, b dbCredentials) bool {
+	sshA, sshB := a.SSH, b.SSH
+	a.SSH, b.SSH = nil, nil
+	if a != b || (sshA == nil) != (sshB == nil) {
+		return false
+	}
+	return sshA == nil || *sshA == *sshB
+}
+
+// keepAlive pings the session's sticky connection, which also counts as
+// use and so holds off the idle timeout.
+func (s *Server) keepAlive(c *gin.Context) {
+	session := sessionID(c)
+	s.stickySessions.mu.Lock()
+	sess, ok := s.stickySessions.sessions[session]
+	s.stickySessions.mu.Unlock()
+	if !ok {
+		respondStatusError(c, http.StatusNotFound, errNoStickySession)
+		return
+	}
+
+	sess = s.stickySessions.pin(session, sess.creds)
+	if sess == nil {
+		respondStatusError(c, http.StatusNotFound, errNoStickySession)
+		return
+	}
+	err := sess.conn.PingContext(c.Request.Context())
+	sess.mu.Unlock()
+	if err != nil {
+		// The connection is gone, and its temporary state with it
+		s.stickySessions.close(session)
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"idle_timeout_seconds": int(s.cfg.StickyIdleTimeout.Seconds())})
+}
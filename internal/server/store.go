@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const profilesBucket = "profiles"
+
+// storeBuckets are created when the store is opened.
+var storeBuckets = []string{profilesBucket, historyBucket, savedQueriesBucket, schedulesBucket, scheduleRunsBucket, webhookDeliveriesBucket, snapshotsBucket}
+
+var errStoreClosed = errors.New("local store is not open")
+
+func (s *Server) openStore(path string) error {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range storeBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	s.store = db
+	return nil
+}
+
+// newID returns a random identifier for stored records.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// storePut saves v as JSON under id in bucket.
+func (s *Server) storePut(bucket, id string, v any) error {
+	if s.store == nil {
+		return errStoreClosed
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(id), data)
+	})
+}
+
+// storeGet loads the record id from bucket into v, reporting whether it
+// exists.
+func (s *Server) storeGet(bucket, id string, v any) (bool, error) {
+	if s.store == nil {
+		return false, errStoreClosed
+	}
+	var data []byte
+	err := s.store.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket([]byte(bucket)).Get([]byte(id)); raw != nil {
+			data = append([]byte(nil), raw...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// storeDelete removes id from bucket, reporting whether it existed.
+func (s *Server) storeDelete(bucket, id string) (bool, error) {
+	if s.store == nil {
+		return false, errStoreClosed
+	}
+	found := false
+	err := s.store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b.Get([]byte(id)) == nil {
+			return nil
+		}
+		found = true
+		return b.Delete([]byte(id))
+	})
+	return found, err
+}
+
+// storeEach calls fn with the JSON of every record in bucket, in key order.
+func (s *Server) storeEach(bucket string, fn func(id string, data []byte) error) error {
+	if s.store == nil {
+		return errStoreClosed
+	}
+	return s.store.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
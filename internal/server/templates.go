@@ -0,0 +1,288 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateVariableTypes are the types a saved query can declare for its
+// variables. Values are converted to the type before being bound.
+var templateVariableTypes = []string{"string", "integer", "number", "boolean", "date"}
+
+var templateVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templateVariable declares a {{name}} placeholder of a saved query, so
+// clients can render a form for it.
+type templateVariable struct {
+	Name string `json:"name"`
+	// Type is one of templateVariableTypes; it defaults to "string"
+	Type        string `json:"type"`
+	Default     any    `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (v *templateVariable) validate() error {
+	if !templateVariableName.MatchString(v.Name) {
+		return fmt.Errorf("invalid variable name %q", v.Name)
+	}
+	if v.Type == "" {
+		v.Type = "string"
+	}
+	if !slices.Contains(templateVariableTypes, v.Type) {
+		return fmt.Errorf("variable %s: type must be one of %s", v.Name, strings.Join(templateVariableTypes, ", "))
+	}
+	if v.Default != nil {
+		if _, err := convertVariable(v.Type, v.Default); err != nil {
+			return fmt.Errorf("variable %s: default %w", v.Name, err)
+		}
+	}
+	return nil
+}
+
+// templateError lists the problems with the variables passed for a
+// template.
+type templateError struct {
+	Missing []string
+	Unused  []string
+	Invalid []string
+}
+
+func (e *templateError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing variables: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unused) > 0 {
+		parts = append(parts, "unused variables: "+strings.Join(e.Unused, ", "))
+	}
+	parts = append(parts, e.Invalid...)
+	return strings.Join(parts, "; ")
+}
+
+// expandTemplate replaces each {{name}} placeholder in query with a ?
+// placeholder and returns the values to bind, in order. Values come from
+// values, falling back to the declared defaults; a declared type converts
+// the value. Placeholders inside string literals, quoted identifiers and
+// comments are left alone.
+func expandTemplate(query string, values map[string]any, decls []templateVariable) (string, []any, error) {
+	if len(values) == 0 && len(decls) == 0 && !strings.Contains(query, "{{") {
+		return query, nil, nil
+	}
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return "", nil, err
+	}
+	declared := map[string]templateVariable{}
+	for _, d := range decls {
+		declared[d.Name] = d
+	}
+
+	var out strings.Builder
+	var args []any
+	used := map[string]bool{}
+	tErr := &templateError{}
+	for i := 0; i < len(tokens); i++ {
+		name, end, ok := templatePlaceholder(tokens, i)
+		if !ok {
+			out.WriteString(tokens[i].text)
+			continue
+		}
+		out.WriteString("?")
+		i = end
+		used[name] = true
+
+		val, found := values[name]
+		if !found {
+			val, found = declared[name].Default, declared[name].Default != nil
+		}
+		if !found {
+			if !slices.Contains(tErr.Missing, name) {
+				tErr.Missing = append(tErr.Missing, name)
+			}
+			continue
+		}
+		val, err := convertVariable(declared[name].Type, val)
+		if err != nil {
+			tErr.Invalid = append(tErr.Invalid, fmt.Sprintf("variable %s %v", name, err))
+			continue
+		}
+		args = append(args, val)
+	}
+	for name := range values {
+		if !used[name] {
+			tErr.Unused = append(tErr.Unused, name)
+		}
+	}
+	sort.Strings(tErr.Unused)
+
+	if len(tErr.Missing) > 0 || len(tErr.Unused) > 0 || len(tErr.Invalid) > 0 {
+		return "", nil, tErr
+	}
+	return out.String(), args, nil
+}
+
+// templatePlaceholder reports whether tokens[i] starts a {{name}}
+// placeholder, allowing whitespace inside the braces, and returns the
+// variable name and the index of the closing brace.
+func templatePlaceholder(tokens []sqlToken, i int) (string, int, bool) {
+	want := []string{"{", "{", "", "}", "}"}
+	name := ""
+	for k, j := 0, i; j < len(tokens); j++ {
+		t := tokens[j]
+		if t.is(tokWhitespace) && k >= 2 && k <= 3 {
+			continue
+		}
+		switch {
+		case want[k] == "" && t.is(tokWord):
+			name = t.text
+		case want[k] != "" && t.isSymbol(want[k]):
+		default:
+			return "", 0, false
+		}
+		if k++; k == len(want) {
+			return name, j, true
+		}
+	}
+	return "", 0, false
+}
+
+// convertVariable converts a JSON value to the declared variable type. An
+// empty type accepts any scalar; whole numbers become integers so they
+// can be bound to LIMIT and the like.
+func convertVariable(typ string, val any) (any, error) {
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case []any, map[string]any:
+		return nil, fmt.Errorf("must be a scalar")
+	case float64:
+		if typ == "" && v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	}
+
+	switch typ {
+	case "", "string":
+		if _, ok := val.(string); !ok && typ == "string" {
+			return nil, fmt.Errorf("must be a string")
+		}
+		return val, nil
+	case "integer":
+		switch v := val.(type) {
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("must be an integer")
+	case "number":
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a number")
+	case "boolean":
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a boolean")
+	case "date":
+		if s, ok := val.(string); ok {
+			if _, err := time.Parse("2006-01-02", s); err == nil {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a date in YYYY-MM-DD form")
+	}
+	return nil, fmt.Errorf("has unknown type %s", typ)
+}
+
+// textPlaceholder matches the ${name} placeholders of a query template.
+var textPlaceholder = regexp.MustCompile(`\$\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}`)
+
+// substituteTemplate replaces each ${name} placeholder in template with the
+// text of variable name, for the identifiers that cannot be bound, such as
+// a schema per environment; {{name}} placeholders, which are bound, are the
+// place for values. So that no value can change the statement around it, a
+// value must be a number or a name, optionally qualified as in
+// schema.table, and a placeholder cannot sit in a string literal or a
+// comment. It returns the variables no ${name} used, for expandTemplate.
+func substituteTemplate(template string, values map[string]any) (string, map[string]any, error) {
+	tokens, err := tokenizeSQL(template)
+	if err != nil {
+		return "", nil, err
+	}
+	tErr := &templateError{}
+	for _, t := range tokens {
+		if (t.is(tokString) || t.is(tokComment)) && textPlaceholder.MatchString(t.text) {
+			name := textPlaceholder.FindStringSubmatch(t.text)[1]
+			tErr.Invalid = append(tErr.Invalid, fmt.Sprintf("variable %s cannot be substituted in a string literal or comment; bind it with {{%s}}", name, name))
+		}
+	}
+
+	used := map[string]bool{}
+	query := textPlaceholder.ReplaceAllStringFunc(template, func(m string) string {
+		name := textPlaceholder.FindStringSubmatch(m)[1]
+		val, found := values[name]
+		if !found {
+			if !slices.Contains(tErr.Missing, name) {
+				tErr.Missing = append(tErr.Missing, name)
+			}
+			return m
+		}
+		used[name] = true
+		switch v := val.(type) {
+		case string:
+			if !isQualifiedName(v) {
+				tErr.Invalid = append(tErr.Invalid, fmt.Sprintf("variable %s must be a name such as orders or shop.orders", name))
+				return m
+			}
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			tErr.Invalid = append(tErr.Invalid, fmt.Sprintf("variable %s must be a string or number", name))
+			return m
+		}
+	})
+	if len(tErr.Missing) > 0 || len(tErr.Invalid) > 0 {
+		return "", nil, tErr
+	}
+
+	rest := map[string]any{}
+	for name, val := range values {
+		if !used[name] {
+			rest[name] = val
+		}
+	}
+	return query, rest, nil
+}
+
+// isQualifiedName reports whether s is unquoted identifiers joined by dots,
+// which can neither close a quote nor add an operator or keyword.
+func isQualifiedName(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || strings.IndexFunc(part, func(r rune) bool { return !isWordRune(r) }) >= 0 {
+			return false
+		}
+	}
+	return true
+}
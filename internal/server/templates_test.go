@@ -0,0 +1,51 @@
+package server
+
+import "testing"
+
+func TestSubstituteTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]any
+		want     string // "" when the template is rejected
+	}{
+		{"identifier", "SELECT * FROM ${env}_orders", map[string]any{"env": "prod"}, "SELECT * FROM prod_orders"},
+		{"qualified name", "SELECT * FROM ${table}", map[string]any{"table": "shop.orders"}, "SELECT * FROM shop.orders"},
+		{"quoted identifier", "SELECT * FROM `${env}-orders`", map[string]any{"env": "prod"}, "SELECT * FROM `prod-orders`"},
+		{"number", "SELECT * FROM t LIMIT ${n}", map[string]any{"n": 10.0}, "SELECT * FROM t LIMIT 10"},
+		{"string breakout", "SELECT * FROM t WHERE a = '${v}'", map[string]any{"v": "x' OR 'a'='a"}, ""},
+		{"placeholder in a string", "SELECT * FROM t WHERE a = '${v}'", map[string]any{"v": "x"}, ""},
+		{"placeholder in a comment", "SELECT 1 /* ${v} */", map[string]any{"v": "x"}, ""},
+		{"trailing line comment", "SELECT * FROM ${t} WHERE tenant = 1", map[string]any{"t": "orders -- "}, ""},
+		{"trailing hash comment", "SELECT * FROM ${t} WHERE tenant = 1", map[string]any{"t": "orders#"}, ""},
+		{"predicate", "SELECT * FROM t WHERE ${col} = 1", map[string]any{"col": "1=1 OR a"}, ""},
+		{"union", "SELECT a FROM ${t}", map[string]any{"t": "t UNION SELECT password FROM users"}, ""},
+		{"backtick breakout", "SELECT * FROM `${t}`", map[string]any{"t": "x` UNION SELECT 1 `"}, ""},
+		{"empty", "SELECT * FROM ${t}", map[string]any{"t": ""}, ""},
+		{"missing", "SELECT * FROM ${t}", nil, ""},
+		{"not a scalar", "SELECT * FROM ${t}", map[string]any{"t": true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := substituteTemplate(tt.template, tt.values)
+			switch {
+			case tt.want == "" && err == nil:
+				t.Errorf("accepted, giving %q", got)
+			case tt.want != "" && err != nil:
+				t.Errorf("rejected: %v", err)
+			case got != tt.want && tt.want != "":
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteTemplateKeepsBoundVariables(t *testing.T) {
+	got, rest, err := substituteTemplate("SELECT * FROM ${t} WHERE id = {{id}}", map[string]any{"t": "orders", "id": 7.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "SELECT * FROM orders WHERE id = {{id}}" || len(rest) != 1 || rest["id"] != 7.0 {
+		t.Errorf("got %q with %v", got, rest)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// textTableFormats are the /execute-query formats rendered as plain text.
+var textTableFormats = map[string]bool{"markdown": true, "ascii": true}
+
+// cellCleaner keeps a cell on one line.
+var cellCleaner = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// writeTextTable renders rows as a GitHub markdown table or a mysql-style
+// ASCII table, with numeric columns right-aligned, cells cut at
+// cfg.TableCellWidth and a footer with the row count and duration.
+func (s *Server) writeTextTable(c *gin.Context, format string, rows *sql.Rows, columns []string, start time.Time) (int, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	numeric := make([]bool, len(columnTypes))
+	for i, ct := range columnTypes {
+		numeric[i] = numericTypes[strings.TrimPrefix(ct.DatabaseTypeName(), "UNSIGNED ")]
+	}
+
+	values := make([]any, len(columns))
+	valuePtrs := make([]any, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = s.textCell(format, col)
+	}
+	var cells [][]string
+	for rows.Next() {
+		touchRunningQuery(c)
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return len(cells), err
+		}
+		row := make([]string, len(columns))
+		for i, val := range values {
+			text := "NULL"
+			if v := convertValue(val); v != nil {
+				text = fmt.Sprint(v)
+			}
+			row[i] = s.textCell(format, text)
+		}
+		cells = append(cells, row)
+	}
+	if err := rows.Err(); err != nil {
+		return len(cells), err
+	}
+
+	widths := make([]int, len(columns))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+		for _, row := range cells {
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[i]))
+		}
+		if format == "markdown" {
+			// Room for the alignment marker
+			widths[i] = max(widths[i], 4)
+		}
+	}
+
+	var b strings.Builder
+	if format == "markdown" {
+		writeTableRow(&b, header, widths, nil)
+		b.WriteString("|")
+		for i, w := range widths {
+			if numeric[i] {
+				b.WriteString(" " + strings.Repeat("-", w-1) + ": |")
+			} else {
+				b.WriteString(" " + strings.Repeat("-", w) + " |")
+			}
+		}
+		b.WriteString("\n")
+		for _, row := range cells {
+			writeTableRow(&b, row, widths, numeric)
+		}
+		b.WriteString("\n")
+	} else {
+		writeTableRule(&b, widths)
+		writeTableRow(&b, header, widths, nil)
+		writeTableRule(&b, widths)
+		for _, row := range cells {
+			writeTableRow(&b, row, widths, numeric)
+		}
+		if len(cells) > 0 {
+			writeTableRule(&b, widths)
+		}
+	}
+	b.WriteString(rowCountFooter(len(cells), time.Since(start)))
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(b.String()))
+	return len(cells), nil
+}
+
+// textCell flattens cell to one line, escapes it for format and cuts it at
+// cfg.TableCellWidth with an ellipsis.
+func (s *Server) textCell(format, cell string) string {
+	cell = cellCleaner.Replace(cell)
+	if limit := s.cfg.TableCellWidth; utf8.RuneCountInString(cell) > limit {
+		cell = string([]rune(cell)[:limit-1]) + "…"
+	}
+	if format == "markdown" {
+		cell = strings.ReplaceAll(cell, "|", `\|`)
+	}
+	return cell
+}
+
+func writeTableRule(b *strings.Builder, widths []int) {
+	b.WriteString("+")
+	for _, w := range widths {
+		b.WriteString(strings.Repeat("-", w+2) + "+")
+	}
+	b.WriteString("\n")
+}
+
+// writeTableRow writes cells padded to widths, right-aligning the numeric
+// ones; numeric is nil for the header.
+func writeTableRow(b *strings.Builder, cells []string, widths []int, numeric []bool) {
+	b.WriteString("|")
+	for i, cell := range cells {
+		pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		if numeric != nil && numeric[i] {
+			b.WriteString(" " + pad + cell + " |")
+		} else {
+			b.WriteString(" " + cell + pad + " |")
+		}
+	}
+	b.WriteString("\n")
+}
+
+// rowCountFooter is the mysql client's "N rows in set (0.00 sec)" line.
+func rowCountFooter(count int, elapsed time.Duration) string {
+	if count == 0 {
+		return fmt.Sprintf("Empty set (%.2f sec)\n", elapsed.Seconds())
+	}
+	noun := "rows"
+	if count == 1 {
+		noun = "row"
+	}
+	return fmt.Sprintf("%d %s in set (%.2f sec)\n", count, noun, elapsed.Seconds())
+}
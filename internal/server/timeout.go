@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// queryTimeout is how long req's query may run: its timeout_seconds,
+// clamped to cfg.MaxQueryTimeout, or the maximum when it sets none. Zero
+// means no limit. capped reports whether the maximum decided it.
+func (s *Server) queryTimeout(req *queryRequest) (timeout time.Duration, capped bool, err error) {
+	if req.TimeoutSeconds < 0 {
+		return 0, false, errors.New("timeout_seconds cannot be negative")
+	}
+	timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	if max := s.cfg.MaxQueryTimeout; max > 0 && (timeout == 0 || timeout > max) {
+		return max, true, nil
+	}
+	return timeout, false, nil
+}
+
+// withTimeout derives the context the prepared query runs under from
+// parent. A query stopped by the server's maximum is logged, as the client
+// may have asked for longer.
+func (p preparedQuery) withTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if p.timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	ctx, cancel := context.WithTimeout(parent, p.timeout)
+	if p.timeoutCapped {
+		context.AfterFunc(ctx, func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				logContextf(ctx, "Cancelled a query on %s/%s at the maximum query timeout of %s", p.creds.Host, p.creds.Database, p.timeout)
+			}
+		})
+	}
+	return ctx, cancel
+}
+
+// withMaxTimeout is withTimeout for the statements, run with creds, of
+// handlers that take no timeout_seconds: the server's maximum still holds
+// them.
+func (s *Server) withMaxTimeout(parent context.Context, creds dbCredentials) (context.Context, context.CancelFunc) {
+	return preparedQuery{creds: creds, timeout: s.cfg.MaxQueryTimeout, timeoutCapped: true}.withTimeout(parent)
+}
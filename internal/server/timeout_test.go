@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMaxQueryTimeoutHoldsOtherHandlers(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		expect func(sqlmock.Sqlmock)
+	}{
+		{"diff", "/api/v1/diff", `{"left":{` + credentialsJSON + `},"right":{` + credentialsJSON + `},"query":"SELECT id FROM t","key":"id"}`, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT id FROM t").WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		}},
+		{"execute-batch", "/api/v1/execute-batch", `{` + credentialsJSON + `,"query":"DELETE FROM t WHERE id = ?","param_sets":[[1]]}`, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectPrepare("DELETE FROM t WHERE id = ?").ExpectExec().WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 1))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(func(c *config) { c.MaxQueryTimeout = 20 * time.Millisecond })
+			tt.expect(withMockDB(t, s))
+			start := time.Now()
+			w := postJSON(t, s, tt.path, tt.body)
+			if w.Code == http.StatusOK {
+				t.Errorf("status %d: %s", w.Code, w.Body)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("the statement ran for %s past the 20ms maximum", elapsed)
+			}
+		})
+	}
+}
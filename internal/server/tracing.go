@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Adarsh-Liju/boba/internal/server")
+
+// setupTracing exports traces over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, unless OTEL_SDK_DISABLED
+// is. The exporter reads the other OTEL_EXPORTER_OTLP_* variables, and the
+// provider OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG for sampling.
+// The returned func flushes the spans still buffered.
+func (s *Server) setupTracing(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return shutdown, nil
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return shutdown, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return shutdown, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("boba")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return shutdown, fmt.Errorf("failed to describe the trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	s.tracingEnabled = true
+	return provider.Shutdown, nil
+}
+
+// dbSpan is a span around a database step of a query; the zero dbSpan,
+// from startDBSpan with tracing off, records nothing.
+type dbSpan struct {
+	span trace.Span
+}
+
+// startDBSpan starts the span name, such as db.query, for a step of
+// running p. The statement is recorded as its fingerprint unless
+// cfg.TraceStatements is set, as literals may be sensitive.
+func (s *Server) startDBSpan(ctx context.Context, name string, p preparedQuery) (context.Context, dbSpan) {
+	if !s.tracingEnabled {
+		return ctx, dbSpan{}
+	}
+	database := p.creds.Database
+	if p.useDatabase != "" {
+		database = p.useDatabase
+	}
+	statement := p.query
+	if !s.cfg.TraceStatements {
+		statement = queryFingerprint(p.query)
+	}
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemMySQL,
+		semconv.DBNamespace(database),
+		semconv.DBOperationName(firstKeyword(p.query)),
+		semconv.DBQueryText(statement),
+	}
+	if p.creds.Socket == "" {
+		attrs = append(attrs, semconv.ServerAddress(p.creds.Host))
+		if port, err := strconv.Atoi(p.creds.Port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, dbSpan{span: span}
+}
+
+// end ends s with the outcome of err and, when rows is not negative, the
+// number of rows read.
+func (s dbSpan) end(rows int, err error) {
+	if s.span == nil {
+		return
+	}
+	if rows >= 0 {
+		s.span.SetAttributes(attribute.Int("db.response.rows", rows))
+	}
+	if err != nil {
+		s.span.SetAttributes(attribute.String("boba.outcome", "error"))
+		s.span.SetStatus(codes.Error, sanitizeError(err))
+	} else {
+		s.span.SetAttributes(attribute.String("boba.outcome", "success"))
+	}
+	s.span.End()
+}
+
+// queryFingerprint is query with comments dropped, whitespace collapsed and
+// every string and number literal replaced by ?, so queries that differ
+// only in their values share it. A query that does not tokenize is
+// reduced to its first keyword.
+func queryFingerprint(query string) string {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return firstKeyword(query)
+	}
+	tokens = significantTokens(tokens)
+	parts := make([]string, len(tokens))
+	for i, t := range tokens {
+		switch t.kind {
+		case tokString, tokNumber:
+			parts[i] = "?"
+		default:
+			parts[i] = t.text
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"mime/multipart"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadMaxFieldSize caps the form fields sent alongside an upload.
+const uploadMaxFieldSize = 64 << 10
+
+// readUpload reads a multipart/form-data upload, passing each form field
+// to set until it reaches the "file" part, which it returns unread so the
+// file can be streamed. The fields must therefore come before the file. It
+// writes the error response and returns false on failure.
+func readUpload(c *gin.Context, set func(name, value string) error) (*multipart.Part, bool) {
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		respondBadRequest(c, "Expected a multipart/form-data upload")
+		return nil, false
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			respondBadRequest(c, "No file was uploaded")
+			return nil, false
+		}
+		if err != nil {
+			respondBodyError(c, err)
+			return nil, false
+		}
+		if part.FormName() == "file" {
+			return part, true
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, uploadMaxFieldSize+1))
+		if err != nil {
+			respondBodyError(c, err)
+			return nil, false
+		}
+		if len(value) > uploadMaxFieldSize {
+			respondBadRequest(c, "Form field "+part.FormName()+" is too long")
+			return nil, false
+		}
+		if err := set(part.FormName(), string(value)); err != nil {
+			respondBadRequest(c, err.Error())
+			return nil, false
+		}
+	}
+}
+
+// setConnectionField applies the credentials, connection and profileId
+// form fields of an upload to ref, reporting whether name was one of them.
+func setConnectionField(ref *connectionRef, name, value string) (bool, error) {
+	switch name {
+	case "credentials":
+		return true, json.Unmarshal([]byte(value), &ref.Credentials)
+	case "connection":
+		ref.Connection = value
+	case "profileId":
+		ref.ProfileID = value
+	default:
+		return false, nil
+	}
+	return true, nil
+}
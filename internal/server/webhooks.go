@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// webhookDeliveriesBucket holds the delivery log, keyed like the history.
+const webhookDeliveriesBucket = "webhook_deliveries"
+
+const (
+	webhookAttempts      = 3
+	webhookTimeout       = 10 * time.Second
+	webhookDeliveryLimit = 1000
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of the body,
+	// keyed with the webhook's secret, as sha256=<hex>
+	webhookSignatureHeader = "X-Boba-Signature"
+)
+
+// webhookBackoff is the wait before each retry of a delivery.
+var webhookBackoff = [webhookAttempts - 1]time.Duration{time.Second, 5 * time.Second}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhook is where the outcome of an async query or a schedule run is
+// posted. The secret signs each delivery and is never returned.
+type webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+func (w *webhook) validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook url must be an http or https URL")
+	}
+	if w.Secret == "" {
+		return errors.New("webhook secret is required")
+	}
+	return nil
+}
+
+// redacted is w without its secret, for responses.
+func (w *webhook) redacted() *webhook {
+	if w == nil {
+		return nil
+	}
+	return &webhook{URL: w.URL}
+}
+
+// webhookEvent is the body posted to a webhook.
+type webhookEvent struct {
+	// Event is async_query.finished or schedule_run.finished
+	Event      string    `json:"event"`
+	JobID      string    `json:"jobId,omitempty"`
+	ScheduleID string    `json:"scheduleId,omitempty"`
+	RunID      uint64    `json:"runId,omitempty"`
+	Status     string    `json:"status"`
+	RowCount   int       `json:"row_count"`
+	DurationMs int64     `json:"duration_ms"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      *apiError `json:"error,omitempty"`
+	// ResultsURL is where the results are fetched, under cfg.PublicURL
+	ResultsURL string `json:"results_url"`
+}
+
+// webhookDelivery is a logged delivery of an event, with each attempt.
+type webhookDelivery struct {
+	ID  uint64 `json:"id"`
+	URL string `json:"url"`
+	// Session is the session whose async query the event is about, which
+	// alone may list it; "" for schedules
+	Session   string           `json:"session,omitempty"`
+	Status    string           `json:"status"`
+	Event     webhookEvent     `json:"event"`
+	Attempts  []webhookAttempt `json:"attempts"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+type webhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// resultsURL is the link to path, a route of the API.
+func (s *Server) resultsURL(path string) string {
+	return s.cfg.PublicURL + s.cfg.BasePath + apiV1Path + path
+}
+
+// notifyWebhook posts event to w in the background, so a slow receiver
+// never holds up the query that finished. A delivery is attempted up to
+// webhookAttempts times, until the receiver answers with a 2xx status.
+func (s *Server) notifyWebhook(w *webhook, session string, event webhookEvent) {
+	if w == nil {
+		return
+	}
+	go func() {
+		d := &webhookDelivery{URL: w.URL, Session: session, Status: deliveryPending, Event: event, Attempts: []webhookAttempt{}, CreatedAt: time.Now().UTC()}
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to encode webhook event: %v", err)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+		s.logDelivery(d)
+		for i := 0; ; i++ {
+			attempt := postWebhook(w.URL, body, signature)
+			d.Attempts = append(d.Attempts, attempt)
+			if attempt.Error == "" {
+				d.Status = deliveryDelivered
+				break
+			}
+			if i == webhookAttempts-1 {
+				d.Status = deliveryFailed
+				break
+			}
+			s.logDelivery(d)
+			time.Sleep(webhookBackoff[i])
+		}
+		s.logDelivery(d)
+	}()
+}
+
+// postWebhook makes one delivery attempt, timed until the receiver's
+// answer has been read.
+func postWebhook(target string, body []byte, signature string) (attempt webhookAttempt) {
+	start := time.Now()
+	attempt.At = start.UTC()
+	defer func() { attempt.DurationMs = time.Since(start).Milliseconds() }()
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "boba-webhook")
+	req.Header.Set(webhookSignatureHeader, signature)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = "the receiver answered " + resp.Status
+	}
+	return attempt
+}
+
+// logDelivery stores d, as a new entry the first time, keeping the last
+// webhookDeliveryLimit deliveries. Failures are only logged, as the log
+// must never stop a delivery.
+func (s *Server) logDelivery(d *webhookDelivery) {
+	if s.store == nil {
+		return
+	}
+	err := s.store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookDeliveriesBucket))
+		if d.ID == 0 {
+			var err error
+			if d.ID, err = b.NextSequence(); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(historyKey(d.ID), data); err != nil {
+			return err
+		}
+		return trimOldest(b, webhookDeliveryLimit)
+	})
+	if err != nil {
+		log.Printf("Failed to log webhook delivery: %s", sanitizeError(err))
+	}
+}
+
+// listWebhookDeliveries returns the deliveries newest first: those of the
+// session's async queries and of schedules, optionally only those about
+// jobId or scheduleId, up to limit.
+func (s *Server) listWebhookDeliveries(c *gin.Context) {
+	if s.store == nil {
+		respondStatusError(c, http.StatusServiceUnavailable, errStoreClosed)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > webhookDeliveryLimit {
+		respondBadRequest(c, fmt.Sprintf("limit must be between 1 and %d", webhookDeliveryLimit))
+		return
+	}
+	session, jobID, scheduleID := sessionID(c), c.Query("jobId"), c.Query("scheduleId")
+
+	deliveries := []webhookDelivery{}
+	err = s.store.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(webhookDeliveriesBucket)).Cursor()
+		for k, v := cursor.Last(); k != nil && len(deliveries) < limit; k, v = cursor.Prev() {
+			var d webhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.Session != "" && d.Session != session ||
+				jobID != "" && d.Event.JobID != jobID ||
+				scheduleID != "" && d.Event.ScheduleID != scheduleID {
+				continue
+			}
+			d.Session = ""
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	if err != nil {
+		respondStatusError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
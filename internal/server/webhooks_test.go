@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostWebhookTimesTheAttempt(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer receiver.Close()
+
+	attempt := postWebhook(receiver.URL, []byte(`{}`), "sha256=")
+	if attempt.Error != "" {
+		t.Fatal(attempt.Error)
+	}
+	if attempt.DurationMs < 50 {
+		t.Errorf("duration_ms = %d for a receiver that took 50ms", attempt.DurationMs)
+	}
+}
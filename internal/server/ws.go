@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsBatchSize         = 500
+	wsProgressInterval  = time.Second
+	wsHeartbeatInterval = 15 * time.Second
+	wsWriteTimeout      = 10 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsRequest is a message sent by the client over /ws. Type is either
+// "query" or "cancel".
+type wsRequest struct {
+	connectionRef
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+// wsConn serializes writes to a websocket connection, which only supports
+// a single concurrent writer.
+type wsConn struct {
+	srv  *Server
+	conn *websocket.Conn
+	mu   sync.Mutex
+	// session is the session of the upgraded request, whose query slots
+	// the socket's queries take
+	session string
+}
+
+func (ws *wsConn) send(msg gin.H) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return ws.conn.WriteJSON(msg)
+}
+
+func (ws *wsConn) sendError(body apiError) error {
+	return ws.send(gin.H{"type": "error", "error": body})
+}
+
+func (ws *wsConn) sendDBError(err error) error {
+	_, body := classifyDBError(err)
+	return ws.sendError(body)
+}
+
+// acquireSlot takes a query slot for the socket's session, sending an
+// error message when there is none.
+func (ws *wsConn) acquireSlot(ctx context.Context, wait bool) (release func(), ok bool) {
+	release, _, err := ws.srv.queryLimits.acquire(ctx, ws.session, wait)
+	if err != nil {
+		_, body := ws.srv.queryLimitError(err)
+		ws.sendError(body)
+		return nil, false
+	}
+	return release, true
+}
+
+func (ws *wsConn) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(wsHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ws.send(gin.H{"type": "heartbeat"}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleWebSocket upgrades the request and executes queries sent by the
+// client, streaming the results back in batches. Only one query runs at a
+// time per connection; a "cancel" message aborts the running query.
+func (s *Server) handleWebSocket(c *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	ws := &wsConn{srv: s, conn: conn, session: sessionID(c)}
+	ctx, cancelAll := context.WithCancel(context.Background())
+	defer cancelAll()
+
+	go ws.heartbeat(ctx)
+
+	var (
+		mu     sync.Mutex
+		cancel context.CancelFunc
+	)
+	for {
+		var msg wsRequest
+		if err := conn.ReadJSON(&msg); err != nil {
+			// The client went away; cancelAll stops any running query
+			return
+		}
+
+		switch msg.Type {
+		case "query":
+			if msg.Query == "" {
+				ws.sendError(apiError{Code: codeBadRequest, Message: "Query cannot be empty"})
+				continue
+			}
+
+			mu.Lock()
+			if cancel != nil {
+				mu.Unlock()
+				ws.sendError(apiError{Code: codeBadRequest, Message: "A query is already running"})
+				continue
+			}
+			queryCtx, queryCancel := context.WithCancel(ctx)
+			cancel = queryCancel
+			mu.Unlock()
+
+			go func() {
+				ws.runQuery(queryCtx, msg)
+				mu.Lock()
+				queryCancel()
+				cancel = nil
+				mu.Unlock()
+			}()
+		case "cancel":
+			mu.Lock()
+			if cancel != nil {
+				cancel()
+			}
+			mu.Unlock()
+		default:
+			ws.sendError(apiError{Code: codeBadRequest, Message: "Unknown message type: " + msg.Type})
+		}
+	}
+}
+
+// runQuery executes a /ws query message with progress updates.
+func (ws *wsConn) runQuery(ctx context.Context, msg wsRequest) {
+	req := queryRequest{connectionRef: msg.connectionRef, Query: msg.Query}
+	prepared, _, apiErr := ws.srv.prepareQuery(&req)
+	if apiErr != nil {
+		ws.sendError(*apiErr)
+		return
+	}
+	release, ok := ws.acquireSlot(ctx, true)
+	if !ok {
+		return
+	}
+	defer release()
+	ws.stream(ctx, req.Query, prepared, true)
+}
+
+// stream runs prepared, the query the client sent, and sends its columns
+// and row batches to the client, optionally with progress updates,
+// finishing with a done, cancelled or error message.
+func (ws *wsConn) stream(ctx context.Context, query string, prepared preparedQuery, progress bool) {
+	ctx, cancel := prepared.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	count := 0
+	outcome := "error"
+	defer func() {
+		ws.srv.recordQuery(ctx, ws.session, prepared.creds, historyEntry{
+			Query:      query,
+			Database:   prepared.useDatabase,
+			DurationMs: time.Since(start).Milliseconds(),
+			RowCount:   count,
+			Status:     outcome,
+			ExecutedAt: start.UTC(),
+		})
+	}()
+	db, err := ws.srv.connectToDatabase(prepared.creds)
+	if err != nil {
+		_, body := classifyConnectionError(err)
+		ws.sendError(body)
+		return
+	}
+	q, conn, err := sessionQueryer(ctx, db, prepared.query, prepared.useDatabase, prepared.sessionVariables)
+	if err != nil {
+		ws.sendDBError(err)
+		return
+	}
+	if conn != nil {
+		defer discardConn(conn)
+	}
+
+	prepared.scan = resolveBoolColumns(ctx, q, prepared.query, prepared.scan)
+	rows, err := ws.srv.queryWithRetry(ctx, q, prepared.query, prepared.args...)
+	if err != nil {
+		ws.sendQueryError(ctx, err, 0, start)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		ws.sendDBError(err)
+		return
+	}
+	if err := ws.send(gin.H{"type": "columns", "columns": columns}); err != nil {
+		return
+	}
+
+	scanner := newRowScanner(columns)
+	scanner.useColumnTypes(rows, prepared.scan)
+	batch := make([]map[string]any, 0, wsBatchSize)
+	lastProgress := start
+	for rows.Next() {
+		row, err := scanner.scan(rows)
+		if err != nil {
+			ws.sendDBError(err)
+			return
+		}
+		batch = append(batch, row)
+		count++
+
+		if len(batch) == wsBatchSize {
+			if err := ws.send(gin.H{"type": "rows", "rows": batch}); err != nil {
+				return
+			}
+			batch = make([]map[string]any, 0, wsBatchSize)
+		}
+		if progress && time.Since(lastProgress) >= wsProgressInterval {
+			lastProgress = time.Now()
+			ws.send(gin.H{"type": "progress", "count": count, "elapsed_ms": time.Since(start).Milliseconds()})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		ws.sendQueryError(ctx, err, count, start)
+		return
+	}
+
+	if len(batch) > 0 {
+		if err := ws.send(gin.H{"type": "rows", "rows": batch}); err != nil {
+			return
+		}
+	}
+	outcome = "success"
+	ws.send(gin.H{"type": "done", "count": count, "elapsed_ms": time.Since(start).Milliseconds()})
+}
+
+// handleQueryWebSocket serves /ws/query, where every client message is a
+// queryRequest, accepted one at a time. Results are streamed as columns,
+// rows and done frames (or an error frame); closing the socket stops the
+// running query and releases its connection.
+func (s *Server) handleQueryWebSocket(c *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Wait for the running query to stop once cancel has been called
+	var running sync.WaitGroup
+	defer running.Wait()
+	ws := &wsConn{srv: s, conn: conn, session: sessionID(c)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go ws.heartbeat(ctx)
+
+	var busy atomic.Bool
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req queryRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			ws.sendError(apiError{Code: codeBadRequest, Message: sanitizeError(err)})
+			continue
+		}
+		if !busy.CompareAndSwap(false, true) {
+			ws.sendError(apiError{Code: codeBadRequest, Message: "A query is already running"})
+			continue
+		}
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer busy.Store(false)
+			prepared, _, apiErr := s.prepareQuery(&req)
+			if apiErr != nil {
+				ws.sendError(*apiErr)
+				return
+			}
+			release, ok := ws.acquireSlot(ctx, req.queue())
+			if !ok {
+				return
+			}
+			defer release()
+			ws.stream(ctx, req.Query, prepared, false)
+		}()
+	}
+}
+
+// sendQueryError reports a failed query, distinguishing a client cancel
+// from a timeout or a database error.
+func (ws *wsConn) sendQueryError(ctx context.Context, err error, count int, start time.Time) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		ws.sendDBError(ctx.Err())
+	case ctx.Err() != nil:
+		ws.send(gin.H{"type": "cancelled", "count": count, "elapsed_ms": time.Since(start).Milliseconds()})
+	default:
+		ws.sendDBError(err)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	xlsxSheet       = "Results"
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// mysqlDateLayouts are the text forms MySQL uses for DATE, DATETIME and
+// TIMESTAMP values, the latter two with optional fractional seconds.
+var mysqlDateLayouts = map[string]string{
+	"DATE":      "2006-01-02",
+	"DATETIME":  "2006-01-02 15:04:05.999999",
+	"TIMESTAMP": "2006-01-02 15:04:05.999999",
+}
+
+// xlsxCellValue converts a scanned value into the type excelize should
+// store, using the column's database type so that numbers and dates stay
+// numbers and dates in the spreadsheet.
+func xlsxCellValue(dbType string, val any) any {
+	val = convertValue(val)
+	s, ok := val.(string)
+	if !ok {
+		return val
+	}
+
+	switch {
+	case strings.Contains(dbType, "INT") || dbType == "YEAR":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case dbType == "DECIMAL" || dbType == "FLOAT" || dbType == "DOUBLE":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case mysqlDateLayouts[dbType] != "":
+		// Zero dates such as 0000-00-00 fail to parse and stay text
+		if t, err := time.Parse(mysqlDateLayouts[dbType], s); err == nil {
+			return t
+		}
+	}
+	return s
+}
+
+// xlsxMaxRows is the most rows a worksheet holds, the header included.
+const xlsxMaxRows = 1048576
+
+// writeXLSX writes rows as a single-sheet workbook with a frozen header
+// row. The sheet is written with excelize's stream writer, which spills to
+// a temporary file rather than holding every cell in memory. Rows beyond
+// cfg.XLSXMaxRows are left out and a second sheet says so. Errors are only
+// returned before any response has been written.
+func (s *Server) writeXLSX(c *gin.Context, rows *sql.Rows, columns []string) (int, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	dbTypes := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		dbTypes[i] = strings.TrimPrefix(ct.DatabaseTypeName(), "UNSIGNED ")
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName(f.GetSheetName(0), xlsxSheet); err != nil {
+		return 0, err
+	}
+	// Built-in number formats 14 (date) and 22 (date and time)
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		return 0, err
+	}
+	datetimeStyle, err := f.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		return 0, err
+	}
+
+	sw, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		return 0, err
+	}
+	err = sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return 0, err
+	}
+	header := make([]any, len(columns))
+	for i, col := range columns {
+		header[i] = col
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return 0, err
+	}
+
+	values := make([]any, len(columns))
+	valuePtrs := make([]any, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	count := 0
+	truncated := false
+	for rows.Next() {
+		touchRunningQuery(c)
+		if count >= s.cfg.XLSXMaxRows {
+			truncated = true
+			break
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return count, err
+		}
+
+		cells := make([]any, len(columns))
+		for i, val := range values {
+			cells[i] = xlsxCellValue(dbTypes[i], val)
+			if _, ok := cells[i].(time.Time); ok {
+				style := datetimeStyle
+				if dbTypes[i] == "DATE" {
+					style = dateStyle
+				}
+				cells[i] = excelize.Cell{StyleID: style, Value: cells[i]}
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, count+2)
+		if err != nil {
+			return count, err
+		}
+		if err := sw.SetRow(cell, cells); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if err := sw.Flush(); err != nil {
+		return count, err
+	}
+	if truncated {
+		if err := addTruncationSheet(f, count); err != nil {
+			return count, err
+		}
+	}
+
+	filename := "boba-results-" + time.Now().Format("20060102-150405") + ".xlsx"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", xlsxContentType)
+	c.Status(http.StatusOK)
+	if err := f.Write(c.Writer); err != nil {
+		// Headers are already sent; all we can do is drop the connection
+		c.Error(err)
+	}
+	return count, nil
+}
+
+// addTruncationSheet notes on a second sheet that only the first count
+// rows were exported.
+func addTruncationSheet(f *excelize.File, count int) error {
+	const sheet = "Truncated"
+	if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("The result has more than %d rows; only the first %d were exported. Add a LIMIT or narrow the query to export the rest.", count, count)
+	return f.SetCellValue(sheet, "A1", message)
+}